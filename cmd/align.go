@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/Masterminds/semver"
+	"github.com/jbrailsford/tfmodref/internal"
+	"github.com/jbrailsford/tfmodref/util"
+	"github.com/spf13/cobra"
+)
+
+var alignRepository string
+
+// alignCmd represents the align command
+var alignCmd = &cobra.Command{
+	Use:   "align",
+	Short: "Moves every reference to a repository onto the same version",
+	Long: `Updates every module reference to the given repository in the specified file/folder tree to a single version.
+
+By default the highest version already in use is chosen, alternatively the highest remote version allowed by a
+constraint, or a specific version, may be given. References are updated as they would be by update, so downgrades
+are skipped unless --allow-downgrades is set.`,
+	Run: executeAlign,
+}
+
+func init() {
+	rootCmd.AddCommand(alignCmd)
+
+	alignCmd.Flags().StringVar(&alignRepository, "repo", "", "URL of the repository whose references should be aligned")
+	alignCmd.Flags().BoolVar(&versionUnversioned, "version-unversioned", false, "also set the version on sources that are tracking HEAD, a branch or a commit")
+	alignCmd.Flags().BoolVar(&allowDowngrades, "allow-downgrades", false, "allow downgrades of references above the target version")
+	alignCmd.Flags().BoolVar(&dryRun, "dry-run", false, "output what would change, without making any changes")
+	alignCmd.Flags().StringVarP(&constraintStr, "constraint", "c", "", "align on the highest remote version matching the semver constraint")
+	alignCmd.Flags().StringVarP(&specifiedVersion, "version", "v", "", "align on the specified version, will not check if version exists")
+	addHookFlags(alignCmd)
+
+	_ = alignCmd.MarkFlagRequired("repo")
+}
+
+func executeAlign(cmd *cobra.Command, args []string) {
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	repository, err := internal.ParseRemoteURL(alignRepository)
+	if err != nil {
+		util.ErrorAndExit("repository %s is invalid (%s)\n", alignRepository, err.Error())
+	}
+
+	var constraint *semver.Constraints
+	if constraintStr != "" {
+		if constraint, err = semver.NewConstraint(constraintStr); err != nil {
+			util.ErrorAndExit("constraint %s is invalid (%s)\n", constraintStr, err.Error())
+		}
+	}
+
+	var version *semver.Version
+	if specifiedVersion != "" {
+		if version, _ = semver.NewVersion(specifiedVersion); version == nil {
+			util.ErrorAndExit("specified version string %s is invalid\n", specifiedVersion)
+		}
+	}
+
+	if version == nil {
+		version = alignTarget(ctx, repository, constraint)
+	}
+
+	fmt.Printf("aligning: %s (to: %s)\n", alignRepository, version)
+	runUpdate(ctx, false, func(gitVersion *internal.GitSource) (*semver.Version, error) {
+		if !internal.SameRepository(gitVersion.RemoteURL, repository) {
+			return nil, nil
+		}
+
+		return version, nil
+	})
+}
+
+// alignTarget finds the version references to the repository should be aligned on, either the
+// highest remote version matching the constraint or, without one, the highest version in use.
+func alignTarget(ctx context.Context, repository *url.URL, constraint *semver.Constraints) *semver.Version {
+	skew := internal.NewVersionSkew()
+	var reference *internal.GitSource
+	scanSources(ctx, false, func(path string, parser *internal.HclParser, sourcesInFile map[string]internal.GitSource) {
+		for module, gitVersion := range sourcesInFile {
+			if !internal.SameRepository(gitVersion.RemoteURL, repository) {
+				continue
+			}
+
+			if reference == nil {
+				gitVersion := gitVersion
+				reference = &gitVersion
+			}
+
+			skew.Add(module, gitVersion)
+		}
+	})
+
+	exitIfStopped(ctx)
+	if reference == nil {
+		util.ErrorAndExit("no references to %s found\n", alignRepository)
+	}
+
+	if constraint != nil {
+		if err := reference.UpdateRemoteTags(ctx); err != nil {
+			util.ErrorAndExit("could not retrieve remote versions of %s (%s)\n", alignRepository, err.Error())
+		}
+
+		version := reference.FindLatestTagForConstraint(constraint)
+		if version == nil {
+			util.ErrorAndExit("no remote version of %s matches constraint %s\n", alignRepository, constraintStr)
+		}
+
+		return version
+	}
+
+	// The same repository may be referenced by more than one URL, e.g. over both ssh and https.
+	var version *semver.Version
+	for _, referenced := range skew.Repositories() {
+		if highest := referenced.Highest(); highest != nil && (version == nil || highest.GreaterThan(version)) {
+			version = highest
+		}
+	}
+
+	if version == nil {
+		util.ErrorAndExit("no versioned references to %s found, specify a version or constraint to align on\n", alignRepository)
+	}
+
+	return version
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/jbrailsford/tfmodref/internal"
+	"github.com/jbrailsford/tfmodref/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	advisoryLocations []string
+	auditMinSeverity  string
+)
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Reports modules using versions with known security advisories",
+	Long: `Matches the version of each module in the specified file/folder tree against the advisories in one or more
+advisory files, and reports any modules using an affected version along with the advisory's severity and fixed version.
+
+Advisory files may be local paths or http(s) URLs, and contain a JSON object with a list of advisories, e.g.,
+
+  {"advisories": [{"id": "TFM-2021-001", "repository": "github.com/org/terraform-aws-vpc", "affected": ">= 1.0.0, < 1.4.2",
+    "fixed": "v1.4.2", "severity": "high", "description": "Security group allows all ingress"}]}
+
+Exits with a non-zero status if any module is affected.`,
+	Run: executeAudit,
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+
+	auditCmd.Flags().StringSliceVarP(&advisoryLocations, "advisories", "a", nil, "advisory files to check against, as local paths or http(s) URLs")
+	auditCmd.Flags().StringVar(&auditMinSeverity, "min-severity", "low", "only report advisories of at least this severity, one of low, medium, high or critical")
+
+	_ = auditCmd.MarkFlagRequired("advisories")
+}
+
+func executeAudit(cmd *cobra.Command, args []string) {
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	if !internal.IsSeverity(auditMinSeverity) {
+		util.ErrorAndExit("severity %s is not one of low, medium, high or critical\n", auditMinSeverity)
+	}
+
+	advisories := loadAdvisories(ctx)
+
+	findings, affected := 0, 0
+	scanSources(ctx, false, func(path string, parser *internal.HclParser, sourcesInFile map[string]internal.GitSource) {
+		for module, gitVersion := range sourcesInFile {
+			gitVersion := gitVersion
+
+			var matched []internal.Advisory
+			for _, advisory := range advisories.Match(&gitVersion) {
+				if advisory.AtLeast(auditMinSeverity) {
+					matched = append(matched, advisory)
+				}
+			}
+
+			if len(matched) == 0 {
+				continue
+			}
+
+			affected++
+			for _, advisory := range matched {
+				findings++
+				fixed := "none"
+				if advisory.FixedVersion() != nil {
+					fixed = advisory.FixedVersion().Original()
+				}
+
+				fmt.Printf("vulnerable: %s (version: %s, advisory: %s, severity: %s, fixed in: %s)\n", module, gitVersion.LocalVersionString(), advisory.ID, advisory.Severity, fixed)
+				if advisory.Description != "" {
+					fmt.Printf("  %s\n", advisory.Description)
+				}
+			}
+		}
+	})
+
+	exitIfStopped(ctx)
+
+	if findings > 0 {
+		fmt.Fprintf(os.Stderr, "\nfound %d advisory finding(s) affecting %d module(s), to update to fixed versions run: tfmodref update --fix-advisories\n", findings, affected)
+		os.Exit(1)
+	}
+}
+
+// loadAdvisories loads every advisory file given by --advisories, retrying those fetched
+// over http(s) according to the retry flags, and exits if any can't be loaded.
+func loadAdvisories(ctx context.Context) *internal.AdvisoryDatabase {
+	advisories := internal.NewAdvisoryDatabase()
+	for _, location := range advisoryLocations {
+		err := retryPolicy.Do(ctx, func(ctx context.Context) error {
+			return advisories.Load(ctx, http.DefaultClient, location)
+		})
+
+		if err != nil {
+			util.ErrorAndExit("could not load advisories from %s (%s)\n", location, err.Error())
+		}
+	}
+
+	return advisories
+}
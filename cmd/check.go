@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/jbrailsford/tfmodref/internal"
+	"github.com/jbrailsford/tfmodref/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	checkStaged        bool
+	checkRemote        bool
+	checkConstraint    string
+	checkAllowUnpinned bool
+)
+
+// checkCmd represents the check command
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Checks the module sources in the given files, e.g., as a pre-commit hook",
+	Long: `Checks every module source in the specified file/folder tree is pinned to a version which hasn't been
+yanked, and optionally that the version satisfies a constraint and isn't affected by any advisories.
+
+With --staged the content staged in the git index is checked, rather than the files in the worktree, so
+what will be committed is checked whatever other changes have been made. Only files which differ from HEAD
+are checked.
+
+Each finding is printed as file:line: message, and the check exits with a non-zero status if there are any.`,
+	Run: executeCheck,
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+
+	checkCmd.Flags().BoolVar(&checkStaged, "staged", false, "check the content staged in the git index rather than the worktree")
+	checkCmd.Flags().BoolVarP(&checkRemote, "remote", "r", false, "obtain the remote versions of each module, to find versions yanked by tag")
+	checkCmd.Flags().StringVarP(&checkConstraint, "constraint", "c", "", "semver constraint every version must satisfy, e.g., >= 2.0.0")
+	checkCmd.Flags().BoolVar(&checkAllowUnpinned, "allow-unpinned", false, "allow sources without a ref, which track the default branch")
+	checkCmd.Flags().StringSliceVarP(&advisoryLocations, "advisories", "a", nil, "advisory files to check against, as local paths or http(s) URLs")
+	checkCmd.Flags().StringVar(&auditMinSeverity, "min-severity", "low", "only report advisories of at least this severity, one of low, medium, high or critical")
+}
+
+func executeCheck(cmd *cobra.Command, args []string) {
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	checks := internal.Checks{AllowUnpinned: checkAllowUnpinned, MinSeverity: auditMinSeverity}
+	if checkConstraint != "" {
+		constraint, err := semver.NewConstraint(checkConstraint)
+		if err != nil {
+			util.ErrorAndExit("constraint %s is invalid (%s)\n", checkConstraint, err.Error())
+		}
+		checks.Constraint = constraint
+	}
+
+	if !internal.IsSeverity(auditMinSeverity) {
+		util.ErrorAndExit("severity %s is not one of low, medium, high or critical\n", auditMinSeverity)
+	}
+
+	if len(advisoryLocations) > 0 {
+		checks.Advisories = loadAdvisories(ctx)
+	}
+
+	var findings []internal.Finding
+	visit := func(path string, parser *internal.HclParser, sourcesInFile map[string]internal.GitSource) {
+		for module, gitVersion := range sourcesInFile {
+			gitVersion := gitVersion
+			findings = append(findings, checks.Check(module, &gitVersion)...)
+		}
+	}
+
+	var parsed bool
+	if checkStaged {
+		parsed = scanStagedSources(ctx, checkRemote, visit)
+	} else {
+		parsed = scanSources(ctx, checkRemote, visit)
+	}
+
+	exitIfStopped(ctx)
+
+	internal.SortFindings(findings)
+	for _, finding := range findings {
+		finding.File = displayPath(finding.File)
+		fmt.Println(finding.String())
+	}
+
+	if len(findings) > 0 {
+		fmt.Fprintf(os.Stderr, "\nfound %d problem(s) with module sources\n", len(findings))
+		os.Exit(1)
+	}
+
+	if !parsed {
+		os.Exit(1)
+	}
+}
+
+// displayPath returns the path relative to the working directory, where it is within it, as
+// editors and hooks expect.
+func displayPath(path string) string {
+	if !filepath.IsAbs(path) {
+		return path
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+
+	if relative, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(relative, "..") {
+		return relative
+	}
+
+	return path
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jbrailsford/tfmodref/util"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// settingSources records where the value of each flag came from, keyed by flag name.
+var settingSources = make(map[string]string)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Shows the settings in effect",
+	Long: `Every flag can also be set by an environment variable, named TFMODREF_ followed by the flag name
+in upper case with dashes replaced by underscores, e.g., TFMODREF_TAG_PROVIDER, or a JSON config file.
+The flags of a single command are prefixed with the command, e.g., TFMODREF_UPDATE_REMOTE, and set
+within its section of the config file, e.g., {"update": {"remote": "origin"}}.
+
+Settings are resolved in order of precedence: flags, then environment variables, then the config
+file, then the defaults.`,
+}
+
+// configShowCmd represents the config show command
+var configShowCmd = &cobra.Command{
+	Use:   "show [command]",
+	Short: "Prints the settings in effect, and where each came from",
+	Long: `Prints the value of every setting, and whether it came from a flag, an environment variable, the
+config file, or is the default. By default the global settings are shown, naming a command, e.g.,
+update, also shows the settings of that command.`,
+	Run: executeConfigShow,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
+}
+
+func executeConfigShow(cmd *cobra.Command, args []string) {
+	target := cmd
+	if len(args) > 0 {
+		var err error
+		if target, _, err = rootCmd.Find(args); err != nil || target == rootCmd {
+			util.ErrorAndExit("unknown command %v\n", args)
+		}
+
+		if err := resolveSettings(target); err != nil {
+			util.ErrorAndExit("%s\n", err.Error())
+		}
+	}
+
+	var flags []*pflag.Flag
+	visit := func(flag *pflag.Flag) {
+		if flag.Name != "help" {
+			flags = append(flags, flag)
+		}
+	}
+	target.InheritedFlags().VisitAll(visit)
+	target.LocalFlags().VisitAll(visit)
+
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Name < flags[j].Name
+	})
+
+	for _, flag := range flags {
+		fmt.Printf("setting: %s (value: %s, source: %s)\n", flag.Name, flag.Value.String(), settingSources[flag.Name])
+	}
+}
+
+// resolveSettings sets the flags of the command which weren't given from the environment, or
+// the config file.
+func resolveSettings(cmd *cobra.Command) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if err := util.ResolveFlags(cmd.InheritedFlags(), config, "", os.LookupEnv, settingSources); err != nil {
+		return err
+	}
+
+	return util.ResolveFlags(cmd.LocalFlags(), config, commandScope(cmd), os.LookupEnv, settingSources)
+}
+
+// commandScope returns the name the settings of the command are scoped by, e.g., update, or
+// config-show for sub commands, which is empty for the root command as its flags are global.
+func commandScope(cmd *cobra.Command) string {
+	return strings.Join(strings.Fields(cmd.CommandPath())[1:], "-")
+}
+
+// loadConfig loads the config file given by --config or TFMODREF_CONFIG, otherwise the first of
+// .tfmodref.json in the current directory or tfmodref/config.json in the user config directory
+// which exists. No config file is used if neither exist. Every setting must name a global flag,
+// or a flag of the command whose section it's in.
+func loadConfig() (*util.Config, error) {
+	path := configFile
+	if path == "" {
+		path, _ = os.LookupEnv(util.EnvName("config"))
+	}
+
+	if path == "" {
+		candidates := []string{".tfmodref.json"}
+		if dir, err := os.UserConfigDir(); err == nil {
+			candidates = append(candidates, filepath.Join(dir, "tfmodref", "config.json"))
+		}
+
+		for _, candidate := range candidates {
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+	}
+
+	if path == "" {
+		return nil, nil
+	}
+
+	config, err := util.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkConfig(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// checkConfig returns an error for any setting in the config file which doesn't name a flag.
+// Settings outside of a section must name a global flag, and those within a command's section
+// a flag of that command.
+func checkConfig(config *util.Config) error {
+	commands := make(map[string]*cobra.Command)
+	visitCommands(rootCmd, func(cmd *cobra.Command) {
+		commands[commandScope(cmd)] = cmd
+	})
+
+	global := flagNames(rootCmd.PersistentFlags())
+	for name := range config.Values {
+		if global[name] {
+			continue
+		}
+
+		var scopes []string
+		for scope, cmd := range commands {
+			if scope != "" && flagNames(cmd.LocalFlags())[name] {
+				scopes = append(scopes, scope)
+			}
+		}
+
+		if len(scopes) == 0 {
+			return fmt.Errorf("unknown setting %s in config file %s", name, config.Path)
+		}
+
+		sort.Strings(scopes)
+		return fmt.Errorf("setting %s in config file %s must be within the section of a command, one of %s", name, config.Path, strings.Join(scopes, ", "))
+	}
+
+	for scope, section := range config.Commands {
+		cmd, ok := commands[scope]
+		if !ok || scope == "" {
+			return fmt.Errorf("unknown command %s in config file %s", scope, config.Path)
+		}
+
+		local := flagNames(cmd.LocalFlags())
+		for name := range section.Values {
+			if !local[name] {
+				return fmt.Errorf("unknown setting %s of the %s command in config file %s", name, scope, config.Path)
+			}
+		}
+	}
+
+	return nil
+}
+
+// visitCommands calls fn for the command and all its sub commands.
+func visitCommands(cmd *cobra.Command, fn func(*cobra.Command)) {
+	fn(cmd)
+	for _, sub := range cmd.Commands() {
+		visitCommands(sub, fn)
+	}
+}
+
+// flagNames returns the names of the flags in the set.
+func flagNames(flags *pflag.FlagSet) map[string]bool {
+	names := make(map[string]bool)
+	flags.VisitAll(func(flag *pflag.Flag) {
+		names[flag.Name] = true
+	})
+
+	return names
+}
@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jbrailsford/tfmodref/internal"
+	"github.com/jbrailsford/tfmodref/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	preHooks      []string
+	postHooks     []string
+	preFileHooks  []string
+	postFileHooks []string
+)
+
+// pendingFile is a file with updated sources, waiting to be saved.
+type pendingFile struct {
+	path    string
+	parser  *internal.HclParser
+	changes []internal.JournalChange
+}
+
+// addHookFlags adds the flags setting the hooks run around saving updated files.
+func addHookFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&preHooks, "pre-hook", nil, "commands run once before any files are updated, aborting the update if any fail")
+	cmd.Flags().StringArrayVar(&postHooks, "post-hook", nil, "commands run once after every file is updated, e.g., terraform fmt -recursive, rolling back the update if any fail")
+	cmd.Flags().StringArrayVar(&preFileHooks, "pre-file-hook", nil, "commands run before each file is updated, with the file as $1, rolling back the update if any fail")
+	cmd.Flags().StringArrayVar(&postFileHooks, "post-file-hook", nil, "commands run after each file is updated, with the file as $1, e.g., terragrunt hclfmt --terragrunt-hclfmt-file \"$1\", rolling back the update if any fail")
+}
+
+// hasHooks returns true if any hooks are set.
+func hasHooks() bool {
+	return len(preHooks)+len(postHooks)+len(preFileHooks)+len(postFileHooks) > 0
+}
+
+// saveUpdates saves every updated file, running the hooks before and after, then records the
+// changes in the journal so they can be undone. If a hook fails the update is aborted, and the
+// files already saved are rolled back to their original content.
+func saveUpdates(ctx context.Context, journal *internal.Journal, files []pendingFile, planned []*internal.Change) {
+	if len(files) == 0 || ctx.Err() != nil {
+		return
+	}
+
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.path)
+	}
+
+	if err := runHooks(ctx, preHooks, internal.HookPreUpdate, paths, planned); err != nil {
+		util.ErrorAndExit("aborting update, no files were changed (%s)\n", err.Error())
+	}
+
+	var saved []pendingFile
+	abort := func(err error) {
+		rollback(saved)
+		util.ErrorAndExit("aborting update, changes rolled back (%s)\n", err.Error())
+	}
+
+	for _, file := range files {
+		if ctx.Err() != nil {
+			break
+		}
+
+		fileChanges := changesToFile(planned, file.path)
+		if err := runHooks(ctx, preFileHooks, internal.HookPreUpdate, []string{file.path}, fileChanges); err != nil {
+			abort(err)
+		}
+
+		if err := file.parser.Save(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "error saving file at %s (%s)\n", file.path, err.Error())
+			continue
+		}
+		saved = append(saved, file)
+
+		if err := runHooks(ctx, postFileHooks, internal.HookPostUpdate, []string{file.path}, fileChanges); err != nil {
+			abort(err)
+		}
+	}
+
+	if ctx.Err() == nil && len(saved) > 0 {
+		var savedPaths []string
+		var savedChanges []*internal.Change
+		for _, file := range saved {
+			savedPaths = append(savedPaths, file.path)
+			savedChanges = append(savedChanges, changesToFile(planned, file.path)...)
+		}
+
+		if err := runHooks(ctx, postHooks, internal.HookPostUpdate, savedPaths, savedChanges); err != nil {
+			abort(err)
+		}
+	}
+
+	for _, file := range saved {
+		record(journal, file)
+	}
+}
+
+// runHooks runs each hook command in turn, stopping at the first to fail.
+func runHooks(ctx context.Context, commands []string, phase string, files []string, changes []*internal.Change) error {
+	for _, command := range commands {
+		event := internal.HookEvent{Phase: phase, Files: files, Changes: changes}
+		if err := internal.RunHook(ctx, command, event, os.Stdout, os.Stderr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rollback reverts the saved files to their original content, most recently saved first.
+func rollback(saved []pendingFile) {
+	for i := len(saved) - 1; i >= 0; i-- {
+		if err := saved[i].parser.Revert(); err != nil {
+			fmt.Fprintf(os.Stderr, "error rolling back file at %s (%s)\n", saved[i].path, err.Error())
+		}
+	}
+}
+
+// record records the changes made to a saved file in the journal, along with its content as
+// left by any hooks, so they can be undone. Other files holding updated sources, e.g., terragrunt
+// includes, are recorded with the same changes.
+func record(journal *internal.Journal, file pendingFile) {
+	recordFile(journal, file.path, file.parser.Original(), file.changes)
+	for path, original := range file.parser.IncludedFiles() {
+		recordFile(journal, path, original, file.changes)
+	}
+}
+
+func recordFile(journal *internal.Journal, path string, original []byte, changes []internal.JournalChange) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error recording changes to %s in journal (%s)\n", path, err.Error())
+		return
+	}
+
+	written, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error recording changes to %s in journal (%s)\n", path, err.Error())
+		return
+	}
+
+	if err := journal.Record(path, fi.Mode(), original, written, changes); err != nil {
+		fmt.Fprintf(os.Stderr, "error recording changes to %s in journal (%s)\n", path, err.Error())
+	}
+}
+
+// changesToFile returns the planned changes to the given file.
+func changesToFile(planned []*internal.Change, path string) []*internal.Change {
+	var changes []*internal.Change
+	for _, change := range planned {
+		if change.File == path {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Masterminds/semver"
+	"github.com/jbrailsford/tfmodref/internal"
+	"github.com/jbrailsford/tfmodref/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	interfaceFrom string
+	interfaceTo   string
+)
+
+// interfaceDiffCmd represents the interface-diff command
+var interfaceDiffCmd = &cobra.Command{
+	Use:   "interface-diff <source>",
+	Short: "Reports the changes to the variables and outputs of a module between two versions",
+	Long: `Fetches the module a source refers to at both versions, and reports the variables and outputs added, removed or
+changed between them. The source may be given in any form a module source would use, including a //subdirectory, e.g.,
+
+  tfmodref interface-diff github.com/terraform-aws-modules/terraform-aws-vpc --from v2.0.0 --to v3.0.0
+
+Removed variables, newly required variables and removed outputs are breaking, and the command exits with a non-zero
+status if there are any.`,
+	Args: cobra.ExactArgs(1),
+	Run:  executeInterfaceDiff,
+}
+
+func init() {
+	rootCmd.AddCommand(interfaceDiffCmd)
+
+	interfaceDiffCmd.Flags().StringVar(&interfaceFrom, "from", "", "version to compare from")
+	interfaceDiffCmd.Flags().StringVar(&interfaceTo, "to", "", "version to compare to")
+
+	_ = interfaceDiffCmd.MarkFlagRequired("from")
+	_ = interfaceDiffCmd.MarkFlagRequired("to")
+}
+
+func executeInterfaceDiff(cmd *cobra.Command, args []string) {
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	remoteURL, err := internal.ParseRemoteURL(args[0])
+	if err != nil {
+		util.ErrorAndExit("%s\n", err.Error())
+	}
+	subdirectory := internal.SourceSubdirectory(args[0])
+
+	from, err := semver.NewVersion(interfaceFrom)
+	if err != nil {
+		util.ErrorAndExit("version %s is invalid (%s)\n", interfaceFrom, err.Error())
+	}
+
+	to, err := semver.NewVersion(interfaceTo)
+	if err != nil {
+		util.ErrorAndExit("version %s is invalid (%s)\n", interfaceTo, err.Error())
+	}
+
+	fromInterface, err := internal.FetchModuleInterface(ctx, remoteURL, from, subdirectory)
+	if err != nil {
+		util.ErrorAndExit("could not read the module at %s (%s)\n", from.Original(), err.Error())
+	}
+
+	toInterface, err := internal.FetchModuleInterface(ctx, remoteURL, to, subdirectory)
+	if err != nil {
+		util.ErrorAndExit("could not read the module at %s (%s)\n", to.Original(), err.Error())
+	}
+
+	changes := internal.DiffInterfaces(fromInterface, toInterface)
+	if len(changes) == 0 {
+		fmt.Printf("no changes to variables or outputs between %s and %s\n", from.Original(), to.Original())
+		return
+	}
+
+	breaking := 0
+	for _, change := range changes {
+		fmt.Println(change.String())
+		if change.Breaking {
+			breaking++
+		}
+	}
+
+	if breaking > 0 {
+		fmt.Fprintf(os.Stderr, "\nfound %d breaking change(s) between %s and %s\n", breaking, from.Original(), to.Original())
+		os.Exit(1)
+	}
+}
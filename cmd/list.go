@@ -2,14 +2,14 @@ package cmd
 
 import (
 	"fmt"
-	"os"
+	"time"
 
 	"github.com/jbrailsford/tfmodref/internal"
-	"github.com/jbrailsford/tfmodref/util"
 	"github.com/spf13/cobra"
 )
 
 var listRemote bool
+var listLibyear bool
 
 // listCmd represents the list command
 var listCmd = &cobra.Command{
@@ -17,44 +17,93 @@ var listCmd = &cobra.Command{
 	Short: "Lists the versions of the given module('s)",
 	Long: `By default lists the local version (in source) of each module in the specified file/folder tree.
 	
-Optionally, the remote flag may be provided which will obtain the latest remote version for that module.`,
+Optionally, the remote flag may be provided which will obtain the latest remote version for that module,
+and when the local and latest versions were released, and the libyear flag to also report how far apart
+their releases are.`,
 	Run: executeList,
 }
 
 func init() {
 	rootCmd.AddCommand(listCmd)
 
-	listCmd.Flags().BoolVarP(&listRemote, "remote", "r", false, "obtain latest remote version for any found modules")
+	listCmd.Flags().BoolVarP(&listRemote, "remote", "r", false, "obtain latest remote version, and the release dates, for any found modules")
+	listCmd.Flags().BoolVar(&listLibyear, "libyear", false, "report the libyear of any found modules, implies --remote")
 }
 
 func executeList(cmd *cobra.Command, args []string) {
-	paths, err := util.FindTerraformFiles(path, &tfExtensions)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error walking path at %s with extensions [%s] (%s)", path, tfExtensions.AsCommaSeparatedString(), err.Error())
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	if listLibyear {
+		listRemote = true
 	}
 
-	for _, path := range paths {
-		parser, errs := internal.NewHclParser(path)
-		if errs != nil {
-			fmt.Fprintf(os.Stderr, "errors occured whilst parsing file at %s:\n", path)
-			for _, e := range errs {
-				fmt.Fprintf(os.Stderr, "%s\n", e.Error())
+	var unresolved unresolvedSources
+	var totalLibyear float64
+	var dated, undated int
+	scanSources(ctx, listRemote, func(path string, parser *internal.HclParser, sourcesInFile map[string]internal.GitSource) {
+		for module, gitVersion := range sourcesInFile {
+			local := gitVersion.LocalVersionString()
+			if gitVersion.IsYanked() {
+				local += " [yanked]"
 			}
-			continue
-		}
 
-		sourcesInFile, err := parser.FindGitSources(listRemote)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error reading file at %s (%s)", path, err.Error())
-			continue
-		}
+			if !gitVersion.IsEvaluated() {
+				fmt.Printf("module: %s (local: %s)\n", module, local)
+				unresolved.Add(module, gitVersion.UpdateError)
+			} else if !gitVersion.IsResolved() {
+				fmt.Printf("module: %s (local: %s, remote: unresolved)\n", module, local)
+				unresolved.Add(module, gitVersion.RemoteError)
+			} else if listRemote {
+				err := gitVersion.UpdateLibyearReleaseDates(ctx)
+				if err != nil {
+					unresolved.Add(module, fmt.Errorf("could not retrieve release dates, %s", err.Error()))
+				}
 
-		for module, gitVersion := range sourcesInFile {
-			if listRemote {
-				fmt.Printf("module: %s (local: %s, remote: %s - total versions: %d)\n", module, gitVersion.LocalVersionString(), gitVersion.LatestRemoteVersion, len(gitVersion.RemoteVersions))
+				libyear := ""
+				if listLibyear {
+					libyear = ", libyear: unknown"
+					if years, ok := gitVersion.Libyear(); ok && err == nil {
+						libyear = fmt.Sprintf(", libyear: %.2f", years)
+						totalLibyear += years
+						dated++
+					} else {
+						undated++
+					}
+				}
+
+				fmt.Printf("module: %s (local: %s, released: %s, remote: %s, released: %s%s - total versions: %d)\n",
+					module, local, releaseDate(gitVersion.LocalReleaseDate()), latestRemoteVersion(gitVersion),
+					releaseDate(gitVersion.ReleaseDate(gitVersion.LatestRemoteVersion)), libyear, len(gitVersion.RemoteVersions))
 			} else {
-				fmt.Printf("module: %s (local: %s)\n", module, gitVersion.LocalVersionString())
+				fmt.Printf("module: %s (local: %s)\n", module, local)
 			}
 		}
+	})
+
+	if listLibyear && dated+undated > 0 {
+		fmt.Printf("\ntotal libyear: %.2f (modules: %d, without release dates: %d)\n", totalLibyear, dated, undated)
+	}
+
+	exitIfStopped(ctx)
+	unresolved.ExitIfAny()
+}
+
+// latestRemoteVersion formats the latest remote version of the source, which is missing where
+// every version has been yanked.
+func latestRemoteVersion(gitVersion internal.GitSource) string {
+	if gitVersion.LatestRemoteVersion == nil {
+		return "no unyanked versions"
+	}
+
+	return gitVersion.LatestRemoteVersion.String()
+}
+
+// releaseDate formats a release date, or returns unknown if it isn't known.
+func releaseDate(date time.Time, ok bool) string {
+	if !ok {
+		return "unknown"
 	}
+
+	return date.UTC().Format("2006-01-02")
 }
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/jbrailsford/tfmodref/internal"
+	"github.com/jbrailsford/tfmodref/util"
+)
+
+var (
+	openPR     bool
+	prBranch   string
+	prBase     string
+	prRemote   string
+	prProvider string
+	prGroupBy  string
+)
+
+// openPullRequests splits the planned changes into groups, as set by --group-by, then commits
+// each group to its own branch, named from --branch, on top of the current HEAD, pushes it and
+// opens a pull request describing the changes. Any pull request already open for a branch is
+// updated instead. Honours --dry-run.
+func openPullRequests(ctx context.Context, parsers map[string]*internal.HclParser, changes []*internal.Change) {
+	grouping, err := internal.ParseGrouping(prGroupBy)
+	if err != nil {
+		util.ErrorAndExit("%s\n", err.Error())
+	}
+
+	repo, err := internal.OpenLocalRepository(path)
+	if err != nil {
+		util.ErrorAndExit("could not open pull request (%s)\n", err.Error())
+	}
+
+	groups := grouping.Group(prBranch, repo.Root(), changes)
+	if dryRun {
+		for _, group := range groups {
+			pr := internal.NewPullRequest(group.Branch, prBase, group.Changes)
+			fmt.Printf("would open pull request: %s (branch: %s)\n", pr.Title, group.Branch)
+		}
+		return
+	}
+
+	base := prBase
+	if base == "" {
+		if base, err = repo.CurrentBranch(); err != nil {
+			util.ErrorAndExit("could not open pull request, set the branch to open it against with --base (%s)\n", err.Error())
+		}
+	}
+
+	remoteURL, err := repo.RemoteURL(prRemote)
+	if err != nil {
+		util.ErrorAndExit("could not open pull request (%s)\n", err.Error())
+	}
+
+	provider, err := internal.NewPullRequestProvider(prProvider, remoteURL)
+	if err != nil {
+		util.ErrorAndExit("could not open pull request (%s)\n", err.Error())
+	}
+
+	var failed int
+	for _, group := range groups {
+		pr := internal.NewPullRequest(group.Branch, base, group.Changes)
+		if err := openPullRequest(ctx, repo, provider, remoteURL, pr, groupFiles(parsers, group)); err != nil {
+			fmt.Fprintf(os.Stderr, "could not open pull request for branch %s (%s)\n", group.Branch, err.Error())
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		util.ErrorAndExit("%d of %d pull requests could not be opened\n", failed, len(groups))
+	}
+}
+
+// openPullRequest commits the files to the pull request's branch, pushes it and opens the
+// pull request, or updates the one already open.
+func openPullRequest(ctx context.Context, repo *internal.LocalRepository, provider internal.PullRequestProvider, remoteURL *url.URL, pr internal.PullRequest, files map[string][]byte) error {
+	if err := repo.Commit(pr.Branch, pr.Title+"\n\n"+pr.Body, files); err != nil {
+		return fmt.Errorf("could not commit updates (%s)", err.Error())
+	}
+
+	if err := repo.Push(ctx, prRemote, pr.Branch, provider.PushAuth(remoteURL)); err != nil {
+		return fmt.Errorf("could not push to %s (%s)", prRemote, err.Error())
+	}
+
+	webURL, updated, err := provider.OpenPullRequest(ctx, remoteURL, pr)
+	if err != nil {
+		return fmt.Errorf("the branch was pushed, but the pull request could not be opened (%s)", err.Error())
+	}
+
+	if updated {
+		fmt.Printf("updated pull request: %s (%s)\n", pr.Title, webURL)
+	} else {
+		fmt.Printf("opened pull request: %s (%s)\n", pr.Title, webURL)
+	}
+
+	return nil
+}
+
+// groupFiles returns the content of each file changed by the group, with only the group's
+// changes made to it, including the files terragrunt sources take their ref from.
+func groupFiles(parsers map[string]*internal.HclParser, group *internal.ChangeGroup) map[string][]byte {
+	updated := make(map[string][]*internal.GitSource)
+	for _, change := range group.Changes {
+		updated[change.File] = append(updated[change.File], change.Source)
+	}
+
+	files := make(map[string][]byte)
+	for path, sources := range updated {
+		parser := parsers[path]
+		parser.ResetBlockSources()
+		for _, source := range sources {
+			parser.UpdateBlockSource(source)
+		}
+
+		files[path] = parser.Bytes()
+		for included, content := range parser.IncludedBytes() {
+			files[included] = content
+		}
+	}
+
+	return files
+}
@@ -1,6 +1,14 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jbrailsford/tfmodref/internal"
 	"github.com/jbrailsford/tfmodref/util"
 	"github.com/spf13/cobra"
 )
@@ -8,8 +16,21 @@ import (
 var (
 	path         string
 	tfExtensions util.FileExtensions
+	tagProvider  string
+	tagFixture   string
+	retryPolicy  = internal.DefaultRetryPolicy
+	timeout      time.Duration
+	journalDir   string
+	yankedFile   string
+	configFile   string
+	extensions   []string
+	filesFrom    string
+	changedSince string
 )
 
+// defaultExtensions are the extensions of files searched when none are given.
+var defaultExtensions = []string{".hcl", ".tf", ".hcl.json", ".tf.json"}
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "tfmodref",
@@ -22,30 +43,163 @@ upgrade/downgrade, both within a semver constraint or to the latest available ve
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// Interrupting the process cancels the command context, allowing commands to stop
+// cleanly rather than being killed mid-write.
 func Execute() {
-	cobra.CheckErr(rootCmd.Execute())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cobra.CheckErr(rootCmd.ExecuteContext(ctx))
 }
 
 func init() {
+	// Set here, rather than in rootCmd, as configure refers back to rootCmd for the known settings.
+	rootCmd.PersistentPreRunE = configure
+
 	rootCmd.PersistentFlags().StringVarP(&path, "path", "p", ".", "path to search in (recursively) for terraform files - may be an exact file or a directory")
-	extensions := rootCmd.PersistentFlags().StringSliceP("extensions", "e", []string{".hcl", ".tf"}, "file extensions of files to search in for references")
+	rootCmd.PersistentFlags().StringVar(&tagProvider, "tag-provider", "auto", "provider used to look up remote tags, one of auto, git, github, gitlab or fixture")
+	rootCmd.PersistentFlags().StringVar(&tagFixture, "tag-fixture", "", "JSON file of tags per repository, used by the fixture tag provider")
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 0, "maximum duration of the whole run, e.g., 5m (0 for no limit)")
+	rootCmd.PersistentFlags().DurationVar(&retryPolicy.Timeout, "remote-timeout", time.Minute, "maximum time spent retrieving the remote tags of each repository, including retries (0 for no limit)")
+	rootCmd.PersistentFlags().IntVar(&retryPolicy.Attempts, "retries", retryPolicy.Attempts, "number of attempts made to retrieve the remote tags of each repository")
+	rootCmd.PersistentFlags().DurationVar(&retryPolicy.BaseDelay, "retry-delay", retryPolicy.BaseDelay, "initial delay between attempts, doubled (with jitter) on each retry")
+	rootCmd.PersistentFlags().StringVar(&journalDir, "journal-dir", "", "directory in which update runs are recorded so they can be undone (defaults to the user cache directory)")
+	rootCmd.PersistentFlags().StringVar(&yankedFile, "yanked", "", "JSON file of yanked versions per repository, which are never chosen as the version to update to")
+	rootCmd.PersistentFlags().StringSliceVarP(&extensions, "extensions", "e", defaultExtensions, "file extensions of files to search in for references")
+	rootCmd.PersistentFlags().StringVar(&filesFrom, "files-from", "", "read the files to search from this file, or stdin if -, one per line or NUL separated, rather than searching the path")
+	rootCmd.PersistentFlags().StringVar(&changedSince, "changed-since", "", "only search files changed between this git revision and the worktree, rather than every file under the path")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "JSON config file of settings (defaults to .tfmodref.json in the current directory, then tfmodref/config.json in the user config directory)")
 
-	tfExtensions = make(util.FileExtensions)
+	handleCobraError(rootCmd.MarkPersistentFlagDirname("path"))
+	handleCobraError(rootCmd.MarkPersistentFlagFilename("path"))
+}
 
-	if len(*extensions) == 0 {
-		*extensions = []string{".hcl", ".tf"}
+// configure sets up the global state used by every command, from the persistent flags. Flags
+// which weren't given are first resolved from the environment and config file.
+func configure(cmd *cobra.Command, args []string) error {
+	if err := resolveSettings(cmd); err != nil {
+		return err
 	}
 
-	for _, ext := range *extensions {
-		tfExtensions[ext] = nil
+	configureSearch()
+
+	if err := configureTagProviders(cmd, args); err != nil {
+		return err
 	}
 
+	return configureYankedVersions(cmd, args)
+}
+
+// configureSearch sets the path and extensions of the files searched, falling back to the
+// defaults if either is empty.
+func configureSearch() {
 	if path == "" {
 		path = "."
 	}
 
-	handleCobraError(rootCmd.MarkPersistentFlagDirname("path"))
-	handleCobraError(rootCmd.MarkPersistentFlagFilename("path"))
+	if len(extensions) == 0 {
+		extensions = defaultExtensions
+	}
+
+	tfExtensions = make(util.FileExtensions)
+	for _, ext := range extensions {
+		tfExtensions[ext] = nil
+	}
+}
+
+// configureYankedVersions loads the versions yanked by --yanked, in addition to those yanked
+// by a tag, e.g., v1.2.0+yanked, in the repository itself.
+func configureYankedVersions(cmd *cobra.Command, args []string) error {
+	if yankedFile == "" {
+		return nil
+	}
+
+	yanked, err := internal.LoadYankedVersions(yankedFile)
+	if err != nil {
+		return err
+	}
+
+	internal.YankedVersions = yanked
+	return nil
+}
+
+// configureTagProviders sets up the global tag provider registry, by default github.com
+// and gitlab.com use their respective APIs for HTTPS remotes, or any remote where a token is
+// set, falling back to git where the API refuses the lookup. All other hosts use git directly.
+// Every provider retries failed lookups according to the retry flags.
+func configureTagProviders(cmd *cobra.Command, args []string) error {
+	if tagFixture != "" && tagProvider == "auto" {
+		tagProvider = "fixture"
+	}
+
+	if tagProvider != "auto" {
+		provider, err := internal.NewTagProvider(tagProvider, tagFixture)
+		if err != nil {
+			return err
+		}
+
+		internal.TagProviders = internal.NewTagProviderRegistry(withRetries(provider))
+		return nil
+	}
+
+	internal.TagProviders = internal.NewTagProviderRegistry(withRetries(&internal.GitTagProvider{}))
+	github, gitlab := internal.NewGitHubTagProvider(), internal.NewGitLabTagProvider()
+	internal.TagProviders.Register("github.com", withRetries(internal.NewFallbackTagProvider(github, github.Token != "")))
+	internal.TagProviders.Register("gitlab.com", withRetries(internal.NewFallbackTagProvider(gitlab, gitlab.Token != "")))
+
+	return nil
+}
+
+// commandContext returns the context a command should run under, bounded by --timeout.
+func commandContext(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(cmd.Context(), timeout)
+	}
+
+	return context.WithCancel(cmd.Context())
+}
+
+// exitIfStopped exits with a non-zero status if the run was interrupted or timed out.
+func exitIfStopped(ctx context.Context) {
+	if err := ctx.Err(); err != nil {
+		util.ErrorAndExit("stopped before all files were processed (%s)", err.Error())
+	}
+}
+
+// journalDirectory returns the configured journal directory, or the default if none is set.
+func journalDirectory() string {
+	if journalDir != "" {
+		return journalDir
+	}
+
+	return internal.DefaultJournalDir()
+}
+
+func withRetries(provider internal.TagProvider) internal.TagProvider {
+	return internal.NewRetryingTagProvider(provider, retryPolicy)
+}
+
+// unresolvedSources collects the modules whose versions could not be resolved, either as their
+// source could not be evaluated or their remote versions could not be retrieved.
+type unresolvedSources []string
+
+func (u *unresolvedSources) Add(module string, err error) {
+	*u = append(*u, fmt.Sprintf("%s (%s)", module, err.Error()))
+}
+
+// ExitIfAny prints a summary of the unresolved modules, if there are any, and exits with
+// a non-zero status.
+func (u unresolvedSources) ExitIfAny() {
+	if len(u) == 0 {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "\ncould not resolve the versions of %d module(s):\n", len(u))
+	for _, module := range u {
+		fmt.Fprintf(os.Stderr, "  %s\n", module)
+	}
+
+	os.Exit(1)
 }
 
 func handleCobraError(err error) {
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/jbrailsford/tfmodref/internal"
+	"github.com/jbrailsford/tfmodref/util"
+)
+
+// sourceVisitor is called with the git sources found within each file.
+type sourceVisitor func(path string, parser *internal.HclParser, sources map[string]internal.GitSource)
+
+// scanSources finds every terraform file under the path flag and calls visit with the git sources
+// found in each, optionally including their remote versions. Files which can't be parsed are
+// reported and skipped, returning false, and scanning stops once the context is done.
+func scanSources(ctx context.Context, includeRemote bool, visit sourceVisitor) bool {
+	parsed := true
+	paths, err := terraformFiles(ctx)
+	if err != nil && (filesFrom != "" || changedSince != "") {
+		util.ErrorAndExit("could not list files to search (%s)\n", err.Error())
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "error walking path at %s with extensions [%s] (%s)", path, tfExtensions.AsCommaSeparatedString(), err.Error())
+		parsed = false
+	}
+
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			break
+		}
+
+		parser, errs := internal.NewHclParser(path)
+		if errs != nil {
+			fmt.Fprintf(os.Stderr, "errors occured whilst parsing file at %s:\n", path)
+			for _, e := range errs {
+				fmt.Fprintf(os.Stderr, "%s\n", e.Error())
+			}
+			parsed = false
+			continue
+		}
+
+		sourcesInFile, err := parser.FindGitSources(ctx, includeRemote)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading file at %s (%s)", path, err.Error())
+			parsed = false
+			continue
+		}
+
+		visit(path, parser, sourcesInFile)
+	}
+
+	return parsed
+}
+
+// scanStagedSources calls visit with the git sources found within the content staged in the git
+// index of each changed terraform file under the path flag, rather than the content of the file
+// in the worktree. Files which can't be parsed are reported and skipped, returning false.
+func scanStagedSources(ctx context.Context, includeRemote bool, visit sourceVisitor) bool {
+	repo, err := internal.OpenLocalRepository(path)
+	if err != nil {
+		util.ErrorAndExit("could not read the staged files (%s)\n", err.Error())
+	}
+
+	staged, err := repo.StagedFiles()
+	if err != nil {
+		util.ErrorAndExit("could not read the staged files (%s)\n", err.Error())
+	}
+
+	var files []string
+	for file := range staged {
+		files = append(files, file)
+	}
+
+	paths, err := util.FilterTerraformFiles(files, path, &tfExtensions)
+	if err != nil {
+		util.ErrorAndExit("could not read the staged files (%s)\n", err.Error())
+	}
+	sort.Strings(paths)
+
+	parsed := true
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			break
+		}
+
+		parser, errs := internal.NewHclParserFromBytes(path, staged[path])
+		if errs != nil {
+			fmt.Fprintf(os.Stderr, "errors occured whilst parsing staged file at %s:\n", path)
+			for _, e := range errs {
+				fmt.Fprintf(os.Stderr, "%s\n", e.Error())
+			}
+			parsed = false
+			continue
+		}
+
+		sourcesInFile, err := parser.FindGitSources(ctx, includeRemote)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error reading staged file at %s (%s)", path, err.Error())
+			parsed = false
+			continue
+		}
+
+		visit(path, parser, sourcesInFile)
+	}
+
+	return parsed
+}
+
+var (
+	listFilesOnce sync.Once
+	listedFiles   []string
+	listFilesErr  error
+)
+
+// terraformFiles returns the terraform files under the path flag. These are the files read from
+// --files-from, or changed since the --changed-since revision, if either are set, otherwise every
+// file found by walking the path. Listed files are only read once, so that they can be scanned
+// repeatedly, e.g., by serve, even when read from stdin.
+func terraformFiles(ctx context.Context) ([]string, error) {
+	if filesFrom == "" && changedSince == "" {
+		return util.FindTerraformFiles(ctx, path, &tfExtensions)
+	}
+
+	listFilesOnce.Do(func() {
+		var files []string
+		if files, listFilesErr = listFiles(); listFilesErr == nil {
+			listedFiles, listFilesErr = util.FilterTerraformFiles(files, path, &tfExtensions)
+		}
+	})
+
+	return listedFiles, listFilesErr
+}
+
+// listFiles returns the files given by --files-from or --changed-since.
+func listFiles() ([]string, error) {
+	if filesFrom != "" && changedSince != "" {
+		return nil, errors.New("--files-from and --changed-since can't be combined")
+	}
+
+	if changedSince != "" {
+		repo, err := internal.OpenLocalRepository(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return repo.ChangedSince(changedSince)
+	}
+
+	if filesFrom == "-" {
+		return util.ReadFileList(os.Stdin)
+	}
+
+	f, err := os.Open(filepath.Clean(filesFrom))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return util.ReadFileList(f)
+}
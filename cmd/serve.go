@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jbrailsford/tfmodref/internal"
+	"github.com/jbrailsford/tfmodref/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serveAddr        string
+	serveConcurrency int
+	serveCacheTTL    time.Duration
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serves module versions and update plans over a JSON API",
+	Long: `Serves the modules in the specified file/folder tree, their remote versions, and the updates
+which would be made to them over a JSON API.
+
+  GET  /inventory        every module reference, with its latest version if ?remote=true
+  GET  /outdated         the module references with a newer version available
+  POST /plan             the updates planned for the policy in the request body, e.g.,
+                         {"constraint": "~3", "repository": "...", "allow_downgrades": true}
+
+The files are scanned on every request, remote versions are cached for --cache-ttl, and at most
+--concurrency remote lookups are made at once across all requests. Nothing is written to the files.`,
+	Run: executeServe,
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&serveAddr, "addr", ":8080", "address to listen on")
+	serveCmd.Flags().IntVar(&serveConcurrency, "concurrency", 4, "maximum number of remote lookups in progress at once (0 for no limit)")
+	serveCmd.Flags().DurationVar(&serveCacheTTL, "cache-ttl", 10*time.Minute, "how long remote versions and release dates are cached for (0 to cache forever)")
+}
+
+func executeServe(cmd *cobra.Command, args []string) {
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	internal.RemoteLookups = internal.NewLimiter(serveConcurrency)
+	internal.SourceCache.TTL = serveCacheTTL
+	internal.ReleaseDateCache.TTL = serveCacheTTL
+	internal.FailedLookups.TTL = serveCacheTTL
+
+	scan := func(ctx context.Context, includeRemote bool, visit func(path string, sources map[string]internal.GitSource)) {
+		scanSources(ctx, includeRemote, func(path string, parser *internal.HclParser, sources map[string]internal.GitSource) {
+			visit(path, sources)
+		})
+	}
+
+	server := &http.Server{
+		Addr:              serveAddr,
+		Handler:           internal.NewServer(scan).Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Printf("serving modules in %s on %s\n", path, serveAddr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		util.ErrorAndExit("could not serve on %s (%s)", serveAddr, err.Error())
+	}
+}
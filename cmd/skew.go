@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/jbrailsford/tfmodref/internal"
+	"github.com/spf13/cobra"
+)
+
+var (
+	skewRemote      bool
+	skewOnlySkewed  bool
+	skewListModules bool
+)
+
+// skewCmd represents the skew command
+var skewCmd = &cobra.Command{
+	Use:   "skew",
+	Short: "Reports the versions of each repository in use across the file/folder tree",
+	Long: `Groups every module reference in the specified file/folder tree by repository, and reports each
+distinct version in use, the number of files using it, and the newest version available remotely.
+
+This shows where environments have drifted apart and are using different versions of the same module.`,
+	Run: executeSkew,
+}
+
+func init() {
+	rootCmd.AddCommand(skewCmd)
+
+	skewCmd.Flags().BoolVarP(&skewRemote, "remote", "r", true, "obtain the newest remote version of each repository")
+	skewCmd.Flags().BoolVar(&skewOnlySkewed, "only-skewed", false, "only report repositories with more than one version in use")
+	skewCmd.Flags().BoolVar(&skewListModules, "modules", false, "list the modules using each version")
+}
+
+func executeSkew(cmd *cobra.Command, args []string) {
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	skew := internal.NewVersionSkew()
+	var unresolved unresolvedSources
+	scanSources(ctx, skewRemote, func(path string, parser *internal.HclParser, sourcesInFile map[string]internal.GitSource) {
+		for module, gitVersion := range sourcesInFile {
+			if !gitVersion.IsEvaluated() {
+				unresolved.Add(module, gitVersion.UpdateError)
+				continue
+			}
+
+			if !gitVersion.IsResolved() {
+				unresolved.Add(module, gitVersion.RemoteError)
+			}
+
+			skew.Add(module, gitVersion)
+		}
+	})
+
+	for _, repository := range skew.Repositories() {
+		if skewOnlySkewed && !repository.IsSkewed() {
+			continue
+		}
+
+		versions := repository.Versions()
+		if repository.Latest != nil {
+			fmt.Printf("repository: %s (latest: %s, versions in use: %d)\n", repository.RemoteURL, repository.Latest.Original(), len(versions))
+		} else {
+			fmt.Printf("repository: %s (versions in use: %d)\n", repository.RemoteURL, len(versions))
+		}
+
+		for _, usage := range versions {
+			fmt.Printf("  %s: %d file(s)\n", usage.Version, len(usage.Files))
+			if skewListModules {
+				for _, module := range usage.Modules {
+					fmt.Printf("    %s\n", module)
+				}
+			}
+		}
+	}
+
+	exitIfStopped(ctx)
+	unresolved.ExitIfAny()
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/jbrailsford/tfmodref/internal"
+	"github.com/jbrailsford/tfmodref/util"
+	"github.com/spf13/cobra"
+)
+
+var (
+	undoID   string
+	undoList bool
+)
+
+// undoCmd represents the undo command
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Reverts the changes made by an update",
+	Long: `Reverts the changes made by the most recent update run, or the run with the given id.
+
+Files which have not been modified since the update are restored exactly. Where a file has
+since been modified only the sources changed by the update are reverted, and any which no
+longer match what the update wrote are reported and left alone.`,
+	Run: executeUndo,
+}
+
+func init() {
+	rootCmd.AddCommand(undoCmd)
+
+	undoCmd.Flags().StringVar(&undoID, "id", "", "id of the update run to undo, defaults to the most recent")
+	undoCmd.Flags().BoolVar(&undoList, "list", false, "list the update runs which can be undone")
+}
+
+func executeUndo(cmd *cobra.Command, args []string) {
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
+
+	journals, err := internal.LoadJournals(journalDirectory())
+	if err != nil {
+		util.ErrorAndExit("error reading journals in %s (%s)", journalDirectory(), err.Error())
+	}
+
+	if undoList {
+		for _, journal := range journals {
+			fmt.Printf("%s (%d file(s) changed)\n", journal.ID, len(journal.Files))
+		}
+		return
+	}
+
+	if len(journals) == 0 {
+		util.ErrorAndExit("no update runs to undo")
+	}
+
+	journal := journals[len(journals)-1]
+	if undoID != "" {
+		journal = nil
+		for _, j := range journals {
+			if j.ID == undoID {
+				journal = j
+			}
+		}
+
+		if journal == nil {
+			util.ErrorAndExit("no update run with id %s", undoID)
+		}
+	}
+
+	failed := false
+	for _, file := range journal.Files {
+		skipped, err := file.Undo(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error restoring file at %s (%s)\n", file.Path, err.Error())
+			failed = true
+			continue
+		}
+
+		for _, change := range skipped {
+			fmt.Printf("skipping: %s (source has changed since update, expected %s)\n", change.Module, change.To)
+		}
+
+		fmt.Printf("restored: %s\n", file.Path)
+	}
+
+	exitIfStopped(ctx)
+
+	if failed {
+		util.ErrorAndExit("some files could not be restored, the journal %s has been kept", journal.ID)
+	}
+
+	if err := journal.Remove(); err != nil {
+		util.ErrorAndExit("error removing journal %s (%s)", journal.ID, err.Error())
+	}
+}
@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"os"
+	"time"
 
 	"github.com/Masterminds/semver"
 	"github.com/jbrailsford/tfmodref/internal"
@@ -17,6 +19,16 @@ var (
 	dryRun             bool
 	constraintStr      string
 	specifiedVersion   string
+	fixAdvisories      bool
+	requireSigned      bool
+	keyringFiles       []string
+	tagVerifier        *internal.TagVerifier
+	minAge             util.Duration
+	checkSubdirectory  bool
+	subdirFallback     bool
+	showInterfaceDiff  bool
+	checkArguments     string
+	checkRequirements  bool
 )
 
 // updateCmd represents the update command
@@ -34,18 +46,33 @@ func init() {
 	rootCmd.AddCommand(updateCmd)
 
 	updateCmd.Flags().BoolVar(&updateToLatest, "latest", false, "update to latest available version")
-	updateCmd.Flags().BoolVar(&versionUnversioned, "version-unversioned", false, "set a version (latest remote) on sources that are tracking HEAD")
+	updateCmd.Flags().BoolVar(&versionUnversioned, "version-unversioned", false, "set a version (latest remote) on sources that are tracking HEAD, a branch or a commit")
 	updateCmd.Flags().BoolVar(&allowDowngrades, "allow-downgrades", false, "allow downgrades if the current version is greater than the constraint")
-	updateCmd.Flags().BoolVar(&dryRun, "dry-run", false, "output what would change, without making any changes")
+	updateCmd.Flags().BoolVar(&dryRun, "dry-run", false, "output what would change, including changes to the terraform and provider requirements of each module, without making any changes")
 	updateCmd.Flags().StringVarP(&constraintStr, "constraint", "c", "", "semver constraint to control upgrade path, e.g., >= 1.x < 3.0.1")
 	updateCmd.Flags().StringVarP(&specifiedVersion, "version", "v", "", "update to specified version, will not check if version exists")
+	updateCmd.Flags().BoolVar(&fixAdvisories, "fix-advisories", false, "only update modules affected by an advisory, to the lowest version not affected by any")
+	updateCmd.Flags().BoolVar(&requireSigned, "require-signed", false, "only update to versions whose tag is signed by a key in the keyring")
+	updateCmd.Flags().StringSliceVar(&keyringFiles, "keyring", nil, "files of trusted keys used by --require-signed, either armored GPG public keys or SSH public keys")
+	updateCmd.Flags().Var(&minAge, "min-age", "only update to versions released at least this long ago, e.g., 7d")
+	updateCmd.Flags().BoolVar(&checkSubdirectory, "check-subdirectory", false, "skip updates to versions in which the //subdirectory of the source doesn't exist")
+	updateCmd.Flags().BoolVar(&subdirFallback, "subdirectory-fallback", false, "rather than skip them, update sources to the highest version below the chosen version in which their //subdirectory exists (implies --check-subdirectory)")
+	updateCmd.Flags().StringVar(&checkArguments, "check-arguments", "", "check the arguments of each module block against the variables of the version it's updated to, and either warn of or block updates with unknown arguments or unset required variables, one of warn or block")
+	updateCmd.Flags().BoolVar(&checkRequirements, "check-requirements", false, "skip updates to versions whose required_version or required_providers conflict with the root module's, and with --dry-run show how they change")
+	updateCmd.Flags().BoolVar(&showInterfaceDiff, "interface-diff", false, "with --dry-run, show the variables and outputs of each module changed by the update")
+	updateCmd.Flags().StringSliceVarP(&advisoryLocations, "advisories", "a", nil, "advisory files used by --fix-advisories, as local paths or http(s) URLs")
+	updateCmd.Flags().BoolVar(&openPR, "open-pr", false, "commit the updates to a branch, push it and open a pull request (or GitLab merge request) rather than changing files in place")
+	updateCmd.Flags().StringVar(&prBranch, "branch", "tfmodref/update", "branch the updates are committed to by --open-pr, replaced on every run")
+	updateCmd.Flags().StringVar(&prBase, "base", "", "branch the pull request is opened against (defaults to the current branch)")
+	updateCmd.Flags().StringVar(&prRemote, "remote", "origin", "git remote the branch is pushed to, and the pull request opened in")
+	updateCmd.Flags().StringVar(&prProvider, "pr-provider", "auto", "API used to open pull requests, one of auto, github or gitlab")
+	updateCmd.Flags().StringVar(&prGroupBy, "group-by", "single", "how updates are split into branches and pull requests by --open-pr, one of single, repository, module, directory or major (major and minor/patch updates apart)")
+	addHookFlags(updateCmd)
 }
 
 func executeUpdate(cmd *cobra.Command, args []string) {
-	paths, err := util.FindTerraformFiles(path, &tfExtensions)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error walking path at %s with extensions [%s] (%s)", path, tfExtensions.AsCommaSeparatedString(), err.Error())
-	}
+	ctx, cancel := commandContext(cmd)
+	defer cancel()
 
 	var constraint *semver.Constraints
 	if constraintStr != "" {
@@ -59,68 +86,205 @@ func executeUpdate(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	for _, path := range paths {
-		parser, errs := internal.NewHclParser(path)
-		if errs != nil {
-			fmt.Fprintf(os.Stderr, "errors occured whilst parsing file at %s:\n", path)
-			for _, e := range errs {
-				fmt.Fprintf(os.Stderr, "%s\n", e.Error())
-			}
-			continue
-		}
+	if requireSigned {
+		tagVerifier = loadKeyring()
+	}
 
-		sourcesInFile, err := parser.FindGitSources(version == nil)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error reading file at %s (%s)", path, err.Error())
-			continue
+	if fixAdvisories {
+		if version != nil || constraint != nil {
+			util.ErrorAndExit("--fix-advisories can't be combined with --version or --constraint\n")
 		}
 
-		for module, gitVersion := range sourcesInFile {
-			gitVersion := gitVersion
+		if len(advisoryLocations) == 0 {
+			util.ErrorAndExit("--fix-advisories requires at least one advisory file, set with --advisories\n")
+		}
 
-			if gitVersion.LocalVersionString() == "HEAD" && !versionUnversioned {
-				fmt.Printf("skipping: %s (unversioned module, to force versioning re-run with --version-unversioned\n", module)
-				continue
+		advisories := loadAdvisories(ctx)
+		runUpdate(ctx, true, func(gitVersion *internal.GitSource) (*semver.Version, error) {
+			if len(advisories.Match(gitVersion)) == 0 {
+				return nil, nil
 			}
 
-			var targetVersion *semver.Version
-			if version != nil {
-				targetVersion = version
-				goto update
-			} else {
-				targetVersion = gitVersion.LatestRemoteVersion
+			fixedVersion := advisories.MinimalFixedVersion(gitVersion)
+			if fixedVersion == nil {
+				return nil, errors.New("no version unaffected by advisories is available")
 			}
 
-			if constraint != nil {
-				if matchedVersion := gitVersion.FindLatestTagForConstraint(constraint); matchedVersion != nil {
-					targetVersion = matchedVersion
-				}
+			return fixedVersion, nil
+		})
+
+		return
+	}
+
+	runUpdate(ctx, version == nil, func(gitVersion *internal.GitSource) (*semver.Version, error) {
+		if version != nil {
+			return version, nil
+		}
+
+		if constraint != nil {
+			if matchedVersion := gitVersion.FindLatestTagForConstraint(constraint); matchedVersion != nil {
+				return matchedVersion, nil
 			}
 
-		update:
-			if gitVersion.IsVersion(targetVersion) {
+			return nil, errors.New("no remote version matches the constraint")
+		}
+
+		return gitVersion.LatestRemoteVersion, nil
+	})
+}
+
+// updatePolicy returns the policy every update must satisfy, as set by the update flags.
+func updatePolicy() internal.Policy {
+	return internal.Policy{
+		AllowDowngrades:    allowDowngrades,
+		VersionUnversioned: versionUnversioned,
+		MinAge:             time.Duration(minAge),
+		Verifier:           tagVerifier,
+
+		CheckSubdirectory:    checkSubdirectory || subdirFallback,
+		SubdirectoryFallback: subdirFallback,
+		CheckArguments:       checkArguments != "",
+		BlockOnArguments:     checkArguments == "block",
+		CheckRequirements:    checkRequirements,
+	}
+}
+
+// runUpdate updates every source in the file/folder tree to the version returned by resolve,
+// subject to the update policy and honouring --dry-run, and records any changes made in a
+// journal so they can be undone. Files are saved once every file has been planned, running any
+// hooks around them. With --open-pr the changes are committed to a branch and opened as a pull
+// request instead.
+func runUpdate(ctx context.Context, includeRemote bool, resolve internal.Resolver) {
+	journal := internal.NewJournal(journalDirectory())
+	policy := updatePolicy()
+
+	if checkArguments != "" && checkArguments != "warn" && checkArguments != "block" {
+		util.ErrorAndExit("--check-arguments %s is not one of warn or block\n", checkArguments)
+	}
+
+	if showInterfaceDiff && !dryRun {
+		util.ErrorAndExit("--interface-diff can only be used with --dry-run\n")
+	}
+
+	if openPR && hasHooks() {
+		util.ErrorAndExit("hooks can't be combined with --open-pr, as files aren't changed in place\n")
+	}
+
+	var unresolved unresolvedSources
+	var planned []*internal.Change
+	var pending []pendingFile
+	parsers := make(map[string]*internal.HclParser)
+	scanSources(ctx, includeRemote, func(path string, parser *internal.HclParser, sourcesInFile map[string]internal.GitSource) {
+		var changes []internal.JournalChange
+		for module, gitVersion := range sourcesInFile {
+			gitVersion := gitVersion
+
+			change := policy.Plan(ctx, module, &gitVersion, resolve)
+			if change == nil {
 				continue
 			}
 
-			if gitVersion.WouldForceDowngrade(targetVersion) && !allowDowngrades {
-				fmt.Printf("skipping: %s (target version %s is less than current version %s)\n", module, targetVersion, gitVersion.LocalVersionString())
+			if !change.IsUpdate() {
+				fmt.Printf("skipping: %s (%s)\n", module, change.Skipped)
+				if change.RemoteError != nil {
+					unresolved.Add(module, change.RemoteError)
+				}
 				continue
 			}
 
+			planned = append(planned, change)
 			if dryRun {
-				fmt.Printf("would update: %s (from: %s, to: %s)\n", module, gitVersion.LocalVersionString(), targetVersion)
+				fmt.Printf("would update: %s (from: %s, to: %s)\n", module, gitVersion.LocalVersionString(), change.Target)
+				printWarnings(change)
+				// Unversioned sources have no requirements to compare the target's against.
+				if !gitVersion.IsUnversioned() {
+					printRequirementChanges(ctx, &gitVersion, change.Target)
+				}
+				if showInterfaceDiff {
+					printInterfaceChanges(ctx, &gitVersion, change.Target)
+				}
 				continue
 			}
 
-			fmt.Printf("updating: %s (from: %s, to: %s)\n", module, gitVersion.LocalVersionString(), targetVersion)
-			gitVersion.SetSourceVersion(targetVersion)
+			fmt.Printf("updating: %s (from: %s, to: %s)\n", module, gitVersion.LocalVersionString(), change.Target)
+			printWarnings(change)
+			from := gitVersion.HCLSafeSourceURL()
+			gitVersion.SetSourceVersion(change.Target)
 			parser.UpdateBlockSource(&gitVersion)
+			changes = append(changes, internal.JournalChange{Module: module, From: from, To: gitVersion.HCLSafeSourceURL()})
 		}
 
-		if !dryRun {
-			if err := parser.Save(); err != nil {
-				fmt.Fprintf(os.Stderr, "error saving file at %s (%s)", path, err.Error())
+		if len(changes) > 0 && ctx.Err() == nil {
+			if openPR {
+				parsers[path] = parser
+			} else {
+				pending = append(pending, pendingFile{path: path, parser: parser, changes: changes})
 			}
 		}
+	})
+
+	if openPR && len(planned) > 0 && ctx.Err() == nil {
+		openPullRequests(ctx, parsers, planned)
+	} else if !dryRun {
+		saveUpdates(ctx, journal, pending, planned)
+	}
+
+	if len(journal.Files) > 0 {
+		fmt.Printf("changes recorded, to revert them run: tfmodref undo --id %s\n", journal.ID)
+	}
+
+	exitIfStopped(ctx)
+	unresolved.ExitIfAny()
+}
+
+// printWarnings prints the warnings about a planned change.
+func printWarnings(change *internal.Change) {
+	for _, warning := range change.Warnings {
+		fmt.Printf("  warning: %s\n", warning)
+	}
+}
+
+// printInterfaceChanges prints the changes to the variables and outputs of the module a source
+// refers to between its local version and the target version.
+func printInterfaceChanges(ctx context.Context, gitVersion *internal.GitSource, target *semver.Version) {
+	changes, err := gitVersion.InterfaceChanges(ctx, target)
+	if err != nil {
+		fmt.Printf("  could not compare variables and outputs (%s)\n", err.Error())
+		return
+	}
+
+	for _, change := range changes {
+		fmt.Printf("  %s\n", change.String())
+	}
+}
+
+// printRequirementChanges prints the changes to the terraform and provider requirements of the
+// module a source refers to between its local version and the target version.
+func printRequirementChanges(ctx context.Context, gitVersion *internal.GitSource, target *semver.Version) {
+	changes, err := gitVersion.RequirementChanges(ctx, target)
+	if err != nil {
+		fmt.Printf("  could not compare requirements (%s)\n", err.Error())
+		return
+	}
+
+	for _, change := range changes {
+		fmt.Printf("  %s\n", change)
+	}
+}
+
+// loadKeyring loads the keys in every file given by --keyring, exiting if there are none or
+// they can't be loaded.
+func loadKeyring() *internal.TagVerifier {
+	if len(keyringFiles) == 0 {
+		util.ErrorAndExit("--require-signed requires at least one keyring file, set with --keyring\n")
+	}
+
+	verifier := internal.NewTagVerifier()
+	for _, keyringFile := range keyringFiles {
+		if err := verifier.LoadKeyring(keyringFile); err != nil {
+			util.ErrorAndExit("could not load keyring %s (%s)\n", keyringFile, err.Error())
+		}
 	}
+
+	return verifier
 }
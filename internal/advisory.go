@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// severities ranks the severities an advisory may have, lowest first.
+var severities = map[string]int{
+	"low":      1,
+	"medium":   2,
+	"moderate": 2,
+	"high":     3,
+	"critical": 4,
+}
+
+// Advisory describes a range of versions of a module repository which are known to be
+// vulnerable, along with the first version in which the vulnerability is fixed, if any.
+type Advisory struct {
+	ID          string `json:"id"`
+	Repository  string `json:"repository"`
+	Affected    string `json:"affected"`
+	Fixed       string `json:"fixed,omitempty"`
+	Severity    string `json:"severity"`
+	Description string `json:"description"`
+	remoteURL   *url.URL
+	affected    *semver.Constraints
+	fixed       *semver.Version
+}
+
+// AdvisoryDatabase holds the advisories loaded from one or more advisory files.
+type AdvisoryDatabase struct {
+	Advisories []Advisory
+}
+
+// advisoryFile is the format of an advisory file.
+type advisoryFile struct {
+	Advisories []Advisory `json:"advisories"`
+}
+
+// NewAdvisoryDatabase creates an empty AdvisoryDatabase.
+func NewAdvisoryDatabase() *AdvisoryDatabase {
+	return &AdvisoryDatabase{}
+}
+
+// Load reads the advisory file at the given location, which may be a local path or an http(s)
+// URL, and adds its advisories to the database. Advisories which can't be parsed fail the load,
+// rather than being skipped, so that vulnerable versions are never silently missed.
+func (db *AdvisoryDatabase) Load(ctx context.Context, client *http.Client, location string) error {
+	var raw []byte
+	var err error
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		raw, err = fetchAdvisoryFile(ctx, client, location)
+	} else {
+		raw, err = ioutil.ReadFile(filepath.Clean(location))
+		if err != nil {
+			err = Permanent(err)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var file advisoryFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return Permanent(fmt.Errorf("invalid advisory file %s (%s)", location, err.Error()))
+	}
+
+	for i := range file.Advisories {
+		if err := file.Advisories[i].parse(); err != nil {
+			return Permanent(fmt.Errorf("invalid advisory %d in %s (%s)", i+1, location, err.Error()))
+		}
+	}
+
+	db.Advisories = append(db.Advisories, file.Advisories...)
+
+	return nil
+}
+
+func fetchAdvisoryFile(ctx context.Context, client *http.Client, location string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, Permanent(err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("unexpected response from %s (%s)", resp.Request.URL.Redacted(), resp.Status)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, Permanent(fmt.Errorf("unexpected response from %s (%s)", resp.Request.URL.Redacted(), resp.Status))
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (a *Advisory) parse() error {
+	var err error
+	if a.remoteURL, err = ParseRemoteURL(a.Repository); err != nil {
+		return err
+	}
+
+	if a.affected, err = semver.NewConstraint(a.Affected); err != nil {
+		return fmt.Errorf("affected range %q is invalid (%s)", a.Affected, err.Error())
+	}
+
+	if a.Fixed != "" {
+		if a.fixed, err = semver.NewVersion(a.Fixed); err != nil {
+			return fmt.Errorf("fixed version %q is invalid (%s)", a.Fixed, err.Error())
+		}
+	}
+
+	a.Severity = strings.ToLower(a.Severity)
+	if _, ok := severities[a.Severity]; !ok {
+		return fmt.Errorf("severity %q is not one of low, medium, high or critical", a.Severity)
+	}
+
+	return nil
+}
+
+// Affects returns true if the given version of the repository is within the affected range.
+func (a *Advisory) Affects(remoteURL *url.URL, version *semver.Version) bool {
+	return version != nil && SameRepository(a.remoteURL, remoteURL) && a.affected.Check(version)
+}
+
+// FixedVersion returns the first version in which the advisory is fixed, or nil if it has not been.
+func (a *Advisory) FixedVersion() *semver.Version {
+	return a.fixed
+}
+
+// AtLeast returns true if the advisory's severity is the same as, or higher than, the given severity.
+func (a *Advisory) AtLeast(severity string) bool {
+	return severities[a.Severity] >= severities[strings.ToLower(severity)]
+}
+
+// IsSeverity returns true if the given severity is recognised.
+func IsSeverity(severity string) bool {
+	_, ok := severities[strings.ToLower(severity)]
+	return ok
+}
+
+// Match returns the advisories affecting the version of the given source, most severe first.
+// Sources tracking HEAD have no version to match against, so are never matched.
+func (db *AdvisoryDatabase) Match(source *GitSource) []Advisory {
+	var matched []Advisory
+	for _, advisory := range db.Advisories {
+		if !source.LocalVersionIsMain && advisory.Affects(source.RemoteURL, source.localVersion) {
+			matched = append(matched, advisory)
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return severities[matched[i].Severity] > severities[matched[j].Severity]
+	})
+
+	return matched
+}
+
+// MinimalFixedVersion returns the lowest version above the source's current version which is not
+// affected by any advisory. Where the remote versions of the source are known the version is chosen
+// from them, otherwise it is the highest fixed version of the advisories currently affecting it.
+// Nil is returned if no such version exists.
+func (db *AdvisoryDatabase) MinimalFixedVersion(source *GitSource) *semver.Version {
+	matched := db.Match(source)
+	if len(matched) == 0 {
+		return nil
+	}
+
+	if len(source.RemoteVersions) > 0 {
+		for _, version := range source.RemoteVersions {
+			if version.Prerelease() != "" || !version.GreaterThan(source.localVersion) {
+				continue
+			}
+
+			if !db.affects(source.RemoteURL, version) {
+				return version
+			}
+		}
+
+		return nil
+	}
+
+	var fixed *semver.Version
+	for _, advisory := range matched {
+		if advisory.fixed == nil {
+			return nil
+		}
+
+		if fixed == nil || advisory.fixed.GreaterThan(fixed) {
+			fixed = advisory.fixed
+		}
+	}
+
+	return fixed
+}
+
+func (db *AdvisoryDatabase) affects(remoteURL *url.URL, version *semver.Version) bool {
+	for _, advisory := range db.Advisories {
+		if advisory.Affects(remoteURL, version) {
+			return true
+		}
+	}
+
+	return false
+}
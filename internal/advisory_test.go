@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func advisorySource(t *testing.T, version string, remoteVersions ...string) *GitSource {
+	remoteURL, err := url.Parse("https://github.com/terraform-aws-modules/terraform-aws-vpc.git")
+	require.NoError(t, err)
+
+	source := &GitSource{RemoteURL: remoteURL, localVersion: semver.MustParse(version)}
+	for _, remoteVersion := range remoteVersions {
+		source.RemoteVersions = append(source.RemoteVersions, semver.MustParse(remoteVersion))
+	}
+
+	sort.Sort(source.RemoteVersions)
+
+	return source
+}
+
+func TestAdvisoryDatabaseMatch(t *testing.T) {
+	advisories := NewAdvisoryDatabase()
+	require.NoError(t, advisories.Load(context.Background(), http.DefaultClient, "testdata/advisories.json"))
+	require.Len(t, advisories.Advisories, 2)
+
+	matched := advisories.Match(advisorySource(t, "v1.6.0"))
+	require.Len(t, matched, 2)
+	assert.Equal(t, "TFM-2021-002", matched[0].ID, "the most severe advisory should be listed first")
+	assert.Equal(t, "high", matched[0].Severity)
+	assert.True(t, matched[0].AtLeast("HIGH"))
+	assert.False(t, matched[1].AtLeast("high"))
+
+	assert.Len(t, advisories.Match(advisorySource(t, "v1.0.0")), 1)
+	assert.Empty(t, advisories.Match(advisorySource(t, "v3.1.0")))
+	assert.Empty(t, advisories.Match(&GitSource{RemoteURL: advisorySource(t, "v1.0.0").RemoteURL, LocalVersionIsMain: true}))
+}
+
+func TestAdvisoryDatabaseMinimalFixedVersion(t *testing.T) {
+	advisories := NewAdvisoryDatabase()
+	require.NoError(t, advisories.Load(context.Background(), http.DefaultClient, "testdata/advisories.json"))
+
+	assert.Equal(t, "v3.1.0", advisories.MinimalFixedVersion(advisorySource(t, "v1.0.0", "v1.0.0", "v1.2.0", "v2.0.0", "v3.1.0", "v3.2.0")).Original(),
+		"the lowest remote version unaffected by any advisory should be chosen")
+	assert.Equal(t, "v3.1.1", advisories.MinimalFixedVersion(advisorySource(t, "v1.6.0", "v1.6.0", "v2.0.0", "v3.2.0-rc.1", "v3.1.1")).Original(),
+		"versions affected by another advisory, and pre-releases, should be passed over")
+	assert.Nil(t, advisories.MinimalFixedVersion(advisorySource(t, "v1.6.0", "v1.6.0", "v2.0.0")), "there is no fixed remote version")
+	assert.Equal(t, "v3.1.0", advisories.MinimalFixedVersion(advisorySource(t, "v1.6.0")).Original(),
+		"without remote versions the highest fixed version of the advisories should be chosen")
+	assert.Nil(t, advisories.MinimalFixedVersion(advisorySource(t, "v3.1.0", "v4.0.0")), "an unaffected source needs no fix")
+}
+
+func TestAdvisoryDatabaseLoadFromURL(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		switch r.URL.Path {
+		case "/advisories.json":
+			fmt.Fprint(w, `{"advisories": [{"id": "A-1", "repository": "gitlab.com/org/dns", "affected": "< 1.0.0", "severity": "low"}]}`)
+		case "/invalid.json":
+			fmt.Fprint(w, `{"advisories": [{"id": "A-2", "repository": "gitlab.com/org/dns", "affected": "< 1.0.0", "severity": "urgent"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	advisories := NewAdvisoryDatabase()
+	require.NoError(t, advisories.Load(context.Background(), server.Client(), server.URL+"/advisories.json"))
+	require.Len(t, advisories.Advisories, 1)
+	assert.Nil(t, advisories.Advisories[0].FixedVersion())
+
+	var slept []time.Duration
+	err := testRetryPolicy(&slept).Do(context.Background(), func(ctx context.Context) error {
+		return advisories.Load(ctx, server.Client(), server.URL+"/invalid.json")
+	})
+	assert.Error(t, err)
+	assert.Len(t, advisories.Advisories, 1, "an invalid file should not add any advisories")
+
+	attempts = 0
+	err = testRetryPolicy(&slept).Do(context.Background(), func(ctx context.Context) error {
+		return advisories.Load(ctx, server.Client(), server.URL+"/missing.json")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts, "a missing file should not be retried")
+}
@@ -0,0 +1,438 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage"
+)
+
+// LocalRepository is the git repository containing the files being updated, used to commit
+// updates to a branch so they can be pushed and reviewed rather than edited in place.
+type LocalRepository struct {
+	repo *git.Repository
+	root string
+}
+
+// OpenLocalRepository opens the git repository containing the given file or directory.
+func OpenLocalRepository(path string) (*LocalRepository, error) {
+	repo, err := git.PlainOpenWithOptions(path, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, fmt.Errorf("%s is not within a git repository (%s)", path, err.Error())
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalRepository{repo: repo, root: worktree.Filesystem.Root()}, nil
+}
+
+// Root returns the root directory of the repository's worktree.
+func (r *LocalRepository) Root() string {
+	return r.root
+}
+
+// CurrentBranch returns the name of the branch checked out, or an error if HEAD is detached.
+func (r *LocalRepository) CurrentBranch() (string, error) {
+	head, err := r.repo.Head()
+	if err != nil {
+		return "", err
+	}
+
+	if !head.Name().IsBranch() {
+		return "", fmt.Errorf("HEAD is detached, not on a branch")
+	}
+
+	return head.Name().Short(), nil
+}
+
+// RemoteURL returns the URL of the named remote.
+func (r *LocalRepository) RemoteURL(name string) (*url.URL, error) {
+	remote, err := r.repo.Remote(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not find remote %s (%s)", name, err.Error())
+	}
+
+	return ParseRemoteURL(remote.Config().URLs[0])
+}
+
+// Commit creates, or resets, the branch to a single commit on top of HEAD which replaces the
+// content of the given files, keyed by path. Neither the worktree nor the index are touched,
+// so any number of branches may be committed from the same checkout. As the content is built
+// from the files in the worktree, it's refused if any of them differ from HEAD, rather than
+// committing uncommitted edits along with the updates.
+func (r *LocalRepository) Commit(branch string, message string, files map[string][]byte) error {
+	head, err := r.repo.Head()
+	if err != nil {
+		return err
+	}
+
+	if head.Name() == plumbing.NewBranchReferenceName(branch) {
+		return fmt.Errorf("branch %s is checked out, updates can't be committed to it", branch)
+	}
+
+	parent, err := r.repo.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+
+	base, err := parent.Tree()
+	if err != nil {
+		return err
+	}
+
+	changed := make(map[string][]byte)
+	for path, content := range files {
+		relative, err := r.relativePath(path)
+		if err != nil {
+			return err
+		}
+
+		if err := r.checkCommitted(base, path, relative); err != nil {
+			return err
+		}
+
+		changed[relative] = content
+	}
+
+	treeHash, err := writeTree(r.repo.Storer, base, changed)
+	if err != nil {
+		return err
+	}
+
+	signature := r.signature()
+	commit := &object.Commit{
+		Author:       signature,
+		Committer:    signature,
+		Message:      message,
+		TreeHash:     treeHash,
+		ParentHashes: []plumbing.Hash{parent.Hash},
+	}
+
+	commitHash, err := storeObject(r.repo.Storer, commit)
+	if err != nil {
+		return err
+	}
+
+	return r.repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName(branch), commitHash))
+}
+
+// Push force pushes the branch to the named remote, replacing any update pushed by a
+// previous run.
+func (r *LocalRepository) Push(ctx context.Context, remote string, branch string, auth transport.AuthMethod) error {
+	ref := plumbing.NewBranchReferenceName(branch)
+	err := r.repo.PushContext(ctx, &git.PushOptions{
+		RemoteName: remote,
+		RefSpecs:   []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", ref, ref))},
+		Auth:       auth,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+
+	return nil
+}
+
+// ChangedSince returns the absolute paths of the files which differ between the given revision,
+// e.g., a branch, tag or commit, and the worktree, as listed by git diff --name-only. That is
+// files changed in commits since the revision, and any changes staged or made in the worktree.
+// Deleted and untracked files are not included.
+func (r *LocalRepository) ChangedSince(revision string) ([]string, error) {
+	hash, err := r.repo.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve revision %s (%s)", revision, err.Error())
+	}
+
+	from, err := commitTree(r.repo, *hash)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := r.repo.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := commitTree(r.repo, head.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTree(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]bool)
+	for _, change := range changes {
+		if change.To.Name != "" {
+			changed[change.To.Name] = true
+		}
+	}
+
+	worktree, err := r.repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := worktree.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	for name, fileStatus := range status {
+		switch {
+		case fileStatus.Worktree == git.Untracked:
+			continue
+		case fileStatus.Worktree == git.Deleted || fileStatus.Staging == git.Deleted:
+			delete(changed, name)
+		case fileStatus.Worktree != git.Unmodified || fileStatus.Staging != git.Unmodified:
+			changed[name] = true
+		}
+	}
+
+	var paths []string
+	for name := range changed {
+		paths = append(paths, filepath.Join(r.root, filepath.FromSlash(name)))
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+// StagedFiles returns the content staged in the index of each file which differs from HEAD,
+// keyed by absolute path, as it would be committed rather than as it is in the worktree. Every
+// file in the index is returned if nothing has been committed yet. Deleted files, submodules and
+// files with unresolved merge conflicts are not included.
+func (r *LocalRepository) StagedFiles() (map[string][]byte, error) {
+	index, err := r.repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+
+	var head *object.Tree
+	if ref, err := r.repo.Head(); err == nil {
+		if head, err = commitTree(r.repo, ref.Hash()); err != nil {
+			return nil, err
+		}
+	} else if err != plumbing.ErrReferenceNotFound {
+		return nil, err
+	}
+
+	staged := make(map[string][]byte)
+	for _, entry := range index.Entries {
+		if entry.Stage != 0 || entry.Mode == filemode.Submodule {
+			continue
+		}
+
+		if head != nil {
+			if committed, err := head.FindEntry(entry.Name); err == nil && committed.Hash == entry.Hash {
+				continue
+			}
+		}
+
+		blob, err := r.repo.BlobObject(entry.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("could not read staged %s (%s)", entry.Name, err.Error())
+		}
+
+		content, err := readBlob(blob)
+		if err != nil {
+			return nil, fmt.Errorf("could not read staged %s (%s)", entry.Name, err.Error())
+		}
+
+		staged[filepath.Join(r.root, filepath.FromSlash(entry.Name))] = content
+	}
+
+	return staged, nil
+}
+
+func readBlob(blob *object.Blob) ([]byte, error) {
+	reader, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+func commitTree(repo *git.Repository, hash plumbing.Hash) (*object.Tree, error) {
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return commit.Tree()
+}
+
+// checkCommitted returns an error if the file in the worktree differs from its content in the
+// given tree, or isn't in it at all.
+func (r *LocalRepository) checkCommitted(tree *object.Tree, path string, relative string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	entry, err := tree.FindEntry(relative)
+	if err == object.ErrEntryNotFound || err == object.ErrDirectoryNotFound {
+		return fmt.Errorf("%s isn't committed, commit it before opening a pull request", relative)
+	} else if err != nil {
+		return err
+	}
+
+	if entry.Hash != plumbing.ComputeHash(plumbing.BlobObject, content) {
+		return fmt.Errorf("%s has uncommitted changes, commit or stash them before opening a pull request", relative)
+	}
+
+	return nil
+}
+
+// relativePath returns the slash separated path of a file relative to the repository root.
+func (r *LocalRepository) relativePath(path string) (string, error) {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	relative, err := filepath.Rel(r.root, absolute)
+	if err != nil || strings.HasPrefix(relative, "..") {
+		return "", fmt.Errorf("%s is not within the repository at %s", path, r.root)
+	}
+
+	return filepath.ToSlash(relative), nil
+}
+
+// signature returns the author of commits, taken from the git config when it is set.
+func (r *LocalRepository) signature() object.Signature {
+	signature := object.Signature{Name: "tfmodref", Email: "tfmodref@localhost", When: time.Now()}
+	if cfg, err := r.repo.ConfigScoped(config.GlobalScope); err == nil {
+		if cfg.User.Name != "" {
+			signature.Name = cfg.User.Name
+		}
+
+		if cfg.User.Email != "" {
+			signature.Email = cfg.User.Email
+		}
+	}
+
+	return signature
+}
+
+// writeTree stores a copy of the base tree, which may be nil, with the given files, keyed by
+// slash separated path, replaced or added, and returns its hash.
+func writeTree(storer storage.Storer, base *object.Tree, files map[string][]byte) (plumbing.Hash, error) {
+	entries := make(map[string]object.TreeEntry)
+	if base != nil {
+		for _, entry := range base.Entries {
+			entries[entry.Name] = entry
+		}
+	}
+
+	subtrees := make(map[string]map[string][]byte)
+	for path, content := range files {
+		name, rest := path, ""
+		if i := strings.Index(path, "/"); i >= 0 {
+			name, rest = path[:i], path[i+1:]
+		}
+
+		if rest != "" {
+			if subtrees[name] == nil {
+				subtrees[name] = make(map[string][]byte)
+			}
+			subtrees[name][rest] = content
+			continue
+		}
+
+		hash, err := storeObject(storer, blob(content))
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		mode := filemode.Regular
+		if existing, ok := entries[name]; ok && existing.Mode == filemode.Executable {
+			mode = existing.Mode
+		}
+
+		entries[name] = object.TreeEntry{Name: name, Mode: mode, Hash: hash}
+	}
+
+	for name, subfiles := range subtrees {
+		var subtree *object.Tree
+		if existing, ok := entries[name]; ok && existing.Mode == filemode.Dir {
+			var err error
+			if subtree, err = object.GetTree(storer, existing.Hash); err != nil {
+				return plumbing.ZeroHash, err
+			}
+		}
+
+		hash, err := writeTree(storer, subtree, subfiles)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		entries[name] = object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: hash}
+	}
+
+	tree := &object.Tree{}
+	for _, entry := range entries {
+		tree.Entries = append(tree.Entries, entry)
+	}
+
+	// Git orders entries by name, comparing directories as if their name ended with a slash.
+	sortName := func(entry object.TreeEntry) string {
+		if entry.Mode == filemode.Dir {
+			return entry.Name + "/"
+		}
+		return entry.Name
+	}
+	sort.Slice(tree.Entries, func(i, j int) bool {
+		return sortName(tree.Entries[i]) < sortName(tree.Entries[j])
+	})
+
+	return storeObject(storer, tree)
+}
+
+// encodable is an object which can be written to the object store, i.e., a blob, tree or commit.
+type encodable interface {
+	Encode(plumbing.EncodedObject) error
+}
+
+type blob []byte
+
+func (b blob) Encode(obj plumbing.EncodedObject) error {
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+func storeObject(storer storage.Storer, object encodable) (plumbing.Hash, error) {
+	obj := storer.NewEncodedObject()
+	if err := object.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return storer.SetEncodedObject(obj)
+}
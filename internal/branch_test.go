@@ -0,0 +1,178 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLocalRepository creates a repository with a committed module file, and a bare remote
+// named origin, returning the path of the module file and the remote.
+func testLocalRepository(t *testing.T) (string, *git.Repository) {
+	dir := t.TempDir()
+	remoteDir := t.TempDir()
+
+	remote, err := git.PlainInit(remoteDir, true)
+	require.NoError(t, err)
+
+	repo, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+	_, err = repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{"file://" + remoteDir}})
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "modules", "network", "main.tf")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(serverFixture), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("modules\n"), 0600))
+
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+	_, err = worktree.Add(".")
+	require.NoError(t, err)
+	_, err = worktree.Commit("initial", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+
+	return path, remote
+}
+
+func TestLocalRepositoryCommitAndPush(t *testing.T) {
+	path, remote := testLocalRepository(t)
+
+	repo, err := OpenLocalRepository(filepath.Dir(path))
+	require.NoError(t, err)
+
+	branch, err := repo.CurrentBranch()
+	require.NoError(t, err)
+	assert.Equal(t, "master", branch)
+
+	remoteURL, err := repo.RemoteURL("origin")
+	require.NoError(t, err)
+	assert.Equal(t, "file", remoteURL.Scheme)
+
+	updated := []byte("# updated\n" + serverFixture)
+	require.NoError(t, repo.Commit("tfmodref/update", "Update modules", map[string][]byte{path: updated}))
+	require.NoError(t, repo.Push(context.Background(), "origin", "tfmodref/update", nil))
+
+	ref, err := remote.Reference(plumbing.NewBranchReferenceName("tfmodref/update"), true)
+	require.NoError(t, err)
+	commit, err := remote.CommitObject(ref.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, "Update modules", commit.Message)
+	assert.Len(t, commit.ParentHashes, 1)
+
+	file, err := commit.File("modules/network/main.tf")
+	require.NoError(t, err)
+	content, err := file.Contents()
+	require.NoError(t, err)
+	assert.Equal(t, string(updated), content)
+
+	_, err = commit.File("README.md")
+	assert.NoError(t, err, "files which weren't updated should be kept")
+
+	worktreeContent, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, serverFixture, string(worktreeContent), "the worktree should not be changed")
+
+	// Rerunning replaces the branch, rather than building on the previous run.
+	require.NoError(t, repo.Commit("tfmodref/update", "Update modules again", map[string][]byte{path: updated}))
+	require.NoError(t, repo.Push(context.Background(), "origin", "tfmodref/update", nil))
+	ref, err = remote.Reference(plumbing.NewBranchReferenceName("tfmodref/update"), true)
+	require.NoError(t, err)
+	rerun, err := remote.CommitObject(ref.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, commit.ParentHashes, rerun.ParentHashes)
+
+	assert.Error(t, repo.Commit("master", "Update modules", map[string][]byte{path: updated}), "the checked out branch should not be committed to")
+	assert.Error(t, repo.Commit("tfmodref/update", "Update modules", map[string][]byte{"/elsewhere/main.tf": updated}))
+}
+
+func TestLocalRepositoryCommitRefusesUncommittedChanges(t *testing.T) {
+	path, _ := testLocalRepository(t)
+
+	repo, err := OpenLocalRepository(filepath.Dir(path))
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(serverFixture+"# local edit\n"), 0600))
+	updated := []byte("# updated\n" + serverFixture)
+	err = repo.Commit("tfmodref/update", "Update modules", map[string][]byte{path: updated})
+	require.Error(t, err, "uncommitted edits should not be committed along with the updates")
+	assert.Contains(t, err.Error(), "uncommitted changes")
+
+	untracked := filepath.Join(filepath.Dir(path), "extra.tf")
+	require.NoError(t, os.WriteFile(untracked, []byte(serverFixture), 0600))
+	assert.Error(t, repo.Commit("tfmodref/update", "Update modules", map[string][]byte{untracked: updated}))
+
+	_, err = repo.repo.Reference(plumbing.NewBranchReferenceName("tfmodref/update"), true)
+	assert.Error(t, err, "no branch should be created")
+}
+
+func TestLocalRepositoryChangedSince(t *testing.T) {
+	path, _ := testLocalRepository(t)
+	root := filepath.Dir(filepath.Dir(filepath.Dir(path)))
+
+	repo, err := OpenLocalRepository(root)
+	require.NoError(t, err)
+
+	changed, err := repo.ChangedSince("HEAD")
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+
+	require.NoError(t, os.WriteFile(path, []byte("# edited\n"+serverFixture), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "untracked.tf"), []byte(serverFixture), 0600))
+	require.NoError(t, os.Remove(filepath.Join(root, "README.md")))
+
+	changed, err = repo.ChangedSince("HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, []string{path}, changed, "only modified files should be listed, not untracked or deleted ones")
+
+	_, err = repo.ChangedSince("no-such-branch")
+	assert.Error(t, err)
+}
+
+func TestLocalRepositoryStagedFiles(t *testing.T) {
+	path, _ := testLocalRepository(t)
+	root := filepath.Dir(filepath.Dir(filepath.Dir(path)))
+
+	repo, err := OpenLocalRepository(root)
+	require.NoError(t, err)
+
+	staged, err := repo.StagedFiles()
+	require.NoError(t, err)
+	assert.Empty(t, staged)
+
+	stagedContent := []byte("# staged\n" + serverFixture)
+	require.NoError(t, os.WriteFile(path, stagedContent, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "new.tf"), []byte(serverFixture), 0600))
+
+	gitRepo, err := git.PlainOpen(root)
+	require.NoError(t, err)
+	worktree, err := gitRepo.Worktree()
+	require.NoError(t, err)
+	_, err = worktree.Add("modules/network/main.tf")
+	require.NoError(t, err)
+	_, err = worktree.Add("new.tf")
+	require.NoError(t, err)
+	_, err = worktree.Remove("README.md")
+	require.NoError(t, err)
+
+	// Unstaged edits made after staging shouldn't be seen.
+	require.NoError(t, os.WriteFile(path, []byte("# unstaged\n"), 0600))
+
+	staged, err = repo.StagedFiles()
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{
+		path:                          stagedContent,
+		filepath.Join(root, "new.tf"): []byte(serverFixture),
+	}, staged, "the staged content of added and modified files should be returned, not deleted ones")
+}
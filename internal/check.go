@@ -0,0 +1,108 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Masterminds/semver"
+)
+
+// Checks holds the rules the module sources in a file must satisfy, such as before they are
+// committed. Sources must always be pinned to a version which hasn't been yanked, and when set,
+// satisfy the constraint and be unaffected by the advisories.
+type Checks struct {
+	Constraint    *semver.Constraints
+	Advisories    *AdvisoryDatabase
+	MinSeverity   string
+	AllowUnpinned bool
+}
+
+// Finding is a single failed check of a module source, at the line of its source attribute.
+type Finding struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Module  string `json:"module"`
+	Message string `json:"message"`
+}
+
+// String formats the finding as file:line: message, as compilers and linters do.
+func (f Finding) String() string {
+	return fmt.Sprintf("%s:%d: %s (module: %s)", f.File, f.Line, f.Message, f.Module)
+}
+
+// Check returns the findings for the named source, none if it passes every check.
+func (c Checks) Check(module string, source *GitSource) []Finding {
+	var findings []Finding
+	fail := func(message string, params ...interface{}) {
+		findings = append(findings, Finding{
+			File:    source.FilePath,
+			Line:    source.Line,
+			Module:  module,
+			Message: fmt.Sprintf(message, params...),
+		})
+	}
+
+	if !source.IsEvaluated() {
+		fail("%s", source.UpdateError.Error())
+		return findings
+	}
+
+	if !source.IsResolved() {
+		fail("could not retrieve remote versions (%s)", source.RemoteError.Error())
+	}
+
+	if source.LocalVersionIsMain {
+		if !c.AllowUnpinned {
+			fail("source is not pinned to a version, set a ref")
+		}
+
+		return findings
+	}
+
+	if source.localVersion == nil {
+		fail("ref %s is not a semantic version", source.SourceURL.Query().Get("ref"))
+		return findings
+	}
+
+	version := source.localVersion.Original()
+	if source.IsYanked() {
+		fail("version %s has been yanked", version)
+	}
+
+	if c.Constraint != nil && !c.Constraint.Check(source.localVersion) {
+		fail("version %s does not satisfy the version constraint", version)
+	}
+
+	if c.Advisories != nil {
+		for _, advisory := range c.Advisories.Match(source) {
+			if c.MinSeverity != "" && !advisory.AtLeast(c.MinSeverity) {
+				continue
+			}
+
+			fixed := "none"
+			if advisory.FixedVersion() != nil {
+				fixed = advisory.FixedVersion().Original()
+			}
+
+			fail("version %s is affected by advisory %s (severity: %s, fixed in: %s)", version, advisory.ID, advisory.Severity, fixed)
+		}
+	}
+
+	return findings
+}
+
+// SortFindings orders findings by file, then line, then module, so they are reported in the
+// order they appear.
+func SortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+
+		if findings[i].Line != findings[j].Line {
+			return findings[i].Line < findings[j].Line
+		}
+
+		return findings[i].Module < findings[j].Module
+	})
+}
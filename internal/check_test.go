@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const checkFixture = `module "pinned" {
+  source = "github.com/terraform-aws-modules/terraform-aws-vpc?ref=v1.6.0"
+}
+
+module "unpinned" {
+  source = "github.com/terraform-aws-modules/terraform-aws-vpc"
+}
+
+module "branch" {
+  source = "github.com/terraform-aws-modules/terraform-aws-vpc?ref=main"
+}
+`
+
+func TestChecks(t *testing.T) {
+	parser, errs := NewHclParserFromBytes("/repo/main.tf", []byte(checkFixture))
+	require.Nil(t, errs)
+	sources, err := parser.FindGitSources(context.Background(), false)
+	require.NoError(t, err)
+	require.Len(t, sources, 3)
+
+	check := func(checks Checks) []Finding {
+		var findings []Finding
+		for module, source := range sources {
+			source := source
+			findings = append(findings, checks.Check(module, &source)...)
+		}
+		SortFindings(findings)
+
+		return findings
+	}
+
+	assert.Equal(t, []Finding{
+		{File: "/repo/main.tf", Line: 6, Module: "/repo/main.tf [unpinned]", Message: "source is not pinned to a version, set a ref"},
+		{File: "/repo/main.tf", Line: 10, Module: "/repo/main.tf [branch]", Message: "ref main is not a semantic version"},
+	}, check(Checks{}))
+
+	assert.Len(t, check(Checks{AllowUnpinned: true}), 1)
+
+	advisories := NewAdvisoryDatabase()
+	require.NoError(t, advisories.Load(context.Background(), http.DefaultClient, "testdata/advisories.json"))
+	constraint, err := semver.NewConstraint(">= 2.0.0")
+	require.NoError(t, err)
+	findings := check(Checks{AllowUnpinned: true, Constraint: constraint, Advisories: advisories, MinSeverity: "high"})
+	require.Len(t, findings, 3)
+	assert.Equal(t, "/repo/main.tf:2: version v1.6.0 does not satisfy the version constraint (module: /repo/main.tf [pinned])", findings[0].String())
+	assert.Equal(t, "version v1.6.0 is affected by advisory TFM-2021-002 (severity: high, fixed in: v3.1.0)", findings[1].Message)
+	assert.Equal(t, 10, findings[2].Line)
+}
+
+func TestChecksYankedAndUnresolved(t *testing.T) {
+	source := advisorySource(t, "v1.6.0")
+	source.FilePath, source.Line = "main.tf", 3
+	source.yankedTags = semver.Collection{semver.MustParse("v1.6.0")}
+	source.RemoteError = errors.New("rate limited")
+
+	findings := Checks{}.Check("main.tf [vpc]", source)
+	require.Len(t, findings, 2)
+	assert.Equal(t, "could not retrieve remote versions (rate limited)", findings[0].Message)
+	assert.Equal(t, "version v1.6.0 has been yanked", findings[1].Message)
+}
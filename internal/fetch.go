@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// fetchTag shallowly fetches the given tag, along with the commit it points at, from the
+// repository into memory, so that the tag and commit objects can be inspected without
+// cloning the repository.
+func fetchTag(ctx context.Context, repositoryURL string, tag string) (*git.Repository, error) {
+	return fetchTags(ctx, repositoryURL, fmt.Sprintf("+refs/tags/%s:refs/tags/%s", tag, tag))
+}
+
+// fetchTags shallowly fetches the tags matching the given ref specs, e.g., +refs/tags/v1.0.0:refs/tags/v1.0.0,
+// along with the commits they point at, from the repository into memory.
+func fetchTags(ctx context.Context, repositoryURL string, refSpecs ...string) (*git.Repository, error) {
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	remote, err := repo.CreateRemote(&config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{repositoryURL},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make([]config.RefSpec, len(refSpecs))
+	for i, refSpec := range refSpecs {
+		specs[i] = config.RefSpec(refSpec)
+	}
+
+	err = remote.FetchContext(ctx, &git.FetchOptions{
+		RefSpecs: specs,
+		Depth:    1,
+		Tags:     git.NoTags,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		if isPermanentGitError(err) {
+			return nil, Permanent(err)
+		}
+
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// tagObjects returns the annotated tag object of the given tag, which is nil for lightweight
+// tags, and the commit it points at.
+func tagObjects(repo *git.Repository, tag string) (*object.Tag, *object.Commit, error) {
+	ref, err := repo.Tag(tag)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tagObject, err := repo.TagObject(ref.Hash())
+	switch err {
+	case nil:
+		commit, err := tagObject.Commit()
+		return tagObject, commit, err
+	case plumbing.ErrObjectNotFound:
+		commit, err := repo.CommitObject(ref.Hash())
+		return nil, commit, err
+	default:
+		return nil, nil, err
+	}
+}
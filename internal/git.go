@@ -1,53 +1,175 @@
 package internal
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
 	"github.com/Masterminds/semver"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/storage/memory"
 )
 
+// GitTagProvider looks up tags by listing the refs advertised by the remote, in the
+// same manner as `git ls-remote`, and works with any git host.
+type GitTagProvider struct{}
+
+// Tags returns the semver tags advertised by the given remote.
+func (p *GitTagProvider) Tags(ctx context.Context, remoteURL *url.URL) (semver.Collection, error) {
+	return RemoteTags(ctx, remoteURL.String())
+}
+
 // RemoteTags returns a colelction of SemVer tags, if the tags are not in SemVer
 // format and Error is returned.
-func RemoteTags(repositoryURL string) (semver.Collection, error) {
+func RemoteTags(ctx context.Context, repositoryURL string) (semver.Collection, error) {
 	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
 		Name: "origin",
 		URLs: []string{repositoryURL},
 	})
 
-	var tags semver.Collection
-	refs, err := remote.List(&git.ListOptions{})
-
+	refs, err := remote.ListContext(ctx, &git.ListOptions{})
 	if err != nil {
+		if isPermanentGitError(err) {
+			return nil, Permanent(err)
+		}
+
 		return nil, err
 	}
 
+	var names []string
 	for _, ref := range refs {
 		if ref.Name().IsTag() {
-			version, err := semver.NewVersion(ref.Name().Short())
-			if err != nil {
-				return nil, err
-			}
+			names = append(names, ref.Name().Short())
+		}
+	}
+
+	return parseSemverTags(names)
+}
+
+// ReleaseDates returns when each of the given tags advertised by the given remote was released.
+func (p *GitTagProvider) ReleaseDates(ctx context.Context, remoteURL *url.URL, tags []string) (map[string]time.Time, error) {
+	return RemoteReleaseDates(ctx, remoteURL.String(), tags)
+}
+
+// RemoteReleaseDates returns the date each of the given tags in the repository was released, keyed
+// by tag name. This is the date of the tag for annotated tags, or of the tagged commit for lightweight
+// tags. As neither are listed in a ref advertisement the tags which the remote advertises are fetched,
+// shallowly, into memory, and tags it doesn't advertise are left out.
+func RemoteReleaseDates(ctx context.Context, repositoryURL string, tags []string) (map[string]time.Time, error) {
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{repositoryURL},
+	})
 
-			tags = append(tags, version)
+	refs, err := remote.ListContext(ctx, &git.ListOptions{})
+	if err != nil {
+		if isPermanentGitError(err) {
+			return nil, Permanent(err)
+		}
+
+		return nil, err
+	}
+
+	var refSpecs []string
+	for _, ref := range refs {
+		if ref.Name().IsTag() && containsString(tags, ref.Name().Short()) {
+			refSpecs = append(refSpecs, fmt.Sprintf("+%s:%s", ref.Name(), ref.Name()))
 		}
 	}
 
-	return tags, err
+	dates := make(map[string]time.Time)
+	if len(refSpecs) == 0 {
+		return dates, nil
+	}
+
+	repo, err := fetchTags(ctx, repositoryURL, refSpecs...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range tags {
+		tag, commit, err := tagObjects(repo, name)
+		switch {
+		case err != nil:
+			// Tags which weren't advertised, or of anything but a commit, have no release date.
+			continue
+		case tag != nil:
+			dates[name] = tag.Tagger.When
+		default:
+			dates[name] = commit.Committer.When
+		}
+	}
+
+	return dates, nil
 }
 
-type sourceCache map[string]semver.Collection
+// isPermanentGitError reports whether a git transport error would not be resolved by retrying.
+func isPermanentGitError(err error) bool {
+	return errors.Is(err, transport.ErrRepositoryNotFound) ||
+		errors.Is(err, transport.ErrAuthenticationRequired) ||
+		errors.Is(err, transport.ErrAuthorizationFailed) ||
+		errors.Is(err, transport.ErrEmptyRemoteRepository) ||
+		errors.Is(err, transport.ErrInvalidAuthMethod)
+}
 
-// SourceCache is a global cache of repo URL's and available remote versions,
-// used to reduce network calls to find verisons.
-var SourceCache sourceCache
+// remoteCache holds the results of remote lookups by repository URL, safe for concurrent use.
+// Entries expire after the TTL, if one is set, so long running processes see new tags.
+type remoteCache struct {
+	TTL     time.Duration
+	mu      sync.RWMutex
+	entries map[string]cacheEntry
+}
 
-func init() {
-	SourceCache = make(map[string]semver.Collection)
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
 }
 
+func newRemoteCache() *remoteCache {
+	return &remoteCache{
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+func (c *remoteCache) get(url string) interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[url]
+	if !ok || (!entry.expires.IsZero() && time.Now().After(entry.expires)) {
+		return nil
+	}
+
+	return entry.value
+}
+
+func (c *remoteCache) set(url string, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := cacheEntry{value: value}
+	if c.TTL > 0 {
+		entry.expires = time.Now().Add(c.TTL)
+	}
+
+	c.entries[url] = entry
+}
+
+type sourceCache struct {
+	*remoteCache
+}
+
+// SourceCache is a global cache of repo URL's and available remote versions,
+// used to reduce network calls to find verisons.
+var SourceCache = sourceCache{newRemoteCache()}
+
 func (sc sourceCache) Get(url string) semver.Collection {
-	if val, ok := sc[url]; ok {
+	if val, ok := sc.get(url).(semver.Collection); ok {
 		return val
 	}
 
@@ -55,5 +177,61 @@ func (sc sourceCache) Get(url string) semver.Collection {
 }
 
 func (sc sourceCache) Set(url string, collection semver.Collection) {
-	sc[url] = collection
+	sc.set(url, collection)
+}
+
+type releaseDateCache struct {
+	*remoteCache
+}
+
+// ReleaseDateCache is a global cache of the release dates of tags, keyed by repo URL and tag,
+// which are far more expensive to look up than the tags themselves. Tags without a known
+// release date are cached with a zero time.
+var ReleaseDateCache = releaseDateCache{newRemoteCache()}
+
+func (rc releaseDateCache) Get(url string, tag string) (time.Time, bool) {
+	val, ok := rc.get(url + "@" + tag).(time.Time)
+	return val, ok
+}
+
+func (rc releaseDateCache) Set(url string, tag string, date time.Time) {
+	rc.set(url+"@"+tag, date)
+}
+
+// Limiter bounds the number of operations in progress at once, a nil Limiter is unbounded.
+type Limiter chan struct{}
+
+// RemoteLookups limits the number of remote lookups in progress at once, across every
+// source being resolved.
+var RemoteLookups Limiter
+
+// NewLimiter creates a Limiter allowing n operations at once, or an unbounded one if n is
+// not positive.
+func NewLimiter(n int) Limiter {
+	if n <= 0 {
+		return nil
+	}
+
+	return make(Limiter, n)
+}
+
+// Acquire waits until an operation may start, or the context is done.
+func (l Limiter) Acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release marks an operation as finished.
+func (l Limiter) Release() {
+	if l != nil {
+		<-l
+	}
 }
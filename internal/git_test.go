@@ -1,17 +1,122 @@
 package internal
 
-import "testing"
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
 
 var remotes = []string{
-	// "git@github.com:terraform-aws-modules/terraform-aws-vpc.git",
 	"https://github.com/terraform-aws-modules/terraform-aws-vpc.git",
+	"ssh://git@gitlab.com/example/terraform-modules.git",
 }
 
 func TestGetRemote(t *testing.T) {
+	provider, err := NewFixtureTagProvider("testdata/tags.json")
+	require.NoError(t, err)
+
 	for _, remote := range remotes {
-		_, err := RemoteTags(remote)
+		remoteURL, _ := url.Parse(remote)
+		tags, err := provider.Tags(context.Background(), remoteURL)
 		if err != nil {
 			t.Errorf("error getting tags for '%s': %s", remote, err)
 		}
+
+		assert.NotEmpty(t, tags, "fixture tags should be returned for %s", remote)
 	}
 }
+
+func TestGitTagProviderListsLocalRepository(t *testing.T) {
+	dir := newTestRepository(t, "v1.0.0", "v1.1.0")
+
+	remoteURL, _ := url.Parse("file://" + filepath.ToSlash(dir))
+	tags, err := (&GitTagProvider{}).Tags(context.Background(), remoteURL)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, semver.Collection{semver.MustParse("v1.0.0"), semver.MustParse("v1.1.0")}, tags)
+}
+
+func TestGitTagProviderReleaseDates(t *testing.T) {
+	dir := newTestRepository(t, "v1.0.0", "v0.9.0")
+	repo, err := git.PlainOpen(dir)
+	require.NoError(t, err)
+
+	head, err := repo.Head()
+	require.NoError(t, err)
+
+	tagged := time.Date(2021, 6, 7, 10, 0, 0, 0, time.UTC)
+	_, err = repo.CreateTag("v1.1.0", head.Hash(), &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "test", Email: "test@example.com", When: tagged},
+		Message: "release",
+	})
+	require.NoError(t, err)
+
+	commit, err := repo.CommitObject(head.Hash())
+	require.NoError(t, err)
+
+	remoteURL, _ := url.Parse("file://" + filepath.ToSlash(dir))
+	dates, err := (&GitTagProvider{}).ReleaseDates(context.Background(), remoteURL, []string{"v1.0.0", "v1.1.0", "v2.0.0"})
+	require.NoError(t, err)
+	assert.Len(t, dates, 2, "only the requested tags which exist should be dated")
+	assert.True(t, commit.Committer.When.Equal(dates["v1.0.0"]), "lightweight tags should be dated by their commit")
+	assert.True(t, tagged.Equal(dates["v1.1.0"]), "annotated tags should be dated by their tagger")
+}
+
+func TestExcludeReleasedAfter(t *testing.T) {
+	provider, err := NewFixtureTagProvider("testdata/tags.json")
+	require.NoError(t, err)
+
+	defer func(previous *TagProviderRegistry) { TagProviders = previous }(TagProviders)
+	TagProviders = NewTagProviderRegistry(provider)
+
+	for _, remote := range remotes {
+		remoteURL, _ := url.Parse(remote)
+		source := GitSource{RemoteURL: remoteURL}
+		require.NoError(t, source.UpdateRemoteTags(context.Background()))
+		require.NoError(t, source.UpdateReleaseDates(context.Background(), source.NewerVersions()...))
+
+		source.ExcludeReleasedAfter(time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC))
+		if remote == remotes[0] {
+			assert.Equal(t, "v3.0.0", source.LatestRemoteVersion.Original(), "versions released after the cutoff should be excluded")
+			assert.Len(t, source.RemoteVersions, 3)
+		} else {
+			assert.Nil(t, source.LatestRemoteVersion, "versions without a release date should be excluded")
+		}
+	}
+}
+
+// newTestRepository creates a git repository in a temporary directory with a single
+// commit tagged with each of the given tags.
+func newTestRepository(t *testing.T, tags ...string) string {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte("# test module\n"), 0600))
+
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+
+	_, err = worktree.Add("main.tf")
+	require.NoError(t, err)
+
+	commit, err := worktree.Commit("initial", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+
+	for _, tag := range tags {
+		_, err := repo.CreateTag(tag, commit, nil)
+		require.NoError(t, err)
+	}
+
+	return dir
+}
@@ -0,0 +1,172 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// GitHubTagProvider looks up tags using the GitHub REST API, which avoids a full ref
+// advertisement for repositories with a large number of branches or pull requests.
+type GitHubTagProvider struct {
+	BaseURL string
+	Token   string
+	Client  *http.Client
+}
+
+// NewGitHubTagProvider creates a provider for github.com, authenticating with the
+// GITHUB_TOKEN environment variable when it is set.
+func NewGitHubTagProvider() *GitHubTagProvider {
+	return &GitHubTagProvider{
+		BaseURL: "https://api.github.com",
+		Token:   os.Getenv("GITHUB_TOKEN"),
+		Client:  http.DefaultClient,
+	}
+}
+
+// Tags returns the semver tags of the repository at the given URL.
+func (p *GitHubTagProvider) Tags(ctx context.Context, remoteURL *url.URL) (semver.Collection, error) {
+	endpoint := fmt.Sprintf("%s/repos/%s/tags?per_page=100", p.BaseURL, repositoryPath(remoteURL))
+	names, err := fetchTagNames(ctx, p.Client, endpoint, p.header())
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSemverTags(names)
+}
+
+type gitHubRef struct {
+	Object struct {
+		Type string `json:"type"`
+		SHA  string `json:"sha"`
+	} `json:"object"`
+}
+
+type gitHubGitObject struct {
+	Tagger struct {
+		Date time.Time `json:"date"`
+	} `json:"tagger"`
+	Committer struct {
+		Date time.Time `json:"date"`
+	} `json:"committer"`
+}
+
+// ReleaseDates returns when each of the given tags of the repository at the given URL was
+// released, from the tag object of annotated tags or the tagged commit of lightweight tags.
+func (p *GitHubTagProvider) ReleaseDates(ctx context.Context, remoteURL *url.URL, tags []string) (map[string]time.Time, error) {
+	repository := fmt.Sprintf("%s/repos/%s", p.BaseURL, repositoryPath(remoteURL))
+	dates := make(map[string]time.Time)
+
+	for _, tag := range tags {
+		var ref gitHubRef
+		found, err := fetchJSON(ctx, p.Client, fmt.Sprintf("%s/git/ref/tags/%s", repository, url.PathEscape(tag)), p.header(), &ref)
+		if err != nil {
+			return nil, err
+		}
+
+		if !found {
+			continue
+		}
+
+		var object gitHubGitObject
+		switch ref.Object.Type {
+		case "tag":
+			found, err = fetchJSON(ctx, p.Client, fmt.Sprintf("%s/git/tags/%s", repository, ref.Object.SHA), p.header(), &object)
+		case "commit":
+			found, err = fetchJSON(ctx, p.Client, fmt.Sprintf("%s/git/commits/%s", repository, ref.Object.SHA), p.header(), &object)
+		default:
+			// Tags of anything but a commit have no release date, and aren't module versions.
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case !found:
+			continue
+		case ref.Object.Type == "tag":
+			dates[tag] = object.Tagger.Date
+		default:
+			dates[tag] = object.Committer.Date
+		}
+	}
+
+	return dates, nil
+}
+
+func (p *GitHubTagProvider) header() http.Header {
+	header := http.Header{}
+	header.Set("Accept", "application/vnd.github.v3+json")
+	if p.Token != "" {
+		header.Set("Authorization", "token "+p.Token)
+	}
+
+	return header
+}
+
+// GitHubPullRequestProvider opens pull requests using the GitHub REST API.
+type GitHubPullRequestProvider struct {
+	BaseURL string
+	Token   string
+	Client  *http.Client
+}
+
+// NewGitHubPullRequestProvider creates a provider for github.com, authenticating with the
+// GITHUB_TOKEN environment variable.
+func NewGitHubPullRequestProvider() *GitHubPullRequestProvider {
+	return &GitHubPullRequestProvider{
+		BaseURL: "https://api.github.com",
+		Token:   os.Getenv("GITHUB_TOKEN"),
+		Client:  http.DefaultClient,
+	}
+}
+
+type gitHubPullRequest struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+}
+
+// OpenPullRequest opens a pull request for the branch, or updates the title, body and base of
+// the pull request already open for it.
+func (p *GitHubPullRequestProvider) OpenPullRequest(ctx context.Context, remoteURL *url.URL, pr PullRequest) (string, bool, error) {
+	header := http.Header{}
+	header.Set("Accept", "application/vnd.github.v3+json")
+	if p.Token != "" {
+		header.Set("Authorization", "token "+p.Token)
+	}
+
+	repository := repositoryPath(remoteURL)
+	owner := strings.SplitN(repository, "/", 2)[0]
+	endpoint := fmt.Sprintf("%s/repos/%s/pulls", p.BaseURL, repository)
+
+	var open []gitHubPullRequest
+	query := url.Values{"state": {"open"}, "head": {owner + ":" + pr.Branch}}
+	if err := sendJSON(ctx, p.Client, http.MethodGet, endpoint+"?"+query.Encode(), header, nil, &open); err != nil {
+		return "", false, err
+	}
+
+	var result gitHubPullRequest
+	if len(open) > 0 {
+		update := map[string]string{"title": pr.Title, "body": pr.Body, "base": pr.Base}
+		err := sendJSON(ctx, p.Client, http.MethodPatch, fmt.Sprintf("%s/%d", endpoint, open[0].Number), header, update, &result)
+		return result.HTMLURL, true, err
+	}
+
+	create := map[string]string{"title": pr.Title, "body": pr.Body, "head": pr.Branch, "base": pr.Base}
+	err := sendJSON(ctx, p.Client, http.MethodPost, endpoint, header, create, &result)
+	return result.HTMLURL, false, err
+}
+
+// PushAuth returns the GITHUB_TOKEN credentials for HTTPS remotes.
+func (p *GitHubPullRequestProvider) PushAuth(remoteURL *url.URL) transport.AuthMethod {
+	return tokenAuth(remoteURL, "x-access-token", p.Token)
+}
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// GitLabTagProvider looks up tags using the GitLab REST API.
+type GitLabTagProvider struct {
+	BaseURL string
+	Token   string
+	Client  *http.Client
+}
+
+// NewGitLabTagProvider creates a provider for gitlab.com, authenticating with the
+// GITLAB_TOKEN environment variable when it is set.
+func NewGitLabTagProvider() *GitLabTagProvider {
+	return &GitLabTagProvider{
+		BaseURL: "https://gitlab.com",
+		Token:   os.Getenv("GITLAB_TOKEN"),
+		Client:  http.DefaultClient,
+	}
+}
+
+// Tags returns the semver tags of the project at the given URL.
+func (p *GitLabTagProvider) Tags(ctx context.Context, remoteURL *url.URL) (semver.Collection, error) {
+	endpoint := fmt.Sprintf("%s/api/v4/projects/%s/repository/tags?per_page=100", p.BaseURL, url.PathEscape(repositoryPath(remoteURL)))
+	names, err := fetchTagNames(ctx, p.Client, endpoint, p.header())
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSemverTags(names)
+}
+
+type gitLabTag struct {
+	CreatedAt *time.Time `json:"created_at"`
+	Commit    struct {
+		CommittedDate time.Time `json:"committed_date"`
+	} `json:"commit"`
+}
+
+// ReleaseDates returns when each of the given tags of the project at the given URL was released,
+// the date of annotated tags is only reported by newer versions of GitLab, otherwise the date of
+// the tagged commit is used.
+func (p *GitLabTagProvider) ReleaseDates(ctx context.Context, remoteURL *url.URL, tags []string) (map[string]time.Time, error) {
+	project := fmt.Sprintf("%s/api/v4/projects/%s", p.BaseURL, url.PathEscape(repositoryPath(remoteURL)))
+	dates := make(map[string]time.Time)
+
+	for _, name := range tags {
+		var tag gitLabTag
+		found, err := fetchJSON(ctx, p.Client, fmt.Sprintf("%s/repository/tags/%s", project, url.PathEscape(name)), p.header(), &tag)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case !found:
+			continue
+		case tag.CreatedAt != nil:
+			dates[name] = *tag.CreatedAt
+		default:
+			dates[name] = tag.Commit.CommittedDate
+		}
+	}
+
+	return dates, nil
+}
+
+func (p *GitLabTagProvider) header() http.Header {
+	header := http.Header{}
+	if p.Token != "" {
+		header.Set("PRIVATE-TOKEN", p.Token)
+	}
+
+	return header
+}
+
+// GitLabMergeRequestProvider opens merge requests using the GitLab REST API.
+type GitLabMergeRequestProvider struct {
+	BaseURL string
+	Token   string
+	Client  *http.Client
+}
+
+// NewGitLabMergeRequestProvider creates a provider for gitlab.com, authenticating with the
+// GITLAB_TOKEN environment variable.
+func NewGitLabMergeRequestProvider() *GitLabMergeRequestProvider {
+	return &GitLabMergeRequestProvider{
+		BaseURL: "https://gitlab.com",
+		Token:   os.Getenv("GITLAB_TOKEN"),
+		Client:  http.DefaultClient,
+	}
+}
+
+type gitLabMergeRequest struct {
+	IID    int    `json:"iid"`
+	WebURL string `json:"web_url"`
+}
+
+// OpenPullRequest opens a merge request for the branch, or updates the title, description and
+// target branch of the merge request already open for it.
+func (p *GitLabMergeRequestProvider) OpenPullRequest(ctx context.Context, remoteURL *url.URL, pr PullRequest) (string, bool, error) {
+	header := http.Header{}
+	if p.Token != "" {
+		header.Set("PRIVATE-TOKEN", p.Token)
+	}
+
+	endpoint := fmt.Sprintf("%s/api/v4/projects/%s/merge_requests", p.BaseURL, url.PathEscape(repositoryPath(remoteURL)))
+
+	var open []gitLabMergeRequest
+	query := url.Values{"state": {"opened"}, "source_branch": {pr.Branch}}
+	if err := sendJSON(ctx, p.Client, http.MethodGet, endpoint+"?"+query.Encode(), header, nil, &open); err != nil {
+		return "", false, err
+	}
+
+	var result gitLabMergeRequest
+	if len(open) > 0 {
+		update := map[string]string{"title": pr.Title, "description": pr.Body, "target_branch": pr.Base}
+		err := sendJSON(ctx, p.Client, http.MethodPut, fmt.Sprintf("%s/%d", endpoint, open[0].IID), header, update, &result)
+		return result.WebURL, true, err
+	}
+
+	create := map[string]string{"title": pr.Title, "description": pr.Body, "source_branch": pr.Branch, "target_branch": pr.Base}
+	err := sendJSON(ctx, p.Client, http.MethodPost, endpoint, header, create, &result)
+	return result.WebURL, false, err
+}
+
+// PushAuth returns the GITLAB_TOKEN credentials for HTTPS remotes.
+func (p *GitLabMergeRequestProvider) PushAuth(remoteURL *url.URL) transport.AuthMethod {
+	return tokenAuth(remoteURL, "oauth2", p.Token)
+}
@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// Grouping decides which planned changes are committed to the same branch, and opened as the
+// same pull request.
+type Grouping string
+
+const (
+	// GroupSingle puts every change on a single branch.
+	GroupSingle Grouping = "single"
+	// GroupRepository puts the changes to sources of each module repository on their own branch.
+	GroupRepository Grouping = "repository"
+	// GroupModule puts the change to each module block on its own branch.
+	GroupModule Grouping = "module"
+	// GroupDirectory puts the changes to the files in each directory on their own branch.
+	GroupDirectory Grouping = "directory"
+	// GroupMajor puts major version changes on one branch, and minor and patch changes on another.
+	GroupMajor Grouping = "major"
+)
+
+// Groupings lists every grouping, in the order they are documented.
+var Groupings = []Grouping{GroupSingle, GroupRepository, GroupModule, GroupDirectory, GroupMajor}
+
+// ParseGrouping returns the grouping with the given name.
+func ParseGrouping(name string) (Grouping, error) {
+	for _, grouping := range Groupings {
+		if string(grouping) == name {
+			return grouping, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown grouping %s, must be one of %s", name, strings.Trim(fmt.Sprint(Groupings), "[]"))
+}
+
+// ChangeGroup is a set of changes committed to the same branch.
+type ChangeGroup struct {
+	Branch  string
+	Changes []*Change
+}
+
+// Group splits the changes which are updates into groups, each with a branch named from the
+// given prefix and what the group has in common, e.g., tfmodref/update-major. The two are joined
+// with a dash, as git can't hold both a branch and branches nested under it, e.g., after
+// changing the grouping. Branch names depend only on the changes, so
+// rerunning an update commits to the same branches. File paths are made relative to root, the
+// root of the repository, so they don't depend on where the update is run from. Groups are
+// ordered by branch.
+func (g Grouping) Group(prefix string, root string, changes []*Change) []*ChangeGroup {
+	groups := make(map[string]*ChangeGroup)
+	for _, change := range changes {
+		if !change.IsUpdate() {
+			continue
+		}
+
+		branch := prefix
+		if key := g.key(root, change); key != "" {
+			branch = prefix + "-" + branchSlug(key)
+		}
+
+		group, ok := groups[branch]
+		if !ok {
+			group = &ChangeGroup{Branch: branch}
+			groups[branch] = group
+		}
+
+		group.Changes = append(group.Changes, change)
+	}
+
+	var sorted []*ChangeGroup
+	for _, group := range groups {
+		sorted = append(sorted, group)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Branch < sorted[j].Branch
+	})
+
+	return sorted
+}
+
+// key returns what the changes in a group have in common, appended to the branch name, empty
+// for a single group.
+func (g Grouping) key(root string, change *Change) string {
+	switch g {
+	case GroupRepository:
+		// Repositories are named by host and path, so the protocol used doesn't matter.
+		if remoteURL, err := ParseRemoteURL(change.Repository); err == nil {
+			return remoteURL.Hostname() + "/" + repositoryPath(remoteURL)
+		}
+		return change.Repository
+	case GroupModule:
+		return relativeTo(root, change.File) + "/" + moduleName(change.Module)
+	case GroupDirectory:
+		return filepath.ToSlash(filepath.Dir(relativeTo(root, change.File)))
+	case GroupMajor:
+		if isMajorChange(change) {
+			return "major"
+		}
+		return "minor-patch"
+	}
+
+	return ""
+}
+
+// isMajorChange returns true if the major version changes, or the source wasn't versioned.
+func isMajorChange(change *Change) bool {
+	from, err := semver.NewVersion(change.From)
+	if err != nil {
+		return true
+	}
+
+	to, err := semver.NewVersion(change.To)
+	if err != nil {
+		return true
+	}
+
+	return from.Major() != to.Major()
+}
+
+// moduleName returns the block name from a module key, e.g., vpc from main.tf [vpc], or nothing
+// for terragrunt files, whose key is only the file path.
+func moduleName(module string) string {
+	if i := strings.LastIndex(module, " ["); i >= 0 && strings.HasSuffix(module, "]") {
+		return module[i+2 : len(module)-1]
+	}
+
+	return ""
+}
+
+// relativeTo returns the slash separated path of a file relative to root, or the path as is if
+// it isn't within root.
+func relativeTo(root string, path string) string {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+
+	relative, err := filepath.Rel(root, absolute)
+	if err != nil || strings.HasPrefix(relative, "..") {
+		return filepath.ToSlash(path)
+	}
+
+	return filepath.ToSlash(relative)
+}
+
+var branchUnsafe = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// maxSlugLength keeps branch names readable, longer slugs are shortened.
+const maxSlugLength = 60
+
+// branchSlug turns a key into a string which is safe to use within a branch name. Slugs which
+// aren't the key as is, as characters were folded or it was shortened, end with a short hash of
+// the key, so that distinct keys such as mods/a_b and mods/a-b never share a branch.
+func branchSlug(key string) string {
+	slug := branchUnsafe.ReplaceAllString(strings.ToLower(key), "-")
+	slug = strings.ReplaceAll(slug, "..", ".")
+	slug = strings.Trim(slug, "-.")
+	slug = strings.TrimSuffix(slug, ".git")
+	if slug == key {
+		return slug
+	}
+
+	if slug == "" {
+		slug = "root"
+	}
+
+	if len(slug) > maxSlugLength-8 {
+		slug = strings.TrimRight(slug[:maxSlugLength-8], "-.")
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	return slug + "-" + hex.EncodeToString(sum[:])[:7]
+}
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func groupBranches(groups []*ChangeGroup) map[string][]string {
+	branches := make(map[string][]string)
+	for _, group := range groups {
+		for _, change := range group.Changes {
+			branches[group.Branch] = append(branches[group.Branch], change.Module)
+		}
+	}
+
+	return branches
+}
+
+func TestGrouping(t *testing.T) {
+	root := t.TempDir()
+	network := filepath.Join(root, "network", "main.tf")
+	compute := filepath.Join(root, "compute", "main.tf")
+	changes := []*Change{
+		{Module: network + " [vpc]", File: network, Repository: "https://github.com/terraform-aws-modules/terraform-aws-vpc.git", From: "v2.0.0", To: "v3.1.0"},
+		{Module: network + " [subnets]", File: network, Repository: "ssh://git@gitlab.com/example/terraform-modules.git", From: "v0.1.0", To: "v0.2.0"},
+		{Module: compute + " [vpc]", File: compute, Repository: "git@github.com:terraform-aws-modules/terraform-aws-vpc.git", From: "v3.0.0", To: "v3.1.0"},
+		{Module: compute + " [skipped]", File: compute, Repository: "ssh://git@gitlab.com/example/terraform-modules.git", From: "v0.1.0", Skipped: "no reason"},
+	}
+
+	tests := []struct {
+		grouping Grouping
+		expected map[string][]string
+	}{
+		{GroupSingle, map[string][]string{
+			"tfmodref/update": {network + " [vpc]", network + " [subnets]", compute + " [vpc]"},
+		}},
+		{GroupRepository, map[string][]string{
+			"tfmodref/update-github.com-terraform-aws-modules-terraform-aws-vpc-ae3ed07": {network + " [vpc]", compute + " [vpc]"},
+			"tfmodref/update-gitlab.com-example-terraform-modules-a9d2a7b":               {network + " [subnets]"},
+		}},
+		{GroupModule, map[string][]string{
+			"tfmodref/update-network-main.tf-vpc-98d5250":     {network + " [vpc]"},
+			"tfmodref/update-network-main.tf-subnets-4230268": {network + " [subnets]"},
+			"tfmodref/update-compute-main.tf-vpc-71d67df":     {compute + " [vpc]"},
+		}},
+		{GroupDirectory, map[string][]string{
+			"tfmodref/update-network": {network + " [vpc]", network + " [subnets]"},
+			"tfmodref/update-compute": {compute + " [vpc]"},
+		}},
+		{GroupMajor, map[string][]string{
+			"tfmodref/update-major":       {network + " [vpc]"},
+			"tfmodref/update-minor-patch": {network + " [subnets]", compute + " [vpc]"},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.grouping), func(t *testing.T) {
+			groups := test.grouping.Group("tfmodref/update", root, changes)
+			assert.Equal(t, test.expected, groupBranches(groups))
+
+			for i := 1; i < len(groups); i++ {
+				assert.Less(t, groups[i-1].Branch, groups[i].Branch, "groups should be ordered by branch")
+			}
+		})
+	}
+}
+
+func TestParseGrouping(t *testing.T) {
+	grouping, err := ParseGrouping("repository")
+	require.NoError(t, err)
+	assert.Equal(t, GroupRepository, grouping)
+
+	_, err = ParseGrouping("file")
+	assert.EqualError(t, err, "unknown grouping file, must be one of single repository module directory major")
+}
+
+func TestBranchSlug(t *testing.T) {
+	assert.Equal(t, "network", branchSlug("network"), "keys which are safe as they are should be kept as is")
+	assert.Equal(t, "root-cdb4ee2", branchSlug("."))
+	assert.True(t, strings.HasPrefix(branchSlug("A..b/C"), "a.b-c-"))
+	assert.NotEqual(t, branchSlug("mods/a_b"), branchSlug("mods/a-b"), "keys folded to the same slug should get distinct branches")
+	assert.NotEqual(t, branchSlug("A"), branchSlug("a"), "keys differing only in case should get distinct branches")
+	assert.NotEqual(t, branchSlug("mods/a-b"), branchSlug("mods-a-b"))
+
+	long := strings.Repeat("module/", 20)
+	slug := branchSlug(long)
+	assert.Len(t, slug, maxSlugLength)
+	assert.Equal(t, slug, branchSlug(long), "shortened slugs should be deterministic")
+	assert.NotEqual(t, slug, branchSlug(long+"x"), "shortened slugs should be unique")
+}
@@ -1,20 +1,24 @@
 package internal
 
 import (
-	"bufio"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/Masterminds/semver"
 	"github.com/hashicorp/go-getter"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
-	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/jbrailsford/tfmodref/util"
 	"github.com/zclconf/go-cty/cty"
 
 	urlhelper "github.com/hashicorp/go-getter/helper/url"
@@ -27,9 +31,12 @@ const TerragruntBlockType string = "terraform"
 const TerraformBlockType string = "module"
 
 // HclParser presides over a given HCL formatted file and can be used to both read and udpate it.
+// Both native and JSON syntax files are supported, in either case changes are made by replacing
+// the bytes of source literals within the original file, so everything else is kept as written.
 type HclParser struct {
 	filePath string
-	file     *hclwrite.File
+	src      []byte
+	sources  []sourceAttribute
 }
 
 // BlockSource contains the name of a given module containing a source ref,in the case of
@@ -40,11 +47,59 @@ type BlockSource struct {
 	gitRemoteURL *url.URL
 	sourceURL    *url.URL
 	prefixes     []string
+	literal      string
+	refSpan      []int
+	updateError  error
+	line         int
+	subdirectory string
+	arguments    []string
+	terragrunt   bool
+}
+
+// sourceAttribute is a `source` attribute found within a block. The literal holds the string
+// as written between its quotes and literalRange its location, so it can be replaced in place.
+// For sources built from interpolation the literal is only the part of the source holding the
+// ref, which is at refSpan within it, and if there's no such literal updateError says why. Where
+// the literal is in another file, e.g., a terragrunt include, literalFile is its path and
+// literalSrc its content.
+// The line is that of the source attribute itself, and the arguments are the names of the
+// variables the module is called with, or nil if they can't be known.
+type sourceAttribute struct {
+	line         int
+	arguments    []string
+	terragrunt   bool
+	labels       []string
+	value        string
+	literal      string
+	literalRange hcl.Range
+	literalFile  string
+	literalSrc   []byte
+	refSpan      []int
+	updateError  error
+	replacement  *string
 }
 
 // NewHclParser reads in a given HCL file and instansiates a new instance of HclParser
 func NewHclParser(filePath string) (*HclParser, []error) {
-	parsed, errs := parseHcl(filePath)
+	raw, err := ioutil.ReadFile(filepath.Clean(filePath))
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return NewHclParserFromBytes(filePath, raw)
+}
+
+// NewHclParserFromBytes parses the given content as the HCL file at filePath, e.g., a version of
+// the file held elsewhere than on disk, such as in the git index.
+func NewHclParserFromBytes(filePath string, raw []byte) (*HclParser, []error) {
+	var sources []sourceAttribute
+	var errs []error
+	if isJSONFile(filePath) {
+		sources, errs = parseJSONSources(filePath, raw)
+	} else {
+		sources, errs = parseHcl(filePath, raw)
+	}
+
 	if errs != nil {
 		// TODO: handle err properly
 		return nil, errs
@@ -52,14 +107,15 @@ func NewHclParser(filePath string) (*HclParser, []error) {
 
 	return &HclParser{
 		filePath: filePath,
-		file:     parsed,
+		src:      raw,
+		sources:  sources,
 	}, nil
 }
 
 // FindGitSources searches the current HCL for blocks which contain a `source` attribute,
 // and then extracts the version references from it. Optionally, it may also retrieve
 // information about the versions of the module available remotely.
-func (p *HclParser) FindGitSources(includeRemote bool) (map[string]GitSource, error) {
+func (p *HclParser) FindGitSources(ctx context.Context, includeRemote bool) (map[string]GitSource, error) {
 	sources := make(map[string]GitSource)
 
 	blocksWithSource := p.findBlocksWithGitSource()
@@ -67,7 +123,19 @@ func (p *HclParser) FindGitSources(includeRemote bool) (map[string]GitSource, er
 	// probably don't need to map one struct to another here, may be cleaner to build just one.
 	for i, v := range blocksWithSource {
 		gitSource := GitSource{
-			BlockIndex: i,
+			BlockIndex:   i,
+			FilePath:     p.filePath,
+			Line:         v.line,
+			Subdirectory: v.subdirectory,
+			Arguments:    v.arguments,
+			terragrunt:   v.terragrunt,
+			UpdateError:  v.updateError,
+		}
+
+		// Sources which couldn't be evaluated have no URL, only the reason in UpdateError.
+		if v.sourceURL == nil {
+			sources[v.Name] = gitSource
+			continue
 		}
 
 		qs := v.sourceURL.Query()
@@ -82,12 +150,13 @@ func (p *HclParser) FindGitSources(includeRemote bool) (map[string]GitSource, er
 		gitSource.SourceURL = v.sourceURL
 		gitSource.RemoteURL = v.gitRemoteURL
 		gitSource.Prefixes = v.prefixes
+		gitSource.literal = v.literal
+		gitSource.refSpan = v.refSpan
 
+		// Sources whose remote tags can't be retrieved are still returned, with the error
+		// recorded against them, so callers can report them rather than silently skip them.
 		if includeRemote {
-			if err := gitSource.UpdateRemoteTags(); err != nil {
-				fmt.Fprintf(os.Stderr, "could not get remote tags for module %s (%s)\n", v.Name, err.Error())
-				continue
-			}
+			gitSource.RemoteError = gitSource.UpdateRemoteTags(ctx)
 		}
 
 		sources[v.Name] = gitSource
@@ -96,108 +165,477 @@ func (p *HclParser) FindGitSources(includeRemote bool) (map[string]GitSource, er
 	return sources, nil
 }
 
-// Save updates the target file
-func (p *HclParser) Save() error {
+// Save updates the target file, writing to a temporary file which is then renamed over the
+// target, keeping its permissions, along with any other files holding updated sources. Saving
+// will not start once the context is done, and the rename ensures the file is never left
+// partially written. Other files are not overwritten if they've changed since they were read,
+// other than by the same update.
+func (p *HclParser) Save(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	fi, err := os.Stat(p.filePath)
 	if err != nil {
 		return err
 	}
 
-	file, err := os.OpenFile(p.filePath, os.O_TRUNC|os.O_RDWR|os.O_EXCL, fi.Mode())
-	if err != nil {
+	included := p.IncludedBytes()
+	for path, content := range included {
+		current, err := ioutil.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(current, p.includedSrc(path)) && !bytes.Equal(current, content) {
+			return fmt.Errorf("%s has changed since it was read", path)
+		}
+	}
+
+	if err := util.WriteFileAtomic(p.filePath, p.Bytes(), fi.Mode()); err != nil {
 		return err
 	}
 
-	output := bufio.NewWriter(file)
-	defer output.Flush()
+	for path, content := range included {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
 
-	p.file.BuildTokens(nil)
-	_, err = p.file.WriteTo(output)
+		if err := util.WriteFileAtomic(path, content, fi.Mode()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Revert writes the contents of the file as it was read back over the target, along with any
+// other files holding updated sources, undoing a save and any changes made to the files since,
+// such as by hooks. Unlike Save, reverting continues once the context is done, so an interrupted
+// update can still be rolled back.
+func (p *HclParser) Revert() error {
+	fi, err := os.Stat(p.filePath)
 	if err != nil {
 		return err
 	}
 
-	if err := output.Flush(); err != nil {
+	if err := util.WriteFileAtomic(p.filePath, p.src, fi.Mode()); err != nil {
 		return err
 	}
 
-	return file.Close()
+	for path, original := range p.IncludedFiles() {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		if err := util.WriteFileAtomic(path, original, fi.Mode()); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-// UpdateBlockSource udpates the block source in the HCL, in memory, to match the source contained in the GitSource
-func (p *HclParser) UpdateBlockSource(source *GitSource) {
-	body := p.file.Body().Blocks()[source.BlockIndex].Body()
-	body.SetAttributeValue("source", cty.StringVal(source.HCLSafeSourceURL()))
-	body.BuildTokens(nil)
+// Original returns the contents of the file as it was read.
+func (p *HclParser) Original() []byte {
+	return p.src
 }
 
-func parseHcl(filePath string) (*hclwrite.File, []error) {
-	raw, err := ioutil.ReadFile(filepath.Clean(filePath))
-	if err != nil {
-		return nil, []error{err}
+// Bytes returns the contents of the file with any updated sources spliced in.
+func (p *HclParser) Bytes() []byte {
+	return p.replaceLiterals("", p.src)
+}
+
+// IncludedFiles returns the contents, as they were read, of the other files holding updated
+// sources, keyed by path. These are the files terragrunt sources take their ref from, e.g.,
+// through an include or read_terragrunt_config.
+func (p *HclParser) IncludedFiles() map[string][]byte {
+	files := make(map[string][]byte)
+	for _, source := range p.sources {
+		if source.replacement != nil && source.literalFile != "" {
+			files[source.literalFile] = source.literalSrc
+		}
 	}
 
-	parsed, diags := hclwrite.ParseConfig(raw, filepath.Base(filePath), hcl.InitialPos)
+	return files
+}
 
-	if diags.HasErrors() {
-		return nil, diags.Errs()
+// IncludedBytes returns the contents of each of the IncludedFiles with the updated sources
+// spliced in.
+func (p *HclParser) IncludedBytes() map[string][]byte {
+	files := p.IncludedFiles()
+	for path, src := range files {
+		files[path] = p.replaceLiterals(path, src)
 	}
 
-	return parsed, nil
+	return files
 }
 
-func (p *HclParser) findBlocksWithGitSource() (blocksWithRefs map[int]BlockSource) {
-	blocksWithRefs = make(map[int]BlockSource)
-	blocks := p.file.Body().Blocks()
+// includedSrc returns the contents of the given other file as it was read.
+func (p *HclParser) includedSrc(path string) []byte {
+	return p.IncludedFiles()[path]
+}
+
+// replaceLiterals returns src with the updated sources whose literal is in the given file, or in
+// this file for an empty path, spliced in. Replacements are applied from the end of the file
+// backwards so earlier offsets remain valid.
+func (p *HclParser) replaceLiterals(literalFile string, src []byte) []byte {
+	var replaced []sourceAttribute
+	for _, source := range p.sources {
+		if source.replacement != nil && source.literalFile == literalFile {
+			replaced = append(replaced, source)
+		}
+	}
+
+	sort.Slice(replaced, func(i, j int) bool {
+		return replaced[i].literalRange.Start.Byte > replaced[j].literalRange.Start.Byte
+	})
 
-	for i, block := range blocks {
+	out := append([]byte{}, src...)
+	for i, source := range replaced {
+		// Sources built from the same local share a literal, which must only be replaced once.
+		if i > 0 && source.literalRange.Start.Byte == replaced[i-1].literalRange.Start.Byte {
+			continue
+		}
+
+		start, end := source.literalRange.Start.Byte, source.literalRange.End.Byte
+		out = append(out[:start], append([]byte(*source.replacement), out[end:]...)...)
+	}
+
+	return out
+}
+
+// UpdateBlockSource udpates the block source in the HCL, in memory, to match the source contained in the GitSource.
+// Only the bytes within the quoted literal are replaced, so comments and spacing around the attribute are untouched.
+func (p *HclParser) UpdateBlockSource(source *GitSource) {
+	literal := source.HCLSafeSourceURL()
+	p.sources[source.BlockIndex].replacement = &literal
+}
+
+// ResetBlockSources discards every update made by UpdateBlockSource, so that a different set of
+// updates can be made to the original file.
+func (p *HclParser) ResetBlockSources() {
+	for i := range p.sources {
+		p.sources[i].replacement = nil
+	}
+}
+
+func parseHcl(filePath string, raw []byte) (sources []sourceAttribute, errs []error) {
+	var err error
+	file, diags := hclsyntax.ParseConfig(raw, filepath.Base(filePath), hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, diags.Errs()
+	}
+
+	body := file.Body.(*hclsyntax.Body)
+
+	var evaluator *hclEvaluator
+	for _, block := range body.Blocks {
 		// We are only interested in blocks that *can* contain a source attribute
-		if block.Type() == TerraformBlockType || block.Type() == TerragruntBlockType {
-			rawURL := extractGitURLFromAttribute(*block.Body(), "source")
-			if rawURL == "" {
+		if block.Type != TerraformBlockType && block.Type != TerragruntBlockType {
+			continue
+		}
+
+		attr, ok := block.Body.Attributes["source"]
+		if !ok {
+			continue
+		}
+
+		// Terraform source attributes do not allow variables, but terragrunt sources are
+		// commonly built from locals, in which case the locals need to be evaluated.
+		var source sourceAttribute
+		if template, ok := attr.Expr.(*hclsyntax.TemplateExpr); ok && isStringLiteral(template) {
+			if source, err = newSourceAttribute(raw, block.Labels, template, unescapeHCL); err != nil {
 				continue
 			}
+		} else {
+			if evaluator == nil {
+				evaluator = newHclEvaluator(filePath, raw, body, 0)
+			}
+
+			source, err = evaluator.sourceAttribute(block.Labels, attr.Expr)
+			if err != nil {
+				// Sources which can't be evaluated are still returned, so they're reported rather
+				// than silently skipped.
+				source = sourceAttribute{
+					labels:      block.Labels,
+					updateError: fmt.Errorf("source %s could not be evaluated (%s)", attr.Expr.Range().SliceBytes(raw), err.Error()),
+				}
+			}
+		}
+
+		source.line = attr.SrcRange.Start.Line
+		if block.Type == TerraformBlockType {
+			source.arguments = moduleArguments(block.Body)
+		} else {
+			source.arguments = terragruntInputs(body)
+			source.terragrunt = true
+		}
 
-			url, e := url.Parse(rawURL)
-			if e != nil {
+		sources = append(sources, source)
+	}
+
+	return sources, nil
+}
+
+// moduleMetaArguments are the arguments of a module block which are not passed to the module
+// as variables.
+var moduleMetaArguments = map[string]bool{
+	"source":     true,
+	"version":    true,
+	"count":      true,
+	"for_each":   true,
+	"providers":  true,
+	"depends_on": true,
+}
+
+// moduleArguments returns the names of the variables a module block sets.
+func moduleArguments(body *hclsyntax.Body) []string {
+	arguments := []string{}
+	for name := range body.Attributes {
+		if !moduleMetaArguments[name] {
+			arguments = append(arguments, name)
+		}
+	}
+	sort.Strings(arguments)
+
+	return arguments
+}
+
+// terragruntInputs returns the names of the inputs a terragrunt file sets, or nil if they can't
+// be known from the file alone, i.e., inputs which aren't an object literal, or may be merged
+// with the inputs of included files.
+func terragruntInputs(body *hclsyntax.Body) []string {
+	for _, block := range body.Blocks {
+		if block.Type == "include" {
+			return nil
+		}
+	}
+
+	attr, ok := body.Attributes["inputs"]
+	if !ok {
+		return []string{}
+	}
+
+	object, ok := attr.Expr.(*hclsyntax.ObjectConsExpr)
+	if !ok {
+		return nil
+	}
+
+	inputs := []string{}
+	for _, item := range object.Items {
+		key, diags := item.KeyExpr.Value(nil)
+		if diags.HasErrors() || key.Type() != cty.String || !key.IsKnown() || key.IsNull() {
+			if name := hcl.ExprAsKeyword(item.KeyExpr); name != "" {
+				inputs = append(inputs, name)
 				continue
 			}
 
-			// Attempt to find the source attribtue within the block, and return if if the url is a valid git URL
-			if prefixes, gitURL := parseGitURL(rawURL); gitURL != nil {
-				// Set the module name to the filepath of source hcl
-				moduleName := p.filePath
-
-				// If the source is contained within a module block (terraform only) it will also be named,
-				// as such we should include that name in the metadata, since multiple modules may exist
-				// within one file - this is not the case in terragrunt, in terragrunt there's only one module
-				// reference per file
-				if len(block.Labels()) == 1 {
-					moduleName = fmt.Sprintf("%s [%s]", moduleName, block.Labels()[0])
-				}
+			return nil
+		}
 
-				blocksWithRefs[i] = BlockSource{
-					Name:         moduleName,
-					gitRemoteURL: gitURL,
-					sourceURL:    url,
-					prefixes:     prefixes,
-				}
+		inputs = append(inputs, key.AsString())
+	}
+	sort.Strings(inputs)
+
+	return inputs
+}
+
+// isStringLiteral returns true if the template contains no interpolations or directives. Unlike
+// TemplateExpr.IsStringLiteral this allows for the literal being split into multiple parts,
+// which the parser does around characters such as % and $.
+func isStringLiteral(template *hclsyntax.TemplateExpr) bool {
+	for _, part := range template.Parts {
+		if _, ok := part.(*hclsyntax.LiteralValueExpr); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newSourceAttribute reads the string literal held by expr. Where the literal contains escape
+// sequences, decoded by unescape, the ref is found within the value and mapped back to the bytes
+// of the literal it was decoded from, so that only those bytes are edited.
+func newSourceAttribute(src []byte, labels []string, expr hcl.Expression, unescape func(string) (int, string)) (sourceAttribute, error) {
+	value, diags := expr.Value(nil)
+	if diags.HasErrors() || value.IsNull() || value.Type() != cty.String {
+		return sourceAttribute{}, fmt.Errorf("source at %s is not a string", expr.Range())
+	}
+
+	rng := expr.Range()
+	start, end := rng.Start.Byte, rng.End.Byte
+	if start < 0 || end > len(src) || end-start < 2 || src[start] != '"' || src[end-1] != '"' {
+		return sourceAttribute{}, fmt.Errorf("source at %s is not a quoted string", rng)
+	}
+
+	rng.Start.Byte, rng.End.Byte = start+1, end-1
+	source := sourceAttribute{
+		labels:       labels,
+		value:        value.AsString(),
+		literal:      string(src[start+1 : end-1]),
+		literalRange: rng,
+	}
+
+	if source.literal != source.value {
+		offsets, ok := literalOffsets(source.literal, source.value, unescape)
+		if !ok {
+			source.updateError = errors.New("source contains escape sequences which can't be updated in place")
+		} else if refStart, refEnd, ok := refValueSpan(source.value); ok {
+			source.refSpan = []int{offsets[refStart], offsets[refEnd]}
+		}
+	}
+
+	return source, nil
+}
+
+// literalOffsets maps each byte of the value decoded from a raw string literal to the offset of
+// the character or escape sequence it was decoded from within the literal, with a final offset
+// of the length of the literal, so that a span of the value maps to a span of the literal. The
+// unescape function decodes the escape sequence at the start of its argument, returning its
+// length, or zero if there isn't one. It returns false if decoding doesn't give the value.
+func literalOffsets(raw string, value string, unescape func(string) (int, string)) ([]int, bool) {
+	var decoded strings.Builder
+	var offsets []int
+
+	for i := 0; i < len(raw); {
+		n, char := unescape(raw[i:])
+		if n == 0 {
+			n, char = 1, raw[i:i+1]
+		}
+
+		for j := 0; j < len(char); j++ {
+			offsets = append(offsets, i)
+		}
+
+		decoded.WriteString(char)
+		i += n
+	}
+
+	return append(offsets, len(raw)), decoded.String() == value
+}
+
+// unescapeHCL decodes the native syntax escape sequence at the start of s, if any, including the
+// $${ and %%{ sequences which escape template interpolations and directives.
+func unescapeHCL(s string) (int, string) {
+	if strings.HasPrefix(s, "$${") || strings.HasPrefix(s, "%%{") {
+		return 2, s[:1]
+	}
+
+	if len(s) < 2 || s[0] != '\\' {
+		return 0, ""
+	}
+
+	switch s[1] {
+	case 'n':
+		return 2, "\n"
+	case 'r':
+		return 2, "\r"
+	case 't':
+		return 2, "\t"
+	case '"', '\\':
+		return 2, s[1:2]
+	case 'u':
+		return unescapeUnicode(s, 4)
+	case 'U':
+		return unescapeUnicode(s, 8)
+	}
+
+	return 0, ""
+}
+
+// unescapeUnicode decodes a \u or \U escape sequence at the start of s, followed by the given
+// number of hex digits.
+func unescapeUnicode(s string, digits int) (int, string) {
+	if len(s) < 2+digits {
+		return 0, ""
+	}
+
+	r, err := strconv.ParseUint(s[2:2+digits], 16, 32)
+	if err != nil {
+		return 0, ""
+	}
+
+	return 2 + digits, string(rune(r))
+}
+
+func (p *HclParser) findBlocksWithGitSource() (blocksWithRefs map[int]BlockSource) {
+	blocksWithRefs = make(map[int]BlockSource)
+
+	for i, source := range p.sources {
+		// Set the module name to the filepath of source hcl
+		moduleName := p.filePath
+
+		// If the source is contained within a module block (terraform only) it will also be named,
+		// as such we should include that name in the metadata, since multiple modules may exist
+		// within one file - this is not the case in terragrunt, in terragrunt there's only one module
+		// reference per file
+		if len(source.labels) == 1 {
+			moduleName = fmt.Sprintf("%s [%s]", moduleName, source.labels[0])
+		}
+
+		rawURL := source.value
+		if rawURL == "" && source.updateError != nil {
+			// The source couldn't be evaluated, so only the reason is known.
+			blocksWithRefs[i] = BlockSource{
+				Name:        moduleName,
+				updateError: source.updateError,
+				line:        source.line,
+				arguments:   source.arguments,
+				terragrunt:  source.terragrunt,
 			}
+			continue
+		} else if rawURL == "" {
+			continue
+		}
 
+		url, e := url.Parse(rawURL)
+		if e != nil {
+			continue
+		}
+
+		// Attempt to find the source attribtue within the block, and return if if the url is a valid git URL
+		if prefixes, gitURL := parseGitURL(rawURL); gitURL != nil {
+			blocksWithRefs[i] = BlockSource{
+				Name:         moduleName,
+				gitRemoteURL: gitURL,
+				sourceURL:    url,
+				prefixes:     prefixes,
+				literal:      source.literal,
+				refSpan:      source.refSpan,
+				updateError:  source.updateError,
+				line:         source.line,
+				subdirectory: SourceSubdirectory(rawURL),
+				arguments:    source.arguments,
+				terragrunt:   source.terragrunt,
+			}
 		}
 	}
 
 	return
 }
 
-func extractGitURLFromAttribute(body hclwrite.Body, searchAttr string) string {
-	attr := body.GetAttribute(searchAttr)
-	if attr == nil {
-		return ""
+// ParseRemoteURL parses a git repository URL, or a module source referencing one, into the
+// same form as GitSource.RemoteURL.
+func ParseRemoteURL(rawURL string) (*url.URL, error) {
+	_, remoteURL := parseGitURL(rawURL)
+	if remoteURL == nil {
+		return nil, fmt.Errorf("%s is not a git repository URL", rawURL)
+	}
+
+	return remoteURL, nil
+}
+
+// SameRepository returns true if both URLs refer to the same repository, regardless of the
+// scheme or user used to access it, or whether the path ends in .git.
+func SameRepository(a *url.URL, b *url.URL) bool {
+	if a == nil || b == nil {
+		return false
 	}
 
-	tokens := attr.Expr().BuildTokens(nil)
-	return extractTokenStringValue(tokens)
+	return strings.EqualFold(a.Hostname(), b.Hostname()) && repositoryPath(a) == repositoryPath(b)
 }
 
 func parseGitURL(url string) ([]string, *url.URL) {
@@ -223,16 +661,14 @@ func parseGitURL(url string) ([]string, *url.URL) {
 	return prefixes, gitURL
 }
 
-func extractTokenStringValue(tokens hclwrite.Tokens) (value string) {
-	// Terraform source blocks do not allow variablse and are comprised of TokenOQuote + (TokenQuotedLit * n) + TokenCQuote,
-	// given this, we need to extract and combine all values betwen OQuote and CQuote.
-	if tokens[0].Type == hclsyntax.TokenOQuote && tokens[len(tokens)-1].Type == hclsyntax.TokenCQuote {
-		for _, token := range tokens[1 : len(tokens)-1] {
-			value += string(token.Bytes)
-		}
-	}
+// SourceSubdirectory returns the subdirectory of the repository a source refers to, e.g.,
+// modules/vpc in github.com/org/repo//modules/vpc?ref=v1.0.0, or an empty string if it refers
+// to the root of the repository.
+func SourceSubdirectory(source string) string {
+	_, rawURL := splitSourceURLGetters(source)
+	_, subdirectory := getter.SourceDirSubdir(rawURL)
 
-	return
+	return strings.Trim(subdirectory, "/")
 }
 
 func ejectGitURLFolder(url *url.URL) {
@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// TestGoldenSourceRewrites sets every source in each file within testdata/golden to v9.9.9
+// and compares the saved file with its .golden counterpart, which should differ only by ref.
+func TestGoldenSourceRewrites(t *testing.T) {
+	inputs, err := filepath.Glob("testdata/golden/*")
+	require.NoError(t, err)
+
+	for _, input := range inputs {
+		if strings.HasSuffix(input, ".golden") {
+			continue
+		}
+
+		input := input
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			raw, err := ioutil.ReadFile(input)
+			require.NoError(t, err)
+
+			path := writeTestFile(t, filepath.Base(input), string(raw))
+			parser, errs := NewHclParser(path)
+			require.Nil(t, errs)
+
+			sources, err := parser.FindGitSources(context.Background(), false)
+			require.NoError(t, err)
+			require.NotEmpty(t, sources)
+
+			for _, source := range sources {
+				source := source
+				source.SetSourceVersion(semver.MustParse("v9.9.9"))
+				parser.UpdateBlockSource(&source)
+			}
+
+			require.NoError(t, parser.Save(context.Background()))
+
+			actual, err := ioutil.ReadFile(path)
+			require.NoError(t, err)
+
+			golden := input + ".golden"
+			if *updateGolden {
+				require.NoError(t, ioutil.WriteFile(golden, actual, 0600))
+			}
+
+			expected, err := ioutil.ReadFile(golden)
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), string(actual))
+		})
+	}
+}
+
+func TestReplaceRef(t *testing.T) {
+	cases := map[string]string{
+		"git::https://example.com/repo.git":                    "git::https://example.com/repo.git?ref=v2.0.0",
+		"git::https://example.com/repo.git?ref=v1.0.0":         "git::https://example.com/repo.git?ref=v2.0.0",
+		"git::https://example.com/repo.git?depth=1":            "git::https://example.com/repo.git?depth=1&ref=v2.0.0",
+		"git::https://example.com/repo.git?depth=1&ref=v1&x=y": "git::https://example.com/repo.git?depth=1&ref=v2.0.0&x=y",
+		"git::https://example.com/repo.git?noref=v1":           "git::https://example.com/repo.git?noref=v1&ref=v2.0.0",
+	}
+
+	for source, expected := range cases {
+		assert.Equal(t, expected, replaceRef(source, "v2.0.0"), "replacing ref in %s", source)
+	}
+}
+
+func TestSameRepository(t *testing.T) {
+	repository, err := ParseRemoteURL("github.com/terraform-aws-modules/terraform-aws-vpc")
+	require.NoError(t, err)
+
+	sources := map[string]bool{
+		"git::https://github.com/terraform-aws-modules/terraform-aws-vpc.git?ref=v1.0.0":   true,
+		"git::ssh://git@github.com/terraform-aws-modules/terraform-aws-vpc.git//modules/a": true,
+		"git@github.com:terraform-aws-modules/terraform-aws-vpc.git":                       true,
+		"git::https://GitHub.com/terraform-aws-modules/terraform-aws-vpc":                  true,
+		"git::https://github.com/terraform-aws-modules/terraform-aws-vpc-endpoints.git":    false,
+		"git::https://gitlab.com/terraform-aws-modules/terraform-aws-vpc.git":              false,
+	}
+
+	for source, expected := range sources {
+		remoteURL, err := ParseRemoteURL(source)
+		require.NoError(t, err, "parsing %s", source)
+		assert.Equal(t, expected, SameRepository(remoteURL, repository), "comparing %s", source)
+	}
+
+	_, err = ParseRemoteURL("./modules/local")
+	assert.Error(t, err, "local paths are not git repositories")
+}
+
+func TestResetBlockSources(t *testing.T) {
+	parser, errs := NewHclParser(writeTestFile(t, "main.tf", serverFixture))
+	require.Nil(t, errs)
+
+	sources, err := parser.FindGitSources(context.Background(), false)
+	require.NoError(t, err)
+	for _, source := range sources {
+		source := source
+		source.SetSourceVersion(semver.MustParse("v9.9.9"))
+		parser.UpdateBlockSource(&source)
+	}
+	assert.Equal(t, 2, strings.Count(string(parser.Bytes()), "ref=v9.9.9"))
+
+	parser.ResetBlockSources()
+	assert.Equal(t, serverFixture, string(parser.Bytes()), "resetting should discard every update")
+
+	vpc := sources[parser.filePath+" [vpc]"]
+	vpc.SetSourceVersion(semver.MustParse("v3.1.0"))
+	parser.UpdateBlockSource(&vpc)
+	assert.Equal(t, strings.Replace(serverFixture, "ref=v2.0.0", "ref=v3.1.0", 1), string(parser.Bytes()))
+}
+
+func TestRevert(t *testing.T) {
+	path := writeTestFile(t, "main.tf", serverFixture)
+	parser, errs := NewHclParser(path)
+	require.Nil(t, errs)
+
+	sources, err := parser.FindGitSources(context.Background(), false)
+	require.NoError(t, err)
+	vpc := sources[path+" [vpc]"]
+	vpc.SetSourceVersion(semver.MustParse("v3.1.0"))
+	parser.UpdateBlockSource(&vpc)
+	require.NoError(t, parser.Save(context.Background()))
+	require.NoError(t, ioutil.WriteFile(path, append(parser.Bytes(), "# formatted\n"...), 0600))
+
+	require.NoError(t, parser.Revert())
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, serverFixture, string(content), "the file should be as it was read, whatever changed since")
+}
+
+func TestSourceLines(t *testing.T) {
+	parser, errs := NewHclParserFromBytes("main.tf", []byte(serverFixture))
+	require.Nil(t, errs)
+
+	sources, err := parser.FindGitSources(context.Background(), false)
+	require.NoError(t, err)
+	for module, source := range sources {
+		line := strings.Split(serverFixture, "\n")[source.Line-1]
+		assert.Contains(t, line, "source", module)
+	}
+}
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+const (
+	// HookPreUpdate is the phase of hooks run before files are updated.
+	HookPreUpdate = "pre-update"
+
+	// HookPostUpdate is the phase of hooks run after files are updated.
+	HookPostUpdate = "post-update"
+)
+
+// HookEvent is passed to a hook as JSON on stdin, listing the files being updated, and the
+// changes planned to them.
+type HookEvent struct {
+	Phase   string    `json:"phase"`
+	Files   []string  `json:"files"`
+	Changes []*Change `json:"changes"`
+}
+
+// RunHook runs a hook command with sh, passing the event as JSON on stdin, and the files as
+// arguments, so a command such as `terraform fmt "$1"` can refer to them. The hook fails if
+// the command exits with a non-zero status, and is killed once the context is done.
+func RunHook(ctx context.Context, command string, event HookEvent, stdout io.Writer, stderr io.Writer) error {
+	input, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	args := append([]string{"-c", command, "tfmodref"}, event.Files...)
+	cmd := exec.CommandContext(ctx, "sh", args...) // #nosec G204 -- hooks are commands configured by the user
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s hook %q failed (%s)", event.Phase, command, err.Error())
+	}
+
+	return nil
+}
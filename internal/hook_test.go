@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunHook(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("hooks are run with sh, which isn't available")
+	}
+
+	event := HookEvent{
+		Phase: HookPostUpdate,
+		Files: []string{"network/main.tf"},
+		Changes: []*Change{
+			{Module: "network/main.tf [vpc]", File: "network/main.tf", From: "v2.0.0", To: "v3.1.0"},
+		},
+	}
+
+	var stdout, stderr bytes.Buffer
+	require.NoError(t, RunHook(context.Background(), `echo "$1"; cat`, event, &stdout, &stderr))
+
+	file, err := stdout.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "network/main.tf\n", file, "the files should be passed as arguments")
+
+	var received HookEvent
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &received), "the event should be passed as JSON on stdin")
+	assert.Equal(t, event, received)
+
+	err = RunHook(context.Background(), "echo failed >&2; exit 3", event, &stdout, &stderr)
+	assert.EqualError(t, err, `post-update hook "echo failed >&2; exit 3" failed (exit status 3)`)
+	assert.Equal(t, "failed\n", stderr.String())
+}
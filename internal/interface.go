@@ -0,0 +1,396 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	hcljson "github.com/hashicorp/hcl/v2/json"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Variable is a `variable` block of a module, with its type and default as written. A variable
+// without a default is required.
+type Variable struct {
+	Name      string `json:"name"`
+	Type      string `json:"type,omitempty"`
+	Default   string `json:"default,omitempty"`
+	Required  bool   `json:"required"`
+	Sensitive bool   `json:"sensitive,omitempty"`
+}
+
+// Output is an `output` block of a module.
+type Output struct {
+	Name      string `json:"name"`
+	Sensitive bool   `json:"sensitive,omitempty"`
+}
+
+// ModuleInterface is the variables a module accepts and the outputs it returns, by name.
+type ModuleInterface struct {
+	Variables map[string]Variable `json:"variables"`
+	Outputs   map[string]Output   `json:"outputs"`
+}
+
+// InterfaceChange is a variable or output added, removed or changed between two versions of a
+// module. Breaking changes are those which can fail a caller, i.e., removed variables and
+// outputs, and variables which are newly required.
+type InterfaceChange struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Change   string `json:"change"`
+	Detail   string `json:"detail,omitempty"`
+	Breaking bool   `json:"breaking"`
+}
+
+// String describes the change, e.g., removed: variable cidr (breaking).
+func (c InterfaceChange) String() string {
+	var notes []string
+	if c.Detail != "" {
+		notes = append(notes, c.Detail)
+	}
+
+	if c.Breaking {
+		notes = append(notes, "breaking")
+	}
+
+	if len(notes) == 0 {
+		return fmt.Sprintf("%s: %s %s", c.Change, c.Kind, c.Name)
+	}
+
+	return fmt.Sprintf("%s: %s %s (%s)", c.Change, c.Kind, c.Name, strings.Join(notes, ", "))
+}
+
+var interfaceSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "variable", LabelNames: []string{"name"}},
+		{Type: "output", LabelNames: []string{"name"}},
+	},
+}
+
+var variableSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{{Name: "type"}, {Name: "default"}, {Name: "sensitive"}},
+}
+
+var outputSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{{Name: "sensitive"}},
+}
+
+// IsModuleFile returns true if the named file is a terraform configuration file which is part
+// of a module, in either native or JSON syntax.
+func IsModuleFile(name string) bool {
+	return strings.HasSuffix(name, ".tf") || strings.HasSuffix(name, ".tf.json")
+}
+
+// ParseModuleInterface reads the variable and output blocks from the files of a module,
+// given by name.
+func ParseModuleInterface(files map[string][]byte) (*ModuleInterface, error) {
+	module := &ModuleInterface{Variables: make(map[string]Variable), Outputs: make(map[string]Output)}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		file, err := parseModuleFile(name, files[name])
+		if err != nil {
+			return nil, err
+		}
+
+		content, _, diags := file.Body.PartialContent(interfaceSchema)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("could not read %s (%s)", name, diags.Error())
+		}
+
+		for _, block := range content.Blocks {
+			switch block.Type {
+			case "variable":
+				attrs, _, diags := block.Body.PartialContent(variableSchema)
+				if diags.HasErrors() {
+					return nil, fmt.Errorf("could not read variable %s in %s (%s)", block.Labels[0], name, diags.Error())
+				}
+
+				variable := Variable{Name: block.Labels[0], Required: true}
+				if attr, ok := attrs.Attributes["type"]; ok {
+					variable.Type = expressionText(files[name], attr.Expr)
+				}
+
+				if attr, ok := attrs.Attributes["default"]; ok {
+					variable.Default = expressionText(files[name], attr.Expr)
+					variable.Required = false
+				}
+
+				if attr, ok := attrs.Attributes["sensitive"]; ok {
+					variable.Sensitive = expressionText(files[name], attr.Expr) == "true"
+				}
+
+				module.Variables[variable.Name] = variable
+			case "output":
+				attrs, _, diags := block.Body.PartialContent(outputSchema)
+				if diags.HasErrors() {
+					return nil, fmt.Errorf("could not read output %s in %s (%s)", block.Labels[0], name, diags.Error())
+				}
+
+				output := Output{Name: block.Labels[0]}
+				if attr, ok := attrs.Attributes["sensitive"]; ok {
+					output.Sensitive = expressionText(files[name], attr.Expr) == "true"
+				}
+
+				module.Outputs[output.Name] = output
+			}
+		}
+	}
+
+	return module, nil
+}
+
+func parseModuleFile(name string, raw []byte) (*hcl.File, error) {
+	var file *hcl.File
+	var diags hcl.Diagnostics
+	if isJSONFile(name) {
+		file, diags = hcljson.Parse(raw, filepath.Base(name))
+	} else {
+		file, diags = hclsyntax.ParseConfig(raw, filepath.Base(name), hcl.InitialPos)
+	}
+
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("could not parse %s (%s)", name, diags.Error())
+	}
+
+	return file, nil
+}
+
+// expressionText describes an expression so that the same value written in either syntax is
+// described alike. Strings are their value, other constant values are encoded as JSON, and
+// anything else, such as a type constraint, is the expression as written.
+func expressionText(src []byte, expr hcl.Expression) string {
+	value, diags := expr.Value(nil)
+	if !diags.HasErrors() && value.IsWhollyKnown() {
+		if value.Type() == cty.String && !value.IsNull() {
+			return value.AsString()
+		}
+
+		if encoded, err := (ctyjson.SimpleJSONValue{Value: value}).MarshalJSON(); err == nil {
+			return string(encoded)
+		}
+	}
+
+	return strings.Join(strings.Fields(string(expr.Range().SliceBytes(src))), " ")
+}
+
+// CheckArguments returns the problems with calling the module with the named arguments, i.e.,
+// arguments which aren't variables of the module, and required variables which aren't set.
+func (m *ModuleInterface) CheckArguments(arguments []string) []string {
+	var problems []string
+	set := make(map[string]bool)
+	for _, argument := range arguments {
+		set[argument] = true
+		if _, ok := m.Variables[argument]; !ok {
+			problems = append(problems, fmt.Sprintf("argument %s is not a variable of the module", argument))
+		}
+	}
+
+	var required []string
+	for name, variable := range m.Variables {
+		if variable.Required && !set[name] {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+
+	for _, name := range required {
+		problems = append(problems, fmt.Sprintf("required variable %s is not set", name))
+	}
+
+	return problems
+}
+
+// CheckInputs returns the problems with calling the module from terragrunt with the named
+// inputs, i.e., inputs which aren't variables of the module. Terragrunt passes inputs as TF_VAR_
+// environment variables, so these are ignored rather than failing, and required variables may
+// be set elsewhere, such as by tfvars files, so aren't checked.
+func (m *ModuleInterface) CheckInputs(inputs []string) []string {
+	var problems []string
+	for _, input := range inputs {
+		if _, ok := m.Variables[input]; !ok {
+			problems = append(problems, fmt.Sprintf("input %s is not a variable of the module", input))
+		}
+	}
+
+	return problems
+}
+
+// DiffInterfaces returns the changes to the variables and outputs of a module between two
+// versions, ordered by kind then name.
+func DiffInterfaces(from *ModuleInterface, to *ModuleInterface) []InterfaceChange {
+	var changes []InterfaceChange
+
+	for name, old := range from.Variables {
+		updated, ok := to.Variables[name]
+		if !ok {
+			changes = append(changes, InterfaceChange{Kind: "variable", Name: name, Change: "removed", Breaking: true})
+			continue
+		}
+
+		var details []string
+		if old.Type != updated.Type {
+			details = append(details, fmt.Sprintf("type: %s -> %s", describe(old.Type), describe(updated.Type)))
+		}
+
+		if !old.Required && updated.Required {
+			details = append(details, "now required")
+		} else if old.Required && !updated.Required {
+			details = append(details, "now optional")
+		} else if old.Default != updated.Default {
+			details = append(details, fmt.Sprintf("default: %s -> %s", old.Default, updated.Default))
+		}
+
+		if old.Sensitive != updated.Sensitive {
+			details = append(details, fmt.Sprintf("sensitive: %t -> %t", old.Sensitive, updated.Sensitive))
+		}
+
+		if len(details) > 0 {
+			changes = append(changes, InterfaceChange{
+				Kind:     "variable",
+				Name:     name,
+				Change:   "changed",
+				Detail:   strings.Join(details, ", "),
+				Breaking: !old.Required && updated.Required,
+			})
+		}
+	}
+
+	for name, variable := range to.Variables {
+		if _, ok := from.Variables[name]; !ok {
+			change := InterfaceChange{Kind: "variable", Name: name, Change: "added", Breaking: variable.Required}
+			if variable.Required {
+				change.Detail = "required"
+			}
+
+			changes = append(changes, change)
+		}
+	}
+
+	for name, old := range from.Outputs {
+		updated, ok := to.Outputs[name]
+		if !ok {
+			changes = append(changes, InterfaceChange{Kind: "output", Name: name, Change: "removed", Breaking: true})
+		} else if old.Sensitive != updated.Sensitive {
+			changes = append(changes, InterfaceChange{Kind: "output", Name: name, Change: "changed", Detail: fmt.Sprintf("sensitive: %t -> %t", old.Sensitive, updated.Sensitive)})
+		}
+	}
+
+	for name := range to.Outputs {
+		if _, ok := from.Outputs[name]; !ok {
+			changes = append(changes, InterfaceChange{Kind: "output", Name: name, Change: "added"})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Kind != changes[j].Kind {
+			return changes[i].Kind > changes[j].Kind
+		}
+
+		return changes[i].Name < changes[j].Name
+	})
+
+	return changes
+}
+
+// describe returns the given type, or any where no type is set.
+func describe(typ string) string {
+	if typ == "" {
+		return "any"
+	}
+
+	return typ
+}
+
+// HasBreakingChanges returns true if any of the changes are breaking.
+func HasBreakingChanges(changes []InterfaceChange) bool {
+	for _, change := range changes {
+		if change.Breaking {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FetchModuleFiles returns the terraform files of the module in the subdirectory of the
+// repository, or at its root, at the given version, keyed by their path in the repository.
+// Only the files of the module itself are returned, not those of nested directories.
+func FetchModuleFiles(ctx context.Context, remoteURL *url.URL, version *semver.Version, subdirectory string) (map[string][]byte, error) {
+	tree, err := FetchTree(ctx, remoteURL, version)
+	if err != nil {
+		return nil, err
+	}
+
+	if subdirectory != "" {
+		if tree, err = tree.Tree(path.Clean(subdirectory)); err != nil {
+			return nil, fmt.Errorf("subdirectory %s does not exist in version %s", subdirectory, version.Original())
+		}
+	}
+
+	files := make(map[string][]byte)
+	for _, entry := range tree.Entries {
+		if !entry.Mode.IsFile() || !IsModuleFile(entry.Name) {
+			continue
+		}
+
+		file, err := tree.TreeEntryFile(&entry)
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := file.Contents()
+		if err != nil {
+			return nil, err
+		}
+
+		files[path.Join(subdirectory, entry.Name)] = []byte(content)
+	}
+
+	return files, nil
+}
+
+// FetchModuleInterface returns the interface of the module in the subdirectory of the
+// repository, or at its root, at the given version.
+func FetchModuleInterface(ctx context.Context, remoteURL *url.URL, version *semver.Version, subdirectory string) (*ModuleInterface, error) {
+	files, err := FetchModuleFiles(ctx, remoteURL, version, subdirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseModuleInterface(files)
+}
+
+// InterfaceChanges returns the changes to the interface of the module a source refers to,
+// between its local version and the given version.
+func (gs *GitSource) InterfaceChanges(ctx context.Context, version *semver.Version) ([]InterfaceChange, error) {
+	if gs.localVersion == nil {
+		return nil, errors.New("the local version is not a semantic version")
+	}
+
+	from, err := FetchModuleInterface(ctx, gs.RemoteURL, gs.localVersion, gs.Subdirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := FetchModuleInterface(ctx, gs.RemoteURL, version, gs.Subdirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	return DiffInterfaces(from, to), nil
+}
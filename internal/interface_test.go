@@ -0,0 +1,220 @@
+package internal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const variablesV1 = `variable "cidr" {
+  type    = string
+  default = "10.0.0.0/16"
+}
+
+variable "name" {
+  type = string
+}
+
+variable "tags" {
+  type    = map(string)
+  default = {}
+}
+`
+
+const variablesV2 = `variable "cidr" {
+  type = string
+}
+
+variable "tags" {
+  type    = map(any)
+  default = { Name = "vpc" }
+}
+
+variable "azs" {
+  type    = list(string)
+  default = []
+}
+`
+
+func TestParseModuleInterface(t *testing.T) {
+	module, err := ParseModuleInterface(map[string][]byte{
+		"variables.tf": []byte(variablesV1),
+		"outputs.tf":   []byte(`output "vpc_id" { value = aws_vpc.this.id }`),
+		"secrets.tf.json": []byte(`{
+  "variable": {"password": {"type": "string", "sensitive": true, "default": null}},
+  "output": {"password": {"value": "${var.password}", "sensitive": true}}
+}`),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]Variable{
+		"cidr":     {Name: "cidr", Type: "string", Default: "10.0.0.0/16"},
+		"name":     {Name: "name", Type: "string", Required: true},
+		"tags":     {Name: "tags", Type: "map(string)", Default: "{}"},
+		"password": {Name: "password", Type: "string", Default: "null", Sensitive: true},
+	}, module.Variables)
+	assert.Equal(t, map[string]Output{
+		"vpc_id":   {Name: "vpc_id"},
+		"password": {Name: "password", Sensitive: true},
+	}, module.Outputs)
+
+	_, err = ParseModuleInterface(map[string][]byte{"main.tf": []byte(`variable "cidr" {`)})
+	assert.Error(t, err)
+}
+
+func TestDiffInterfaces(t *testing.T) {
+	from, err := ParseModuleInterface(map[string][]byte{
+		"variables.tf": []byte(variablesV1),
+		"outputs.tf":   []byte("output \"vpc_id\" { value = 1 }\noutput \"arn\" { value = 1 }"),
+	})
+	require.NoError(t, err)
+
+	to, err := ParseModuleInterface(map[string][]byte{
+		"variables.tf":    []byte(variablesV2 + "variable \"region\" {}\n"),
+		"outputs.tf.json": []byte(`{"output": {"id": {"value": 1}, "arn": {"value": 1, "sensitive": true}}}`),
+	})
+	require.NoError(t, err)
+
+	var described []string
+	changes := DiffInterfaces(from, to)
+	for _, change := range changes {
+		described = append(described, change.String())
+	}
+
+	assert.Equal(t, []string{
+		"added: variable azs",
+		"changed: variable cidr (now required, breaking)",
+		"removed: variable name (breaking)",
+		"added: variable region (required, breaking)",
+		`changed: variable tags (type: map(string) -> map(any), default: {} -> {"Name":"vpc"})`,
+		"changed: output arn (sensitive: false -> true)",
+		"added: output id",
+		"removed: output vpc_id (breaking)",
+	}, described)
+	assert.True(t, HasBreakingChanges(changes))
+	assert.Empty(t, DiffInterfaces(from, from))
+}
+
+func TestInterfaceChanges(t *testing.T) {
+	remoteURL := newModuleRepository(t,
+		moduleRelease{"v1.0.0", map[string]string{"modules/vpc/variables.tf": variablesV1, "modules/vpc/nested/main.tf": `variable "ignored" {}`}},
+		moduleRelease{"v2.0.0", map[string]string{"modules/vpc/variables.tf": variablesV2, "README.md": "# vpc\n"}},
+	)
+
+	files, err := FetchModuleFiles(context.Background(), remoteURL, semver.MustParse("v1.0.0"), "modules/vpc")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"modules/vpc/variables.tf": []byte(variablesV1)}, files, "nested directories aren't part of the module")
+
+	source := &GitSource{RemoteURL: remoteURL, Subdirectory: "modules/vpc", localVersion: semver.MustParse("v1.0.0")}
+	changes, err := source.InterfaceChanges(context.Background(), semver.MustParse("v2.0.0"))
+	require.NoError(t, err)
+	assert.Len(t, changes, 4)
+
+	source.Subdirectory = "modules/network"
+	_, err = source.InterfaceChanges(context.Background(), semver.MustParse("v2.0.0"))
+	assert.EqualError(t, err, "subdirectory modules/network does not exist in version v1.0.0")
+
+	_, err = (&GitSource{RemoteURL: remoteURL, LocalVersionIsMain: true}).InterfaceChanges(context.Background(), semver.MustParse("v2.0.0"))
+	assert.Error(t, err)
+}
+
+func TestSourceArguments(t *testing.T) {
+	arguments := func(name string, content string) []string {
+		parser, errs := NewHclParserFromBytes(name, []byte(content))
+		require.Nil(t, errs)
+		sources, err := parser.FindGitSources(context.Background(), false)
+		require.NoError(t, err)
+		require.Len(t, sources, 1)
+		for _, source := range sources {
+			return source.Arguments
+		}
+
+		return nil
+	}
+
+	assert.Equal(t, []string{"cidr", "name"}, arguments("main.tf", `module "vpc" {
+  source = "github.com/org/vpc?ref=v1.0.0"
+  count  = 1
+  name   = "vpc"
+  cidr   = var.cidr
+}`))
+	assert.Equal(t, []string{"name"}, arguments("main.tf.json", `{"module": {"vpc": {"source": "github.com/org/vpc?ref=v1.0.0", "name": "vpc", "for_each": {}}}}`))
+	assert.Equal(t, []string{"cidr", "name"}, arguments("terragrunt.hcl", `terraform {
+  source = "github.com/org/vpc?ref=v1.0.0"
+}
+
+inputs = {
+  name   = "vpc"
+  "cidr" = "10.0.0.0/16"
+}`))
+	assert.Equal(t, []string{}, arguments("terragrunt.hcl", `terraform {
+  source = "github.com/org/vpc?ref=v1.0.0"
+}`))
+	assert.Nil(t, arguments("terragrunt.hcl", `include "root" {
+  path = find_in_parent_folders()
+}
+
+terraform {
+  source = "github.com/org/vpc?ref=v1.0.0"
+}
+
+inputs = {
+  name = "vpc"
+}`), "inputs may be merged with those of included files")
+}
+
+func TestCheckArguments(t *testing.T) {
+	module, err := ParseModuleInterface(map[string][]byte{"variables.tf": []byte(variablesV2 + "variable \"region\" {}\n")})
+	require.NoError(t, err)
+
+	assert.Empty(t, module.CheckArguments([]string{"cidr", "region", "tags"}))
+	assert.Equal(t, []string{
+		"argument name is not a variable of the module",
+		"required variable cidr is not set",
+		"required variable region is not set",
+	}, module.CheckArguments([]string{"name"}))
+
+	assert.Equal(t, []string{"input name is not a variable of the module"}, module.CheckInputs([]string{"name", "tags"}), "missing required variables shouldn't be reported for terragrunt inputs")
+}
+
+func TestPolicyPlanChecksArguments(t *testing.T) {
+	ctx := context.Background()
+	source := GitSource{
+		RemoteURL: newModuleRepository(t,
+			moduleRelease{"v1.0.0", map[string]string{"variables.tf": variablesV1}},
+			moduleRelease{"v2.0.0", map[string]string{"variables.tf": variablesV2}},
+		),
+		localVersion: semver.MustParse("v1.0.0"),
+		Arguments:    []string{"name"},
+	}
+	source.setRemoteTags(semver.Collection{semver.MustParse("v1.0.0"), semver.MustParse("v2.0.0")})
+
+	change := Policy{CheckArguments: true}.Plan(ctx, "main.tf [vpc]", &source, latest)
+	require.True(t, change.IsUpdate())
+	assert.Equal(t, []string{
+		"argument name is not a variable of the module in version v2.0.0",
+		"required variable cidr is not set in version v2.0.0",
+	}, change.Warnings)
+
+	change = Policy{CheckArguments: true, BlockOnArguments: true}.Plan(ctx, "main.tf [vpc]", &source, latest)
+	assert.Equal(t, "arguments don't match the variables of version v2.0.0, argument name is not a variable of the module, required variable cidr is not set", change.Skipped)
+
+	source.Arguments = []string{"cidr", "tags"}
+	change = Policy{CheckArguments: true, BlockOnArguments: true}.Plan(ctx, "main.tf [vpc]", &source, latest)
+	assert.True(t, change.IsUpdate())
+	assert.Empty(t, change.Warnings)
+
+	source.Arguments = nil
+	change = Policy{CheckArguments: true, BlockOnArguments: true}.Plan(ctx, "main.tf [vpc]", &source, latest)
+	assert.True(t, change.IsUpdate(), "sources whose arguments can't be known shouldn't be blocked")
+	assert.Len(t, change.Warnings, 1)
+
+	source.Arguments = []string{"name"}
+	source.terragrunt = true
+	change = Policy{CheckArguments: true, BlockOnArguments: true}.Plan(ctx, "terragrunt.hcl", &source, latest)
+	assert.True(t, change.IsUpdate(), "terragrunt inputs shouldn't block, as unknown inputs are ignored and variables may be set elsewhere")
+	assert.Equal(t, []string{"input name is not a variable of the module in version v2.0.0"}, change.Warnings)
+}
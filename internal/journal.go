@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jbrailsford/tfmodref/util"
+)
+
+// journalIDFormat is the timestamp format used for journal IDs, which sort chronologically.
+const journalIDFormat = "20060102T150405.000000000Z"
+
+// Journal records the changes made to files by a single update run, so that they can be undone.
+type Journal struct {
+	ID      string        `json:"id"`
+	Created time.Time     `json:"created"`
+	Files   []JournalFile `json:"files"`
+	dir     string
+}
+
+// JournalFile holds the original contents of a changed file, a hash of the contents written,
+// and the individual source changes which were made.
+type JournalFile struct {
+	Path          string          `json:"path"`
+	Mode          os.FileMode     `json:"mode"`
+	Original      []byte          `json:"original"`
+	WrittenSHA256 string          `json:"written_sha256"`
+	Changes       []JournalChange `json:"changes"`
+}
+
+// JournalChange is a single source change, From and To hold the source literals as written.
+type JournalChange struct {
+	Module string `json:"module"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// DefaultJournalDir returns the directory journals are kept in when no other is configured.
+func DefaultJournalDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "tfmodref", "journal")
+}
+
+// NewJournal creates an empty journal, which is only written to dir once a change is recorded.
+func NewJournal(dir string) *Journal {
+	now := time.Now().UTC()
+
+	return &Journal{
+		ID:      now.Format(journalIDFormat),
+		Created: now,
+		dir:     dir,
+	}
+}
+
+// LoadJournals reads every journal within dir, oldest first.
+func LoadJournals(dir string) ([]*Journal, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(paths)
+
+	var journals []*Journal
+	for _, path := range paths {
+		raw, err := ioutil.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return nil, err
+		}
+
+		journal := &Journal{dir: dir}
+		if err := json.Unmarshal(raw, journal); err != nil {
+			return nil, fmt.Errorf("invalid journal %s (%s)", path, err.Error())
+		}
+
+		journals = append(journals, journal)
+	}
+
+	return journals, nil
+}
+
+// Record adds a changed file to the journal and writes the journal, so that it is kept up to
+// date even if the run does not complete.
+func (j *Journal) Record(path string, mode os.FileMode, original []byte, written []byte, changes []JournalChange) error {
+	j.Files = append(j.Files, JournalFile{
+		Path:          path,
+		Mode:          mode,
+		Original:      original,
+		WrittenSHA256: hashContents(written),
+		Changes:       changes,
+	})
+
+	raw, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(j.dir, 0700); err != nil {
+		return err
+	}
+
+	return util.WriteFileAtomic(j.path(), raw, 0600)
+}
+
+// Remove deletes the journal, once it has been undone.
+func (j *Journal) Remove() error {
+	err := os.Remove(j.path())
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (j *Journal) path() string {
+	return filepath.Join(j.dir, j.ID+".json")
+}
+
+// Undo restores a file recorded in the journal. If the file has not changed since it was
+// written the original contents are restored exactly, otherwise each recorded source change
+// is reverted individually, and any sources which no longer match what was written are
+// returned as skipped.
+func (f *JournalFile) Undo(ctx context.Context) (skipped []JournalChange, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	current, err := ioutil.ReadFile(filepath.Clean(f.Path))
+	if err != nil {
+		return nil, err
+	}
+
+	if hashContents(current) == f.WrittenSHA256 {
+		return nil, util.WriteFileAtomic(f.Path, f.Original, f.Mode)
+	}
+
+	parser, errs := NewHclParser(f.Path)
+	if errs != nil {
+		return nil, fmt.Errorf("could not parse %s (%s)", f.Path, joinErrors(errs))
+	}
+
+	sources, err := parser.FindGitSources(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	reverted := 0
+	for _, change := range f.Changes {
+		source, ok := sources[change.Module]
+		if !ok || !source.IsEvaluated() || source.HCLSafeSourceURL() != change.To {
+			skipped = append(skipped, change)
+			continue
+		}
+
+		source.literal = change.From
+		parser.UpdateBlockSource(&source)
+		reverted++
+	}
+
+	if reverted == 0 {
+		return skipped, nil
+	}
+
+	return skipped, parser.Save(ctx)
+}
+
+func hashContents(contents []byte) string {
+	sum := sha256.Sum256(contents)
+
+	return hex.EncodeToString(sum[:])
+}
+
+func joinErrors(errs []error) string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "; ")
+}
@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const journalFixture = `module "vpc" {
+  source = "git::https://github.com/terraform-aws-modules/terraform-aws-vpc.git?ref=v2.0.0"
+}
+
+module "dns" {
+  source = "git::https://example.com/org/dns.git?ref=v1.0.0"
+}
+`
+
+// updateAndRecord updates every source in the file to the given version, recording the
+// changes in a new journal.
+func updateAndRecord(t *testing.T, path string, journalDir string, version string) *Journal {
+	parser, errs := NewHclParser(path)
+	require.Nil(t, errs)
+
+	sources, err := parser.FindGitSources(context.Background(), false)
+	require.NoError(t, err)
+
+	var changes []JournalChange
+	for module, source := range sources {
+		source := source
+		from := source.HCLSafeSourceURL()
+		source.SetSourceVersion(semver.MustParse(version))
+		parser.UpdateBlockSource(&source)
+		changes = append(changes, JournalChange{Module: module, From: from, To: source.HCLSafeSourceURL()})
+	}
+
+	require.NoError(t, parser.Save(context.Background()))
+
+	journal := NewJournal(journalDir)
+	require.NoError(t, journal.Record(path, 0600, parser.Original(), parser.Bytes(), changes))
+
+	return journal
+}
+
+func TestJournalUndoRestoresUnchangedFile(t *testing.T) {
+	path := writeTestFile(t, "main.tf", journalFixture)
+	journalDir := t.TempDir()
+	updateAndRecord(t, path, journalDir, "v3.0.0")
+
+	journals, err := LoadJournals(journalDir)
+	require.NoError(t, err)
+	require.Len(t, journals, 1)
+	require.Len(t, journals[0].Files, 1)
+
+	skipped, err := journals[0].Files[0].Undo(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, skipped)
+
+	raw, _ := ioutil.ReadFile(path)
+	assert.Equal(t, journalFixture, string(raw), "file should be restored exactly")
+
+	require.NoError(t, journals[0].Remove())
+	journals, _ = LoadJournals(journalDir)
+	assert.Empty(t, journals, "removed journals should no longer be listed")
+}
+
+func TestJournalUndoRevertsSourcesInModifiedFile(t *testing.T) {
+	path := writeTestFile(t, "main.tf", journalFixture)
+	journal := updateAndRecord(t, path, t.TempDir(), "v3.0.0")
+
+	// Simulate a later edit, one unrelated and one to a source changed by the update.
+	raw, _ := ioutil.ReadFile(path)
+	edited := "# edited\n" + strings.Replace(string(raw), "dns.git?ref=v3.0.0", "dns.git?ref=v4.0.0", 1)
+	require.NoError(t, ioutil.WriteFile(path, []byte(edited), 0600))
+
+	skipped, err := journal.Files[0].Undo(context.Background())
+	require.NoError(t, err)
+	require.Len(t, skipped, 1, "sources changed since the update should be skipped")
+	assert.Contains(t, skipped[0].Module, "[dns]")
+
+	raw, _ = ioutil.ReadFile(path)
+	assert.Contains(t, string(raw), "# edited\n", "later edits should be kept")
+	assert.Contains(t, string(raw), "terraform-aws-vpc.git?ref=v2.0.0", "sources changed by the update should be reverted")
+	assert.Contains(t, string(raw), "dns.git?ref=v4.0.0")
+}
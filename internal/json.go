@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/hashicorp/hcl/v2"
+	hcljson "github.com/hashicorp/hcl/v2/json"
+)
+
+// JSONFileSuffix denotes a file written in the Terraform JSON syntax rather than native HCL.
+const JSONFileSuffix string = ".json"
+
+// isJSONFile returns true if the file at the given path uses the JSON syntax, e.g., main.tf.json.
+func isJSONFile(filePath string) bool {
+	return strings.HasSuffix(filePath, JSONFileSuffix)
+}
+
+// parseJSONSources finds the source attributes of blocks within a JSON syntax file, which
+// hclwrite is unable to read.
+func parseJSONSources(filePath string, raw []byte) ([]sourceAttribute, []error) {
+	file, diags := hcljson.Parse(raw, filepath.Base(filePath))
+	if diags.HasErrors() {
+		return nil, diags.Errs()
+	}
+
+	content, _, diags := file.Body.PartialContent(&hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: TerraformBlockType, LabelNames: []string{"name"}},
+			{Type: TerragruntBlockType},
+		},
+	})
+	if diags.HasErrors() {
+		return nil, diags.Errs()
+	}
+
+	var sources []sourceAttribute
+	for _, block := range content.Blocks {
+		attrs, _, diags := block.Body.PartialContent(&hcl.BodySchema{
+			Attributes: []hcl.AttributeSchema{{Name: "source"}},
+		})
+		if diags.HasErrors() {
+			continue
+		}
+
+		attr, ok := attrs.Attributes["source"]
+		if !ok {
+			continue
+		}
+
+		source, err := newSourceAttribute(raw, block.Labels, attr.Expr, unescapeJSON)
+		if err != nil {
+			continue
+		}
+
+		source.line = attr.Range.Start.Line
+		if block.Type == TerraformBlockType {
+			source.arguments = jsonModuleArguments(block.Body)
+		} else {
+			source.terragrunt = true
+		}
+
+		sources = append(sources, source)
+	}
+
+	return sources, nil
+}
+
+// jsonModuleArguments returns the names of the variables a JSON syntax module block sets, or
+// nil if they can't be read.
+func jsonModuleArguments(body hcl.Body) []string {
+	attrs, diags := body.JustAttributes()
+	if diags.HasErrors() {
+		return nil
+	}
+
+	arguments := []string{}
+	for name := range attrs {
+		if !moduleMetaArguments[name] {
+			arguments = append(arguments, name)
+		}
+	}
+	sort.Strings(arguments)
+
+	return arguments
+}
+
+// unescapeJSON decodes the JSON escape sequence at the start of s, if any, including surrogate
+// pairs such as those encoding/json writes for characters outside the basic multilingual plane.
+func unescapeJSON(s string) (int, string) {
+	if len(s) < 2 || s[0] != '\\' {
+		return 0, ""
+	}
+
+	switch s[1] {
+	case '"', '\\', '/':
+		return 2, s[1:2]
+	case 'b':
+		return 2, "\b"
+	case 'f':
+		return 2, "\f"
+	case 'n':
+		return 2, "\n"
+	case 'r':
+		return 2, "\r"
+	case 't':
+		return 2, "\t"
+	case 'u':
+		n, char := unescapeUnicode(s, 4)
+		if n == 0 {
+			return 0, ""
+		}
+
+		high, _ := strconv.ParseUint(s[2:6], 16, 32)
+		if utf16.IsSurrogate(rune(high)) && len(s) >= 12 && s[6:8] == `\u` {
+			if low, err := strconv.ParseUint(s[8:12], 16, 32); err == nil {
+				return 12, string(utf16.DecodeRune(rune(high), rune(low)))
+			}
+		}
+
+		return n, char
+	}
+
+	return 0, ""
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const jsonConfigFixture = `{
+    "module": {
+        "vpc": {
+            "source": "git::https://github.com/terraform-aws-modules/terraform-aws-vpc.git?ref=v2.0.0",
+            "cidr": "10.0.0.0/16"
+        },
+        "local": {
+            "source": "./modules/local"
+        },
+        "network": {
+            "name": "network",
+            "source": "git::https://example.com/org/network.git//modules/net?ref=v1.0.0&depth=1"
+        }
+    }
+}
+`
+
+func writeTestFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+
+	return path
+}
+
+func TestJSONSourcesAreFound(t *testing.T) {
+	path := writeTestFile(t, "main.tf.json", jsonConfigFixture)
+	parser, errs := NewHclParser(path)
+	require.Nil(t, errs)
+
+	sources, err := parser.FindGitSources(context.Background(), false)
+	require.NoError(t, err)
+
+	require.Contains(t, sources, path+" [vpc]")
+	require.Contains(t, sources, path+" [network]")
+	assert.NotContains(t, sources, path+" [local]", "local module sources should be ignored")
+
+	vpc := sources[path+" [vpc]"]
+	assert.Equal(t, "v2.0.0", vpc.LocalVersionString())
+	assert.Equal(t, "https://github.com/terraform-aws-modules/terraform-aws-vpc.git", vpc.RemoteURL.String())
+}
+
+func TestJSONSourceUpdatesPreserveLayout(t *testing.T) {
+	path := writeTestFile(t, "main.tf.json", jsonConfigFixture)
+	parser, errs := NewHclParser(path)
+	require.Nil(t, errs)
+
+	sources, err := parser.FindGitSources(context.Background(), false)
+	require.NoError(t, err)
+
+	for _, name := range []string{path + " [vpc]", path + " [network]"} {
+		source := sources[name]
+		source.SetSourceVersion(semver.MustParse("v3.0.0"))
+		parser.UpdateBlockSource(&source)
+	}
+
+	require.NoError(t, parser.Save(context.Background()))
+
+	raw, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+
+	expected := jsonConfigFixture
+	expected = replaceOnce(t, expected, "terraform-aws-vpc.git?ref=v2.0.0", "terraform-aws-vpc.git?ref=v3.0.0")
+	expected = replaceOnce(t, expected, "network.git//modules/net?ref=v1.0.0&depth=1", "network.git//modules/net?ref=v3.0.0&depth=1")
+	assert.Equal(t, expected, string(raw), "only the source values should change")
+}
+
+func replaceOnce(t *testing.T, s string, old string, new string) string {
+	replaced := strings.Replace(s, old, new, 1)
+	require.NotEqual(t, s, replaced, "expected %s to be present", old)
+
+	return replaced
+}
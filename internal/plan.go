@@ -0,0 +1,281 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"github.com/jbrailsford/tfmodref/util"
+)
+
+// Resolver chooses the version a source should be updated to, returning nil if it should be
+// left as it is, or an error giving the reason no version could be chosen. Resolvers should only
+// choose from the remote versions of the source, as where the chosen version fails the policy
+// they may be asked to choose again from only the versions below it.
+type Resolver func(source *GitSource) (*semver.Version, error)
+
+// Policy holds the rules a planned update must satisfy, whichever version is chosen for it.
+type Policy struct {
+	AllowDowngrades    bool
+	VersionUnversioned bool
+	MinAge             time.Duration
+	Verifier           *TagVerifier
+
+	// CheckSubdirectory skips updates to versions in which the subdirectory of the source
+	// doesn't exist, or with SubdirectoryFallback, updates to the highest version below the
+	// chosen version which still has it.
+	CheckSubdirectory    bool
+	SubdirectoryFallback bool
+
+	// CheckArguments compares the arguments of the calling module block with the variables
+	// of the chosen version, warning of arguments which aren't variables and required variables
+	// which aren't set, or with BlockOnArguments, skipping the update.
+	CheckArguments   bool
+	BlockOnArguments bool
+
+	// CheckRequirements skips updates to versions whose terraform or provider requirements
+	// conflict with those of the root module, i.e., the module in the directory of the file
+	// calling it.
+	CheckRequirements bool
+}
+
+// Change is the planned update of a single source, either to a new version, or skipped with
+// the reason why.
+type Change struct {
+	Module     string `json:"module"`
+	File       string `json:"file"`
+	Repository string `json:"repository"`
+	From       string `json:"from"`
+	To         string `json:"to,omitempty"`
+	Skipped    string `json:"skipped,omitempty"`
+
+	// Warnings are problems found with an update which don't prevent it.
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Source and Target are the source to update, and the version to update it to.
+	Source *GitSource      `json:"-"`
+	Target *semver.Version `json:"-"`
+
+	// RemoteError is set when the change was skipped as the remote versions of the source,
+	// or their release dates, could not be retrieved, or the source itself couldn't be evaluated.
+	RemoteError error `json:"-"`
+}
+
+// IsUpdate returns true if the source is planned to be updated, rather than skipped.
+func (c *Change) IsUpdate() bool {
+	return c.Skipped == ""
+}
+
+// Plan decides whether, and to which version, the named source should be updated. The version
+// is chosen by resolve, then checked against the policy. Nil is returned if the source is
+// already on the chosen version, or no version was chosen.
+func (p Policy) Plan(ctx context.Context, module string, source *GitSource, resolve Resolver) *Change {
+	change := &Change{
+		Module: module,
+		File:   source.FilePath,
+		From:   source.LocalVersionString(),
+		Source: source,
+	}
+
+	skip := func(reason string, params ...interface{}) *Change {
+		change.Skipped = fmt.Sprintf(reason, params...)
+		return change
+	}
+
+	if !source.IsEvaluated() {
+		change.RemoteError = source.UpdateError
+		return skip("%s", source.UpdateError.Error())
+	}
+
+	change.Repository = source.RemoteURL.String()
+
+	if !source.IsResolved() {
+		change.RemoteError = source.RemoteError
+		return skip("could not retrieve remote versions")
+	}
+
+	if source.AllVersionsYanked() {
+		return skip("no unyanked versions")
+	}
+
+	if p.MinAge > 0 && len(source.RemoteVersions) > 0 {
+		if err := source.UpdateReleaseDates(ctx, source.NewerVersions()...); err != nil {
+			change.RemoteError = err
+			return skip("could not retrieve release dates")
+		}
+
+		source.ExcludeReleasedAfter(time.Now().Add(-p.MinAge))
+		if source.LatestRemoteVersion == nil {
+			minAge := util.Duration(p.MinAge)
+			return skip("no version was released more than %s ago", minAge.String())
+		}
+	}
+
+	target, err := resolve(source)
+	if err != nil {
+		return skip("%s", err.Error())
+	}
+
+	if target == nil || source.IsVersion(target) {
+		return nil
+	}
+
+	change.Target = target
+	change.To = target.Original()
+
+	if source.IsUnversioned() && !p.VersionUnversioned {
+		return skip("unversioned module tracking %s, to force versioning re-run with --version-unversioned", source.LocalVersionString())
+	}
+
+	if source.WouldForceDowngrade(target) && !p.AllowDowngrades {
+		return skip("target version %s is less than current version %s", target, source.LocalVersionString())
+	}
+
+	if source.UpdateError != nil {
+		return skip("%s", source.UpdateError.Error())
+	}
+
+	chosen, reason, err := p.choose(ctx, source, target, resolve)
+	if chosen == nil {
+		change.RemoteError = err
+		return skip("%s", reason)
+	}
+
+	target = chosen
+	change.Target = target
+	change.To = target.Original()
+
+	if p.CheckArguments && source.Arguments == nil {
+		change.Warnings = append(change.Warnings, "arguments can't be checked, as they may be set outside of this file")
+	} else if p.CheckArguments {
+		module, err := FetchModuleInterface(ctx, source.RemoteURL, target, source.Subdirectory)
+		if err != nil {
+			change.RemoteError = err
+			return skip("could not read the variables of version %s", target.Original())
+		}
+
+		var problems []string
+		if source.terragrunt {
+			// Terragrunt ignores unknown inputs, so they're only ever reported as warnings.
+			problems = module.CheckInputs(source.Arguments)
+		} else if problems = module.CheckArguments(source.Arguments); len(problems) > 0 && p.BlockOnArguments {
+			return skip("arguments don't match the variables of version %s, %s", target.Original(), strings.Join(problems, ", "))
+		}
+
+		for _, problem := range problems {
+			change.Warnings = append(change.Warnings, fmt.Sprintf("%s in version %s", problem, target.Original()))
+		}
+	}
+
+	if p.CheckRequirements {
+		requirements, err := FetchModuleRequirements(ctx, source.RemoteURL, target, source.Subdirectory)
+		if err != nil {
+			change.RemoteError = err
+			return skip("could not read the requirements of version %s", target.Original())
+		}
+
+		root, err := LoadModuleRequirements(filepath.Dir(source.FilePath))
+		if err != nil {
+			return skip("could not read the requirements of the root module (%s)", err.Error())
+		}
+
+		conflicts, err := root.Conflicts(requirements)
+		if err != nil {
+			return skip("could not compare requirements (%s)", err.Error())
+		}
+
+		if len(conflicts) > 0 {
+			return skip("requirements of version %s conflict, %s", target.Original(), strings.Join(conflicts, ", "))
+		}
+	}
+
+	return change
+}
+
+// choose returns the version to update to, which is target if it passes the subdirectory and
+// signature checks of the policy, otherwise the highest of its fallbacks which does. Versions
+// which fail verification are always fallen back from, but those without the subdirectory only
+// with SubdirectoryFallback. If no version is chosen the reason is returned, along with the error
+// if it was as a remote lookup failed.
+func (p Policy) choose(ctx context.Context, source *GitSource, target *semver.Version, resolve Resolver) (*semver.Version, string, error) {
+	reason, fallBack, err := p.check(ctx, source, target)
+	if reason == "" {
+		return target, "", nil
+	}
+
+	if err != nil || !fallBack {
+		return nil, reason, err
+	}
+
+	for _, candidate := range fallbacks(source, target, resolve) {
+		candidateReason, _, err := p.check(ctx, source, candidate)
+		if candidateReason == "" {
+			return candidate, "", nil
+		}
+
+		if err != nil {
+			return nil, candidateReason, err
+		}
+	}
+
+	return nil, fmt.Sprintf("%s, and no version allowed between it and %s could be chosen instead", reason, source.LocalVersionString()), nil
+}
+
+// check returns the reason the given version can't be updated to, if any, and whether a lower
+// version may be chosen instead.
+func (p Policy) check(ctx context.Context, source *GitSource, version *semver.Version) (string, bool, error) {
+	if p.CheckSubdirectory {
+		ok, err := source.HasSubdirectory(ctx, version)
+		if err != nil {
+			return fmt.Sprintf("could not check subdirectory %s exists in version %s", source.Subdirectory, version.Original()), false, err
+		}
+
+		if !ok {
+			return fmt.Sprintf("subdirectory %s does not exist in version %s", source.Subdirectory, version.Original()), p.SubdirectoryFallback, nil
+		}
+	}
+
+	if p.Verifier != nil {
+		reason, err := p.Verifier.Verify(ctx, source.RemoteURL, version)
+		if err != nil {
+			return fmt.Sprintf("could not verify the signature of version %s", version.Original()), false, err
+		}
+
+		if reason != "" {
+			return fmt.Sprintf("version %s failed signature verification, %s", version, reason), true, nil
+		}
+	}
+
+	return "", false, nil
+}
+
+// fallbacks returns the remote versions below target, and above the local version, which could
+// be updated to instead, highest first. Only the versions resolve would choose, were they the
+// highest available, are returned, so fallbacks keep to what the resolver allows, such as a
+// constraint, and resolvers which chose target for another reason, such as being the lowest
+// version fixing an advisory, have none.
+func fallbacks(source *GitSource, target *semver.Version, resolve Resolver) []*semver.Version {
+	var candidates []*semver.Version
+	for i := len(source.RemoteVersions) - 1; i >= 0; i-- {
+		version := source.RemoteVersions[i]
+		if !version.LessThan(target) || version.Prerelease() != "" {
+			continue
+		}
+
+		if source.localVersion != nil && !version.GreaterThan(source.localVersion) {
+			break
+		}
+
+		below := *source
+		below.RemoteVersions = source.RemoteVersions[:i+1]
+		below.LatestRemoteVersion = version
+		if chosen, err := resolve(&below); err == nil && chosen != nil && chosen.Equal(version) {
+			candidates = append(candidates, version)
+		}
+	}
+
+	return candidates
+}
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func latest(source *GitSource) (*semver.Version, error) {
+	return source.LatestRemoteVersion, nil
+}
+
+// planSource returns a copy of the given test source with a valid remote URL.
+func planSource(source GitSource) GitSource {
+	source.RemoteURL, _ = url.Parse("https://example.com/org/vpc.git")
+	return source
+}
+
+func TestPolicyPlan(t *testing.T) {
+	ctx := context.Background()
+
+	source := planSource(versionedSource)
+	change := Policy{}.Plan(ctx, "main.tf [vpc]", &source, latest)
+	require.NotNil(t, change)
+	assert.True(t, change.IsUpdate())
+	assert.Equal(t, "v3.0.0", change.From)
+	assert.Equal(t, "v5.0.0", change.To)
+
+	change = Policy{}.Plan(ctx, "main.tf [vpc]", &source, func(*GitSource) (*semver.Version, error) {
+		return semver.MustParse("v3.0.0"), nil
+	})
+	assert.Nil(t, change, "sources already on the target version should not be planned")
+
+	downgrade := func(*GitSource) (*semver.Version, error) { return semver.MustParse("v2.0.0"), nil }
+	change = Policy{}.Plan(ctx, "main.tf [vpc]", &source, downgrade)
+	assert.False(t, change.IsUpdate())
+	assert.Equal(t, "target version 2.0.0 is less than current version v3.0.0", change.Skipped)
+	assert.True(t, Policy{AllowDowngrades: true}.Plan(ctx, "main.tf [vpc]", &source, downgrade).IsUpdate())
+
+	change = Policy{}.Plan(ctx, "main.tf [vpc]", &source, func(*GitSource) (*semver.Version, error) {
+		return nil, errors.New("no version 100% suitable")
+	})
+	assert.Equal(t, "no version 100% suitable", change.Skipped, "resolver errors should be the reason for skipping")
+
+	unversioned := planSource(unversionedSource)
+	assert.False(t, Policy{}.Plan(ctx, "main.tf [vpc]", &unversioned, latest).IsUpdate())
+	assert.True(t, Policy{VersionUnversioned: true}.Plan(ctx, "main.tf [vpc]", &unversioned, latest).IsUpdate())
+
+	for _, ref := range []string{"main", "8c3b1d4e9f2a7c6b5d0e1f2a3b4c5d6e7f8a9b0c"} {
+		pinned := planSource(versionedSource)
+		pinned.localVersion = nil
+		pinned.SourceURL, _ = url.Parse("git::git@github.com:terraform-aws-modules/terraform-aws-vpc.git?ref=" + ref)
+		change = Policy{}.Plan(ctx, "main.tf [vpc]", &pinned, latest)
+		assert.False(t, change.IsUpdate(), "sources pinned to %s should not be versioned", ref)
+		assert.Equal(t, "unversioned module tracking "+ref+", to force versioning re-run with --version-unversioned", change.Skipped)
+		assert.True(t, Policy{VersionUnversioned: true}.Plan(ctx, "main.tf [vpc]", &pinned, latest).IsUpdate())
+	}
+
+	unresolved := planSource(versionedSource)
+	unresolved.RemoteError = errors.New("timed out")
+	change = Policy{}.Plan(ctx, "main.tf [vpc]", &unresolved, latest)
+	assert.Equal(t, "could not retrieve remote versions", change.Skipped)
+	assert.EqualError(t, change.RemoteError, "timed out")
+
+	locked := planSource(versionedSource)
+	locked.UpdateError = errors.New("ref is built from more than one expression")
+	assert.Equal(t, locked.UpdateError.Error(), Policy{}.Plan(ctx, "main.tf [vpc]", &locked, latest).Skipped)
+}
+
+func TestPolicyPlanMinAge(t *testing.T) {
+	source := planSource(versionedSource)
+	source.ReleaseDates = map[string]time.Time{
+		"v4.0.0": time.Now().Add(-30 * 24 * time.Hour),
+		"v5.0.0": time.Now().Add(-24 * time.Hour),
+	}
+
+	// Release dates are looked up through the cache, so are set there in place of a lookup.
+	defer func(previous releaseDateCache) { ReleaseDateCache = previous }(ReleaseDateCache)
+	ReleaseDateCache = releaseDateCache{newRemoteCache()}
+	for tag, date := range source.ReleaseDates {
+		ReleaseDateCache.Set(source.RemoteURL.String(), tag, date)
+	}
+
+	policy := Policy{MinAge: 7 * 24 * time.Hour}
+	change := policy.Plan(context.Background(), "main.tf [vpc]", &source, latest)
+	require.NotNil(t, change)
+	assert.Equal(t, "v4.0.0", change.To, "versions released within the minimum age should not be chosen")
+
+	source.RemoteVersions = semver.Collection{semver.MustParse("v5.0.0")}
+	change = policy.Plan(context.Background(), "main.tf [vpc]", &source, latest)
+	assert.Equal(t, "no version was released more than 7d ago", change.Skipped)
+}
@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// PullRequest is a request to merge a branch of updates into the base branch, known as a
+// merge request on GitLab.
+type PullRequest struct {
+	Branch string
+	Base   string
+	Title  string
+	Body   string
+}
+
+// PullRequestProvider opens pull requests in the repository at the given URL. If a pull request
+// for the branch is already open it is updated, rather than another being opened, and updated
+// is true. The web URL of the pull request is returned.
+type PullRequestProvider interface {
+	OpenPullRequest(ctx context.Context, remoteURL *url.URL, pr PullRequest) (webURL string, updated bool, err error)
+
+	// PushAuth returns the credentials used to push the branch to the repository at the given
+	// URL, or nil to use those git would, e.g., an SSH agent.
+	PushAuth(remoteURL *url.URL) transport.AuthMethod
+}
+
+// NewPullRequestProvider creates a PullRequestProvider by name, one of github or gitlab, for
+// the host of the given repository. If name is auto github.com and gitlab.com are recognised,
+// other hosts must be named.
+func NewPullRequestProvider(name string, remoteURL *url.URL) (PullRequestProvider, error) {
+	host := strings.ToLower(remoteURL.Hostname())
+	if name == "auto" {
+		switch host {
+		case "github.com":
+			name = "github"
+		case "gitlab.com":
+			name = "gitlab"
+		default:
+			return nil, fmt.Errorf("can't tell whether %s is hosted on GitHub or GitLab, set the provider to use", remoteURL.Redacted())
+		}
+	}
+
+	switch name {
+	case "github":
+		provider := NewGitHubPullRequestProvider()
+		if host != "github.com" {
+			// GitHub Enterprise serves the API under the host itself.
+			provider.BaseURL = fmt.Sprintf("https://%s/api/v3", remoteURL.Host)
+		}
+		return provider, nil
+	case "gitlab":
+		provider := NewGitLabMergeRequestProvider()
+		if host != "gitlab.com" {
+			provider.BaseURL = fmt.Sprintf("https://%s", remoteURL.Host)
+		}
+		return provider, nil
+	}
+
+	return nil, fmt.Errorf("unknown pull request provider %s", name)
+}
+
+// NewPullRequest creates the pull request for the given planned updates, with a title and body
+// describing them. Skipped changes are ignored.
+func NewPullRequest(branch string, base string, changes []*Change) PullRequest {
+	var updates []*Change
+	for _, change := range changes {
+		if change.IsUpdate() {
+			updates = append(updates, change)
+		}
+	}
+
+	sort.Slice(updates, func(i, j int) bool {
+		return updates[i].Module < updates[j].Module
+	})
+
+	return PullRequest{
+		Branch: branch,
+		Base:   base,
+		Title:  pullRequestTitle(updates),
+		Body:   pullRequestBody(updates),
+	}
+}
+
+// pullRequestTitle names the repository and version updated to, if all the updates share them,
+// otherwise the number of modules updated.
+func pullRequestTitle(updates []*Change) string {
+	repositories := make(map[string]bool)
+	versions := make(map[string]bool)
+	for _, change := range updates {
+		repositories[change.Repository] = true
+		versions[change.To] = true
+	}
+
+	switch {
+	case len(repositories) == 1 && len(versions) == 1:
+		return fmt.Sprintf("Update %s to %s", repositoryName(updates[0].Repository), updates[0].To)
+	case len(repositories) == 1:
+		return fmt.Sprintf("Update %s", repositoryName(updates[0].Repository))
+	}
+
+	return fmt.Sprintf("Update %d modules", len(updates))
+}
+
+func pullRequestBody(updates []*Change) string {
+	var body strings.Builder
+	body.WriteString("Updates the following module sources.\n\n")
+	body.WriteString("| Module | Repository | From | To |\n")
+	body.WriteString("| --- | --- | --- | --- |\n")
+	for _, change := range updates {
+		fmt.Fprintf(&body, "| `%s` | %s | `%s` | `%s` |\n", change.Module, change.Repository, change.From, change.To)
+	}
+
+	body.WriteString("\nOpened by tfmodref, rerunning the update replaces this branch.\n")
+	return body.String()
+}
+
+// repositoryName returns the name of a repository from its URL, e.g., terraform-aws-vpc.
+func repositoryName(repository string) string {
+	return strings.TrimSuffix(path.Base(repository), ".git")
+}
+
+// sendJSON sends v, if not nil, as the JSON body of a request to the given endpoint and decodes
+// the JSON response into result.
+func sendJSON(ctx context.Context, client *http.Client, method string, endpoint string, header http.Header, v interface{}, result interface{}) error {
+	var body bytes.Buffer
+	if v != nil {
+		if err := json.NewEncoder(&body).Encode(v); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header = header.Clone()
+	if v != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	return decodeJSONResponse(resp, result)
+}
+
+// tokenAuth returns the credentials pushing with an API token over HTTP(S), or nil for other
+// protocols or without a token.
+func tokenAuth(remoteURL *url.URL, username string, token string) transport.AuthMethod {
+	if token == "" || (remoteURL.Scheme != "https" && remoteURL.Scheme != "http") {
+		return nil
+	}
+
+	return &githttp.BasicAuth{Username: username, Password: token}
+}
@@ -0,0 +1,164 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testChanges = []*Change{
+	{Module: "main.tf [vpc]", Repository: "https://github.com/terraform-aws-modules/terraform-aws-vpc.git", From: "v2.0.0", To: "v3.1.0"},
+	{Module: "main.tf [network]", Repository: "ssh://git@gitlab.com/example/terraform-modules.git", From: "v0.1.0", Skipped: "no reason"},
+}
+
+func TestNewPullRequest(t *testing.T) {
+	pr := NewPullRequest("tfmodref/update", "main", testChanges)
+	assert.Equal(t, "Update terraform-aws-vpc to v3.1.0", pr.Title)
+	assert.Contains(t, pr.Body, "| `main.tf [vpc]` | https://github.com/terraform-aws-modules/terraform-aws-vpc.git | `v2.0.0` | `v3.1.0` |")
+	assert.NotContains(t, pr.Body, "[network]", "skipped changes should not be described")
+
+	changes := append([]*Change{
+		{Module: "other.tf [vpc]", Repository: "https://github.com/terraform-aws-modules/terraform-aws-vpc.git", From: "v1.0.0", To: "v3.0.0"},
+	}, testChanges...)
+	assert.Equal(t, "Update terraform-aws-vpc", NewPullRequest("b", "main", changes).Title)
+
+	changes = append(changes, &Change{Module: "main.tf [network]", Repository: "ssh://git@gitlab.com/example/terraform-modules.git", From: "v0.1.0", To: "v0.2.0"})
+	assert.Equal(t, "Update 3 modules", NewPullRequest("b", "main", changes).Title)
+}
+
+func TestNewPullRequestProvider(t *testing.T) {
+	github, _ := url.Parse("https://github.com/org/repo.git")
+	provider, err := NewPullRequestProvider("auto", github)
+	require.NoError(t, err)
+	assert.IsType(t, &GitHubPullRequestProvider{}, provider)
+
+	enterprise, _ := url.Parse("ssh://git@git.example.com/org/repo.git")
+	_, err = NewPullRequestProvider("auto", enterprise)
+	assert.Error(t, err, "unknown hosts should require the provider to be named")
+
+	provider, err = NewPullRequestProvider("github", enterprise)
+	require.NoError(t, err)
+	assert.Equal(t, "https://git.example.com/api/v3", provider.(*GitHubPullRequestProvider).BaseURL)
+
+	provider, err = NewPullRequestProvider("gitlab", enterprise)
+	require.NoError(t, err)
+	assert.Equal(t, "https://git.example.com", provider.(*GitLabMergeRequestProvider).BaseURL)
+	assert.Nil(t, provider.PushAuth(enterprise), "SSH remotes should push with the credentials git would use")
+}
+
+// fakePullRequestAPI serves the list, create and update endpoints of a pull request API,
+// keeping the requests it has opened by branch. listed and created return the branch of a
+// list query and a create request respectively. The bodies of update requests are kept too.
+type fakePullRequestAPI struct {
+	state   string
+	listed  func(query url.Values) string
+	created func(body map[string]interface{}) string
+
+	opened  map[string]map[string]interface{}
+	updates []map[string]interface{}
+	methods []string
+}
+
+func (f *fakePullRequestAPI) serve(t *testing.T, list string) *httptest.Server {
+	f.opened = make(map[string]map[string]interface{})
+	mux := http.NewServeMux()
+	mux.HandleFunc(list, func(w http.ResponseWriter, r *http.Request) {
+		f.methods = append(f.methods, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		body["number"], body["iid"] = 7, 7
+		body["html_url"], body["web_url"] = "https://example.com/pr/7", "https://example.com/pr/7"
+		f.opened[f.created(body)] = body
+
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(body)
+	})
+	mux.HandleFunc(list+"/7", func(w http.ResponseWriter, r *http.Request) {
+		f.methods = append(f.methods, r.Method)
+
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		f.updates = append(f.updates, body)
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"html_url": "https://example.com/pr/7", "web_url": "https://example.com/pr/7"})
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != list {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		f.methods = append(f.methods, r.Method)
+		assert.Equal(t, f.state, r.URL.Query().Get("state"))
+		open := []map[string]interface{}{}
+		if pr, ok := f.opened[f.listed(r.URL.Query())]; ok {
+			open = append(open, pr)
+		}
+		_ = json.NewEncoder(w).Encode(open)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGitHubPullRequestProvider(t *testing.T) {
+	api := &fakePullRequestAPI{
+		state:   "open",
+		listed:  func(query url.Values) string { return query.Get("head") },
+		created: func(body map[string]interface{}) string { return "org:" + body["head"].(string) },
+	}
+	server := api.serve(t, "/repos/org/repo/pulls")
+	provider := &GitHubPullRequestProvider{BaseURL: server.URL, Token: "secret", Client: server.Client()}
+
+	remoteURL, _ := url.Parse("https://github.com/org/repo.git")
+	pr := NewPullRequest("tfmodref/update", "main", testChanges)
+
+	webURL, updated, err := provider.OpenPullRequest(context.Background(), remoteURL, pr)
+	require.NoError(t, err)
+	assert.False(t, updated)
+	assert.Equal(t, "https://example.com/pr/7", webURL)
+
+	// A rerun against a different base updates the open pull request, rather than opening another.
+	_, updated, err = provider.OpenPullRequest(context.Background(), remoteURL, NewPullRequest("tfmodref/update", "develop", testChanges))
+	require.NoError(t, err)
+	assert.True(t, updated, "the open pull request should be updated")
+	assert.Equal(t, []string{http.MethodGet, http.MethodPost, http.MethodGet, http.MethodPatch}, api.methods)
+	assert.Len(t, api.opened, 1)
+	require.Len(t, api.updates, 1)
+	assert.Equal(t, "develop", api.updates[0]["base"])
+	assert.NotNil(t, provider.PushAuth(remoteURL))
+}
+
+func TestGitLabMergeRequestProvider(t *testing.T) {
+	api := &fakePullRequestAPI{
+		state:   "opened",
+		listed:  func(query url.Values) string { return query.Get("source_branch") },
+		created: func(body map[string]interface{}) string { return body["source_branch"].(string) },
+	}
+	server := api.serve(t, "/api/v4/projects/org/repo/merge_requests")
+	provider := &GitLabMergeRequestProvider{BaseURL: server.URL, Token: "secret", Client: server.Client()}
+
+	remoteURL, _ := url.Parse("https://gitlab.com/org/repo.git")
+	pr := NewPullRequest("tfmodref/update", "main", testChanges)
+
+	_, updated, err := provider.OpenPullRequest(context.Background(), remoteURL, pr)
+	require.NoError(t, err)
+	assert.False(t, updated)
+
+	webURL, updated, err := provider.OpenPullRequest(context.Background(), remoteURL, NewPullRequest("tfmodref/update", "develop", testChanges))
+	require.NoError(t, err)
+	assert.True(t, updated, "the open merge request should be updated")
+	assert.Equal(t, "https://example.com/pr/7", webURL)
+	assert.Equal(t, []string{http.MethodGet, http.MethodPost, http.MethodGet, http.MethodPut}, api.methods)
+	assert.Len(t, api.opened, 1)
+	require.Len(t, api.updates, 1)
+	assert.Equal(t, "develop", api.updates[0]["target_branch"])
+}
@@ -0,0 +1,379 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ModuleRequirements are the versions of terraform and of each provider a module requires, as
+// set in its terraform block by required_version and required_providers. Providers are keyed by
+// their source address, e.g., hashicorp/aws, and constraints set in more than one place are
+// joined, as terraform requires all of them to be met.
+type ModuleRequirements struct {
+	Terraform string            `json:"terraform,omitempty"`
+	Providers map[string]string `json:"providers,omitempty"`
+}
+
+var terraformBlockSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{{Type: "terraform"}},
+}
+
+var requirementsSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{{Name: "required_version"}},
+	Blocks:     []hcl.BlockHeaderSchema{{Type: "required_providers"}},
+}
+
+// ParseModuleRequirements reads the terraform blocks from the files of a module, given by name.
+func ParseModuleRequirements(files map[string][]byte) (*ModuleRequirements, error) {
+	requirements := &ModuleRequirements{Providers: make(map[string]string)}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		file, err := parseModuleFile(name, files[name])
+		if err != nil {
+			return nil, err
+		}
+
+		content, _, diags := file.Body.PartialContent(terraformBlockSchema)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("could not read %s (%s)", name, diags.Error())
+		}
+
+		for _, block := range content.Blocks {
+			terraform, _, diags := block.Body.PartialContent(requirementsSchema)
+			if diags.HasErrors() {
+				return nil, fmt.Errorf("could not read the terraform block in %s (%s)", name, diags.Error())
+			}
+
+			if attr, ok := terraform.Attributes["required_version"]; ok {
+				requirements.Terraform = joinConstraints(requirements.Terraform, expressionText(files[name], attr.Expr))
+			}
+
+			for _, providersBlock := range terraform.Blocks {
+				if err := requirements.addProviders(providersBlock.Body); err != nil {
+					return nil, fmt.Errorf("could not read required_providers in %s (%s)", name, err.Error())
+				}
+			}
+		}
+	}
+
+	return requirements, nil
+}
+
+// addProviders adds the providers listed in a required_providers block, which are either
+// objects with a source and version, or, in older configurations, just the version. Only the
+// source and version are read, as other items, such as configuration_aliases, refer to
+// providers by name and can't be evaluated.
+func (r *ModuleRequirements) addProviders(body hcl.Body) error {
+	attrs, diags := body.JustAttributes()
+	if diags.HasErrors() {
+		return errors.New(diags.Error())
+	}
+
+	for name, attr := range attrs {
+		source, version := "hashicorp/"+name, ""
+		if items, diags := hcl.ExprMap(attr.Expr); !diags.HasErrors() {
+			for _, item := range items {
+				key, diags := item.Key.Value(nil)
+				if diags.HasErrors() || key.Type() != cty.String || key.IsNull() {
+					continue
+				}
+
+				switch key.AsString() {
+				case "source":
+					if value, ok := stringValue(item.Value); ok {
+						source = normaliseProviderSource(value)
+					}
+				case "version":
+					if value, ok := stringValue(item.Value); ok {
+						version = value
+					}
+				}
+			}
+		} else if value, ok := stringValue(attr.Expr); ok {
+			version = value
+		} else {
+			continue
+		}
+
+		existing, ok := r.Providers[source]
+		if !ok || version != "" {
+			r.Providers[source] = joinConstraints(existing, version)
+		}
+	}
+
+	return nil
+}
+
+// stringValue returns the value of an expression which is a constant string.
+func stringValue(expr hcl.Expression) (string, bool) {
+	value, diags := expr.Value(nil)
+	if diags.HasErrors() || !value.IsWhollyKnown() || value.IsNull() || value.Type() != cty.String {
+		return "", false
+	}
+
+	return value.AsString(), true
+}
+
+// normaliseProviderSource returns a provider source address without the default registry
+// host, which is implied when it is left out, e.g., registry.terraform.io/hashicorp/aws is
+// hashicorp/aws.
+func normaliseProviderSource(source string) string {
+	source = strings.ToLower(source)
+	if strings.Count(source, "/") == 2 && strings.HasPrefix(source, "registry.terraform.io/") {
+		return strings.TrimPrefix(source, "registry.terraform.io/")
+	}
+
+	if !strings.Contains(source, "/") {
+		return "hashicorp/" + source
+	}
+
+	return source
+}
+
+func joinConstraints(a string, b string) string {
+	switch {
+	case a == "" || a == b:
+		return b
+	case b == "":
+		return a
+	}
+
+	return a + ", " + b
+}
+
+// DiffRequirements describes how the terraform and provider requirements of a module change
+// between two versions, e.g., required_version: >= 0.13 -> >= 1.3.
+func DiffRequirements(from *ModuleRequirements, to *ModuleRequirements) []string {
+	var changes []string
+	if from.Terraform != to.Terraform {
+		changes = append(changes, fmt.Sprintf("required_version: %s -> %s", describeConstraint(from.Terraform), describeConstraint(to.Terraform)))
+	}
+
+	var providers []string
+	for source := range from.Providers {
+		providers = append(providers, source)
+	}
+
+	for source := range to.Providers {
+		if _, ok := from.Providers[source]; !ok {
+			providers = append(providers, source)
+		}
+	}
+	sort.Strings(providers)
+
+	for _, source := range providers {
+		old, hadProvider := from.Providers[source]
+		updated, hasProvider := to.Providers[source]
+		switch {
+		case !hadProvider:
+			changes = append(changes, fmt.Sprintf("provider %s added: %s", source, describeConstraint(updated)))
+		case !hasProvider:
+			changes = append(changes, fmt.Sprintf("provider %s removed", source))
+		case old != updated:
+			changes = append(changes, fmt.Sprintf("provider %s: %s -> %s", source, describeConstraint(old), describeConstraint(updated)))
+		}
+	}
+
+	return changes
+}
+
+// describeConstraint returns the given constraint, or any where none is set.
+func describeConstraint(constraint string) string {
+	if constraint == "" {
+		return "any"
+	}
+
+	return constraint
+}
+
+// Conflicts returns the requirements of the module which can't be met at the same time as those
+// of the root module calling it, i.e., where no version of terraform, or of a provider both
+// require, satisfies both constraints.
+func (r *ModuleRequirements) Conflicts(module *ModuleRequirements) ([]string, error) {
+	var conflicts []string
+
+	compatible, err := constraintsOverlap(r.Terraform, module.Terraform)
+	if err != nil {
+		return nil, err
+	}
+
+	if !compatible {
+		conflicts = append(conflicts, fmt.Sprintf("required_version %s conflicts with the root module's %s", module.Terraform, r.Terraform))
+	}
+
+	var sources []string
+	for source := range module.Providers {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	for _, source := range sources {
+		root, ok := r.Providers[source]
+		if !ok {
+			continue
+		}
+
+		compatible, err := constraintsOverlap(root, module.Providers[source])
+		if err != nil {
+			return nil, err
+		}
+
+		if !compatible {
+			conflicts = append(conflicts, fmt.Sprintf("provider %s %s conflicts with the root module's %s", source, module.Providers[source], root))
+		}
+	}
+
+	return conflicts, nil
+}
+
+var constraintVersion = regexp.MustCompile(`^\s*(=|!=|>=|<=|>|<|~>)?\s*v?([0-9][0-9A-Za-z.+-]*)\s*$`)
+
+// terraformConstraint parses a terraform version constraint, returning the constraints, and
+// the versions they mention. Terraform's pessimistic operator allows only the rightmost version
+// segment to increase, e.g., ~> 1.2 is >= 1.2, < 2.0 and ~> 1.2.3 is >= 1.2.3, < 1.3.0, which
+// is rewritten as such as it differs from the tilde operator of semver.
+func terraformConstraint(constraint string) (*semver.Constraints, []*semver.Version, error) {
+	var parts []string
+	var versions []*semver.Version
+	for _, part := range strings.Split(constraint, ",") {
+		match := constraintVersion.FindStringSubmatch(part)
+		if match == nil {
+			return nil, nil, fmt.Errorf("version constraint %s is invalid", constraint)
+		}
+
+		operator, version := match[1], match[2]
+		parsed, err := semver.NewVersion(version)
+		if err != nil {
+			return nil, nil, fmt.Errorf("version constraint %s is invalid (%s)", constraint, err.Error())
+		}
+		versions = append(versions, parsed)
+
+		switch operator {
+		case "":
+			parts = append(parts, "= "+version)
+		case "~>":
+			segments := strings.Count(strings.SplitN(version, "-", 2)[0], ".") + 1
+			upper := parsed.IncMajor()
+			if segments == 3 {
+				upper = parsed.IncMinor()
+			}
+
+			parts = append(parts, ">= "+version, "< "+upper.String())
+			versions = append(versions, &upper)
+		default:
+			parts = append(parts, operator+" "+version)
+		}
+	}
+
+	constraints, err := semver.NewConstraint(strings.Join(parts, ", "))
+	if err != nil {
+		return nil, nil, fmt.Errorf("version constraint %s is invalid (%s)", constraint, err.Error())
+	}
+
+	return constraints, versions, nil
+}
+
+// constraintsOverlap returns true if some version satisfies both terraform version constraints,
+// either of which may be empty to allow any version. Only the versions mentioned by either
+// constraint, the versions just above them, and 0.0.0 need to be tried, as these are the
+// bounds of the ranges allowed.
+func constraintsOverlap(a string, b string) (bool, error) {
+	if a == "" || b == "" {
+		return true, nil
+	}
+
+	aConstraints, aVersions, err := terraformConstraint(a)
+	if err != nil {
+		return false, err
+	}
+
+	bConstraints, bVersions, err := terraformConstraint(b)
+	if err != nil {
+		return false, err
+	}
+
+	candidates := []*semver.Version{semver.MustParse("0.0.0")}
+	for _, version := range append(aVersions, bVersions...) {
+		next := version.IncPatch()
+		candidates = append(candidates, version, &next)
+	}
+
+	for _, candidate := range candidates {
+		if aConstraints.Check(candidate) && bConstraints.Check(candidate) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// LoadModuleRequirements reads the requirements of the module in the given directory, from the
+// terraform files within it.
+func LoadModuleRequirements(dir string) (*ModuleRequirements, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte)
+	for _, entry := range entries {
+		if entry.IsDir() || !IsModuleFile(entry.Name()) {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if files[path], err = ioutil.ReadFile(filepath.Clean(path)); err != nil {
+			return nil, err
+		}
+	}
+
+	return ParseModuleRequirements(files)
+}
+
+// FetchModuleRequirements returns the requirements of the module in the subdirectory of the
+// repository, or at its root, at the given version.
+func FetchModuleRequirements(ctx context.Context, remoteURL *url.URL, version *semver.Version, subdirectory string) (*ModuleRequirements, error) {
+	files, err := FetchModuleFiles(ctx, remoteURL, version, subdirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseModuleRequirements(files)
+}
+
+// RequirementChanges describes how the requirements of the module a source refers to change
+// between its local version and the given version.
+func (gs *GitSource) RequirementChanges(ctx context.Context, version *semver.Version) ([]string, error) {
+	if gs.localVersion == nil {
+		return nil, errors.New("the local version is not a semantic version")
+	}
+
+	from, err := FetchModuleRequirements(ctx, gs.RemoteURL, gs.localVersion, gs.Subdirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := FetchModuleRequirements(ctx, gs.RemoteURL, version, gs.Subdirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	return DiffRequirements(from, to), nil
+}
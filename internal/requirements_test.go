@@ -0,0 +1,168 @@
+package internal
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const requirementsV1 = `terraform {
+  required_version = ">= 0.13"
+
+  required_providers {
+    aws    = ">= 3.0"
+    random = {
+      source  = "registry.terraform.io/hashicorp/random"
+      version = ">= 2.0"
+    }
+  }
+}
+`
+
+const requirementsV2 = `terraform {
+  required_version = ">= 1.3"
+
+  required_providers {
+    aws = {
+      source  = "hashicorp/aws"
+      version = "~> 5.0"
+    }
+    tls = {
+      source = "hashicorp/tls"
+    }
+  }
+}
+`
+
+func TestParseModuleRequirements(t *testing.T) {
+	requirements, err := ParseModuleRequirements(map[string][]byte{
+		"versions.tf":       []byte(requirementsV1),
+		"providers.tf.json": []byte(`{"terraform": {"required_version": "< 2.0.0", "required_providers": {"aws": {"source": "hashicorp/aws", "version": "< 5.0"}}}}`),
+		"main.tf":           []byte(`module "vpc" { source = "./vpc" }`),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, &ModuleRequirements{
+		Terraform: "< 2.0.0, >= 0.13",
+		Providers: map[string]string{
+			"hashicorp/aws":    "< 5.0, >= 3.0",
+			"hashicorp/random": ">= 2.0",
+		},
+	}, requirements, "constraints set in more than one place should all be kept")
+}
+
+func TestParseModuleRequirementsWithAliases(t *testing.T) {
+	requirements, err := ParseModuleRequirements(map[string][]byte{
+		"versions.tf": []byte(`terraform {
+  required_providers {
+    aws = {
+      source                = "hashicorp/aws"
+      version               = ">= 5.0"
+      configuration_aliases = [aws.us_east_1, aws.eu_west_1]
+    }
+    google = {
+      configuration_aliases = [google.secondary]
+    }
+  }
+}
+`),
+		"providers.tf.json": []byte(`{"terraform": {"required_providers": {"dns": {"source": "hashicorp/dns", "version": "~> 3.0", "configuration_aliases": ["dns.secondary"]}}}}`),
+	})
+	require.NoError(t, err, "configuration aliases refer to providers, so can't be evaluated, and should be ignored")
+
+	assert.Equal(t, map[string]string{
+		"hashicorp/aws":    ">= 5.0",
+		"hashicorp/dns":    "~> 3.0",
+		"hashicorp/google": "",
+	}, requirements.Providers)
+}
+
+func TestDiffRequirements(t *testing.T) {
+	from, err := ParseModuleRequirements(map[string][]byte{"versions.tf": []byte(requirementsV1)})
+	require.NoError(t, err)
+	to, err := ParseModuleRequirements(map[string][]byte{"versions.tf": []byte(requirementsV2)})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"required_version: >= 0.13 -> >= 1.3",
+		"provider hashicorp/aws: >= 3.0 -> ~> 5.0",
+		"provider hashicorp/random removed",
+		"provider hashicorp/tls added: any",
+	}, DiffRequirements(from, to))
+	assert.Empty(t, DiffRequirements(to, to))
+}
+
+func TestRequirementConflicts(t *testing.T) {
+	module, err := ParseModuleRequirements(map[string][]byte{"versions.tf": []byte(requirementsV2)})
+	require.NoError(t, err)
+
+	for root, expected := range map[string][]string{
+		`terraform {}`: nil,
+		`terraform {
+  required_version = "~> 1.2"
+  required_providers {
+    aws = "~> 5.1.0"
+  }
+}`: nil,
+		`terraform {
+  required_version = "~> 1.2.0"
+  required_providers {
+    aws = { source = "hashicorp/aws", version = "< 5.0" }
+  }
+}`: {
+			"required_version >= 1.3 conflicts with the root module's ~> 1.2.0",
+			"provider hashicorp/aws ~> 5.0 conflicts with the root module's < 5.0",
+		},
+		`terraform {
+  required_version = "1.2.9"
+}`: {"required_version >= 1.3 conflicts with the root module's 1.2.9"},
+		`terraform {
+  required_version = ">= 1.3, != 1.3.0, < 1.3.1"
+}`: {"required_version >= 1.3 conflicts with the root module's >= 1.3, != 1.3.0, < 1.3.1"},
+	} {
+		requirements, err := ParseModuleRequirements(map[string][]byte{"versions.tf": []byte(root)})
+		require.NoError(t, err)
+
+		conflicts, err := requirements.Conflicts(module)
+		require.NoError(t, err)
+		assert.Equal(t, expected, conflicts, root)
+	}
+
+	_, err = (&ModuleRequirements{Terraform: "newer than 1.0"}).Conflicts(module)
+	assert.Error(t, err)
+}
+
+func TestPolicyPlanChecksRequirements(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "versions.tf"), []byte(`terraform {
+  required_version = "< 1.3"
+}`), 0600))
+
+	source := GitSource{
+		FilePath: filepath.Join(dir, "main.tf"),
+		RemoteURL: newModuleRepository(t,
+			moduleRelease{"v1.0.0", map[string]string{"versions.tf": requirementsV1}},
+			moduleRelease{"v2.0.0", map[string]string{"versions.tf": requirementsV2}},
+		),
+		localVersion: semver.MustParse("v1.0.0"),
+	}
+	source.setRemoteTags(semver.Collection{semver.MustParse("v1.0.0"), semver.MustParse("v2.0.0")})
+
+	change := Policy{CheckRequirements: true}.Plan(ctx, "main.tf [vpc]", &source, latest)
+	assert.Equal(t, "requirements of version v2.0.0 conflict, required_version >= 1.3 conflicts with the root module's < 1.3", change.Skipped)
+
+	changes, err := source.RequirementChanges(ctx, semver.MustParse("v2.0.0"))
+	require.NoError(t, err)
+	assert.Len(t, changes, 4)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "versions.tf"), []byte(`terraform {
+  required_version = "< 2.0"
+}`), 0600))
+	assert.True(t, Policy{CheckRequirements: true}.Plan(ctx, "main.tf [vpc]", &source, latest).IsUpdate())
+}
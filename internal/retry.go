@@ -0,0 +1,219 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver"
+)
+
+// RetryPolicy controls how failed remote lookups are retried, using exponential backoff
+// with full jitter between attempts. If set, Timeout bounds the total time spent across
+// all attempts.
+type RetryPolicy struct {
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Timeout   time.Duration
+	sleep     func(time.Duration)
+}
+
+// DefaultRetryPolicy is used when no other policy has been configured.
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:  4,
+	BaseDelay: 500 * time.Millisecond,
+	MaxDelay:  30 * time.Second,
+}
+
+// Do calls fn until it succeeds, returns a permanent error, the attempts are exhausted,
+// or the context is done.
+func (p RetryPolicy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	var err error
+	for attempt := 0; attempt < p.Attempts || attempt == 0; attempt++ {
+		if attempt > 0 {
+			delay, ok := p.delay(attempt, err)
+			if !ok {
+				return err
+			}
+
+			if waitErr := p.wait(ctx, delay); waitErr != nil {
+				return fmt.Errorf("%s (%w)", err.Error(), waitErr)
+			}
+		}
+
+		if err = fn(ctx); err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return err
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return permanent.err
+		}
+	}
+
+	return err
+}
+
+// delay returns how long to wait before the given attempt, if the previous attempt was
+// rate limited the limit's reset time is used instead, unless it exceeds MaxDelay in which
+// case there is no point waiting and false is returned.
+func (p RetryPolicy) delay(attempt int, err error) (time.Duration, bool) {
+	var rateLimited *RateLimitError
+	if errors.As(err, &rateLimited) && rateLimited.RetryAfter > 0 {
+		return rateLimited.RetryAfter, rateLimited.RetryAfter <= p.MaxDelay
+	}
+
+	backoff := p.BaseDelay << uint(attempt-1)
+	if backoff <= 0 || backoff > p.MaxDelay {
+		backoff = p.MaxDelay
+	}
+
+	if backoff <= 0 {
+		return 0, true
+	}
+
+	// #nosec G404 -- jitter does not need to be cryptographically secure
+	return time.Duration(rand.Int63n(int64(backoff) + 1)), true
+}
+
+func (p RetryPolicy) wait(ctx context.Context, delay time.Duration) error {
+	if p.sleep != nil {
+		p.sleep(delay)
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// permanentError marks an error which will not succeed on retry.
+type permanentError struct {
+	err error
+}
+
+// Permanent wraps an error to prevent it being retried by a RetryPolicy.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err: err}
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// RateLimitError is returned by API based providers when a request has been rate limited,
+// RetryAfter holds how long the API has asked clients to wait, if known.
+type RateLimitError struct {
+	URL        string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("rate limited by %s (retry after %s)", e.URL, e.RetryAfter)
+	}
+
+	return fmt.Sprintf("rate limited by %s", e.URL)
+}
+
+// RetryingTagProvider wraps another TagProvider, retrying failed lookups according to
+// the given policy. Lookups which still fail are recorded in FailedLookups, so a repository
+// which can't be resolved is only retried once however many sources refer to it.
+type RetryingTagProvider struct {
+	Provider TagProvider
+	Policy   RetryPolicy
+}
+
+type failureCache struct {
+	*remoteCache
+}
+
+// FailedLookups is a global cache of the errors from remote lookups which failed after every
+// retry, keyed by the kind of lookup and repo URL.
+var FailedLookups = failureCache{newRemoteCache()}
+
+func (fc failureCache) Get(key string) error {
+	if val, ok := fc.get(key).(error); ok {
+		return val
+	}
+
+	return nil
+}
+
+func (fc failureCache) Set(key string, err error) {
+	fc.set(key, err)
+}
+
+// NewRetryingTagProvider wraps the given provider with the given retry policy.
+func NewRetryingTagProvider(provider TagProvider, policy RetryPolicy) *RetryingTagProvider {
+	return &RetryingTagProvider{
+		Provider: provider,
+		Policy:   policy,
+	}
+}
+
+// Tags returns the tags from the wrapped provider, retrying on failure.
+func (p *RetryingTagProvider) Tags(ctx context.Context, remoteURL *url.URL) (tags semver.Collection, err error) {
+	err = p.do(ctx, "tags@"+remoteURL.String(), func(ctx context.Context) error {
+		tags, err = p.Provider.Tags(ctx, remoteURL)
+		return err
+	})
+
+	return tags, err
+}
+
+// ReleaseDates returns the release dates from the wrapped provider, or from git if it can't
+// provide them, retrying on failure.
+func (p *RetryingTagProvider) ReleaseDates(ctx context.Context, remoteURL *url.URL, tags []string) (dates map[string]time.Time, err error) {
+	provider := releaseDateProvider(p.Provider)
+	err = p.do(ctx, "release-dates@"+remoteURL.String()+"@"+strings.Join(tags, ","), func(ctx context.Context) error {
+		dates, err = provider.ReleaseDates(ctx, remoteURL, tags)
+		return err
+	})
+
+	return dates, err
+}
+
+// do calls fn according to the retry policy, unless the same lookup has already failed. Lookups
+// abandoned as the context is done aren't recorded, as they didn't fail by themselves.
+func (p *RetryingTagProvider) do(ctx context.Context, key string, fn func(ctx context.Context) error) error {
+	if err := FailedLookups.Get(key); err != nil {
+		return err
+	}
+
+	err := p.Policy.Do(ctx, fn)
+	if err != nil && ctx.Err() == nil {
+		FailedLookups.Set(key, err)
+	}
+
+	return err
+}
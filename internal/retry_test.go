@@ -0,0 +1,185 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRetryPolicy(slept *[]time.Duration) RetryPolicy {
+	return RetryPolicy{
+		Attempts:  3,
+		BaseDelay: 10 * time.Millisecond,
+		MaxDelay:  time.Second,
+		sleep: func(d time.Duration) {
+			*slept = append(*slept, d)
+		},
+	}
+}
+
+func TestRetryPolicyRetriesTransientErrors(t *testing.T) {
+	var slept []time.Duration
+	calls := 0
+
+	err := testRetryPolicy(&slept).Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return errors.New("connection reset")
+		}
+
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls, "should retry until the call succeeds")
+	assert.Len(t, slept, 2, "should back off between each attempt")
+	for i, d := range slept {
+		assert.LessOrEqual(t, int64(d), int64(10*time.Millisecond)<<uint(i), "backoff should be bounded by the exponential delay")
+	}
+}
+
+func TestRetryPolicyStopsOnPermanentError(t *testing.T) {
+	var slept []time.Duration
+	calls := 0
+	notFound := errors.New("repository not found")
+
+	err := testRetryPolicy(&slept).Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return Permanent(notFound)
+	})
+
+	assert.Equal(t, notFound, err, "permanent errors should be unwrapped")
+	assert.Equal(t, 1, calls, "permanent errors should not be retried")
+}
+
+func TestRetryPolicyHonoursRateLimits(t *testing.T) {
+	var slept []time.Duration
+	calls := 0
+
+	err := testRetryPolicy(&slept).Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls == 1 {
+			return &RateLimitError{RetryAfter: 500 * time.Millisecond}
+		}
+
+		return &RateLimitError{RetryAfter: time.Hour}
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, 2, calls, "should give up when the rate limit resets after the maximum delay")
+	assert.Equal(t, []time.Duration{500 * time.Millisecond}, slept, "should wait for the rate limit to reset")
+}
+
+func TestAPIRateLimitDetection(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/secondary":
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusForbidden)
+		case "/primary":
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", fmt.Sprint(time.Now().Add(time.Minute).Unix()))
+			w.WriteHeader(http.StatusForbidden)
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	var rateLimited *RateLimitError
+	var permanent *permanentError
+
+	_, err := fetchTagNames(context.Background(), server.Client(), server.URL+"/secondary", http.Header{})
+	assert.True(t, errors.As(err, &rateLimited), "403 with Retry-After should be a secondary rate limit")
+	assert.Equal(t, 30*time.Second, rateLimited.RetryAfter)
+
+	_, err = fetchTagNames(context.Background(), server.Client(), server.URL+"/primary", http.Header{})
+	assert.True(t, errors.As(err, &rateLimited), "403 with no remaining quota should be a primary rate limit")
+	assert.InDelta(t, float64(time.Minute), float64(rateLimited.RetryAfter), float64(2*time.Second))
+
+	_, err = fetchTagNames(context.Background(), server.Client(), server.URL+"/missing", http.Header{})
+	assert.True(t, errors.As(err, &permanent), "client errors should not be retried")
+
+	_, err = fetchTagNames(context.Background(), server.Client(), server.URL+"/error", http.Header{})
+	assert.False(t, errors.As(err, &permanent), "server errors should be retried")
+}
+
+func TestRetryPolicyStopsWhenContextDone(t *testing.T) {
+	policy := RetryPolicy{Attempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	calls := 0
+	err := policy.Do(ctx, func(ctx context.Context) error {
+		calls++
+		return errors.New("connection reset")
+	})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "waiting between attempts should stop when the context is done")
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryPolicyTimeoutBoundsAttempts(t *testing.T) {
+	policy := RetryPolicy{Attempts: 2, Timeout: 10 * time.Millisecond}
+
+	err := policy.Do(context.Background(), func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "the lookup should be abandoned once the timeout passes")
+}
+
+func TestRetryingTagProvider(t *testing.T) {
+	var slept []time.Duration
+	provider := NewRetryingTagProvider(&flakyTagProvider{failures: 2}, testRetryPolicy(&slept))
+	remoteURL, _ := url.Parse("https://example.com/org/repo.git")
+
+	tags, err := provider.Tags(context.Background(), remoteURL)
+	assert.NoError(t, err)
+	assert.Len(t, tags, 1)
+}
+
+func TestRetryingTagProviderCachesFailures(t *testing.T) {
+	var slept []time.Duration
+	flaky := &flakyTagProvider{failures: 10}
+	provider := NewRetryingTagProvider(flaky, testRetryPolicy(&slept))
+	remoteURL, _ := url.Parse("https://example.com/org/unresolvable.git")
+
+	_, err := provider.Tags(context.Background(), remoteURL)
+	assert.EqualError(t, err, "temporary failure")
+	assert.Equal(t, 7, flaky.failures, "the lookup should be attempted as often as the policy allows")
+
+	_, err = provider.Tags(context.Background(), remoteURL)
+	assert.EqualError(t, err, "temporary failure", "the failure should be returned again")
+	assert.Equal(t, 7, flaky.failures, "a lookup which has failed should not be retried")
+	assert.Len(t, slept, 2, "a lookup which has failed should not back off again")
+
+	otherURL, _ := url.Parse("https://example.com/org/other.git")
+	_, err = provider.Tags(context.Background(), otherURL)
+	assert.Error(t, err)
+	assert.Equal(t, 4, flaky.failures, "other repositories should still be looked up")
+}
+
+type flakyTagProvider struct {
+	failures int
+}
+
+func (p *flakyTagProvider) Tags(ctx context.Context, remoteURL *url.URL) (semver.Collection, error) {
+	if p.failures > 0 {
+		p.failures--
+		return nil, errors.New("temporary failure")
+	}
+
+	return parseSemverTags([]string{"v1.0.0"})
+}
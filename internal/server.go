@@ -0,0 +1,256 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/Masterminds/semver"
+	"github.com/jbrailsford/tfmodref/util"
+)
+
+// Scanner calls visit with the git sources found in each file of a file/folder tree,
+// optionally including their remote versions.
+type Scanner func(ctx context.Context, includeRemote bool, visit func(path string, sources map[string]GitSource))
+
+// Server exposes scanning, resolution and planning over a JSON API, so that module versions
+// can be queried without running the CLI for each request. Remote lookups are shared between
+// requests through SourceCache and ReleaseDateCache, and bounded by RemoteLookups.
+type Server struct {
+	Scan Scanner
+}
+
+// InventoryItem is a single module reference, as listed by the inventory endpoints.
+type InventoryItem struct {
+	Module     string `json:"module"`
+	File       string `json:"file"`
+	Repository string `json:"repository"`
+	Version    string `json:"version"`
+	Yanked     bool   `json:"yanked,omitempty"`
+	Latest     string `json:"latest,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Inventory is the response of the inventory endpoints, modules whose remote versions could
+// not be retrieved are listed separately.
+type Inventory struct {
+	Modules    []InventoryItem `json:"modules"`
+	Unresolved []InventoryItem `json:"unresolved,omitempty"`
+}
+
+// PlanRequest is the policy used to plan updates. Without a version or constraint sources are
+// planned to be updated to their latest version.
+type PlanRequest struct {
+	Version            string `json:"version,omitempty"`
+	Constraint         string `json:"constraint,omitempty"`
+	Repository         string `json:"repository,omitempty"`
+	AllowDowngrades    bool   `json:"allow_downgrades,omitempty"`
+	VersionUnversioned bool   `json:"version_unversioned,omitempty"`
+	MinAge             string `json:"min_age,omitempty"`
+}
+
+// PlanResponse lists the changes planned, including those skipped and the reason why.
+type PlanResponse struct {
+	Changes []*Change `json:"changes"`
+}
+
+// NewServer creates a Server for the sources found by the given scanner.
+func NewServer(scan Scanner) *Server {
+	return &Server{Scan: scan}
+}
+
+// Handler returns the handler serving the API:
+//
+//	GET  /inventory  every module reference, with its latest version if ?remote=true
+//	GET  /outdated   the module references with a newer version available
+//	POST /plan       the updates planned for the policy in the request body
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/inventory", allowMethod(http.MethodGet, s.inventory))
+	mux.HandleFunc("/outdated", allowMethod(http.MethodGet, s.outdated))
+	mux.HandleFunc("/plan", allowMethod(http.MethodPost, s.plan))
+
+	return mux
+}
+
+func (s *Server) inventory(w http.ResponseWriter, r *http.Request) {
+	includeRemote := r.URL.Query().Get("remote") == "true"
+	writeJSON(w, http.StatusOK, s.collectInventory(r.Context(), includeRemote, func(*GitSource) bool {
+		return true
+	}))
+}
+
+func (s *Server) outdated(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.collectInventory(r.Context(), true, func(source *GitSource) bool {
+		return source.localVersion != nil && source.LatestRemoteVersion != nil && source.localVersion.LessThan(source.LatestRemoteVersion)
+	}))
+}
+
+func (s *Server) collectInventory(ctx context.Context, includeRemote bool, include func(*GitSource) bool) Inventory {
+	inventory := Inventory{Modules: []InventoryItem{}}
+	s.Scan(ctx, includeRemote, func(path string, sources map[string]GitSource) {
+		for module, source := range sources {
+			source := source
+			item := InventoryItem{
+				Module:  module,
+				File:    source.FilePath,
+				Version: source.LocalVersionString(),
+				Yanked:  source.IsYanked(),
+			}
+
+			if !source.IsEvaluated() {
+				item.Error = source.UpdateError.Error()
+				inventory.Unresolved = append(inventory.Unresolved, item)
+				continue
+			}
+
+			item.Repository = source.RemoteURL.String()
+			if !source.IsResolved() {
+				item.Error = source.RemoteError.Error()
+				inventory.Unresolved = append(inventory.Unresolved, item)
+				continue
+			}
+
+			if !include(&source) {
+				continue
+			}
+
+			if source.LatestRemoteVersion != nil {
+				item.Latest = source.LatestRemoteVersion.Original()
+			}
+
+			inventory.Modules = append(inventory.Modules, item)
+		}
+	})
+
+	sortInventory(inventory.Modules)
+	sortInventory(inventory.Unresolved)
+
+	return inventory
+}
+
+func (s *Server) plan(w http.ResponseWriter, r *http.Request) {
+	var request PlanRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid plan request (%s)", err.Error()))
+		return
+	}
+
+	policy, resolve, err := request.policy()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	response := PlanResponse{Changes: []*Change{}}
+	s.Scan(r.Context(), request.Version == "", func(path string, sources map[string]GitSource) {
+		for module, source := range sources {
+			source := source
+			if change := policy.Plan(r.Context(), module, &source, resolve); change != nil {
+				response.Changes = append(response.Changes, change)
+			}
+		}
+	})
+
+	sort.Slice(response.Changes, func(i, j int) bool {
+		return response.Changes[i].Module < response.Changes[j].Module
+	})
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// policy parses the request into the policy and resolver used to plan updates.
+func (p PlanRequest) policy() (Policy, Resolver, error) {
+	policy := Policy{
+		AllowDowngrades:    p.AllowDowngrades,
+		VersionUnversioned: p.VersionUnversioned,
+	}
+
+	if p.MinAge != "" {
+		minAge, err := util.ParseDuration(p.MinAge)
+		if err != nil {
+			return policy, nil, fmt.Errorf("min_age %s is invalid (%s)", p.MinAge, err.Error())
+		}
+		policy.MinAge = minAge
+	}
+
+	var version *semver.Version
+	if p.Version != "" {
+		var err error
+		if version, err = semver.NewVersion(p.Version); err != nil {
+			return policy, nil, fmt.Errorf("version %s is invalid (%s)", p.Version, err.Error())
+		}
+	}
+
+	var constraint *semver.Constraints
+	if p.Constraint != "" {
+		var err error
+		if constraint, err = semver.NewConstraint(p.Constraint); err != nil {
+			return policy, nil, fmt.Errorf("constraint %s is invalid (%s)", p.Constraint, err.Error())
+		}
+	}
+
+	var repository *url.URL
+	if p.Repository != "" {
+		var err error
+		if repository, err = ParseRemoteURL(p.Repository); err != nil {
+			return policy, nil, fmt.Errorf("repository %s is invalid (%s)", p.Repository, err.Error())
+		}
+	}
+
+	resolve := func(source *GitSource) (*semver.Version, error) {
+		if repository != nil && !SameRepository(source.RemoteURL, repository) {
+			return nil, nil
+		}
+
+		if version != nil {
+			return version, nil
+		}
+
+		if constraint != nil {
+			if matchedVersion := source.FindLatestTagForConstraint(constraint); matchedVersion != nil {
+				return matchedVersion, nil
+			}
+
+			return nil, errors.New("no remote version matches the constraint")
+		}
+
+		return source.LatestRemoteVersion, nil
+	}
+
+	return policy, resolve, nil
+}
+
+func allowMethod(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func sortInventory(items []InventoryItem) {
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Module < items[j].Module
+	})
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const serverFixture = `module "vpc" {
+  source = "git::https://github.com/terraform-aws-modules/terraform-aws-vpc.git?ref=v2.0.0"
+}
+
+module "network" {
+  source = "git::ssh://git@gitlab.com/example/terraform-modules.git//network?ref=v0.2.0"
+}
+`
+
+func testServer(t *testing.T) *httptest.Server {
+	provider, err := NewFixtureTagProvider("testdata/tags.json")
+	require.NoError(t, err)
+
+	previous := TagProviders
+	TagProviders = NewTagProviderRegistry(provider)
+	t.Cleanup(func() { TagProviders = previous })
+
+	path := writeTestFile(t, "main.tf", serverFixture)
+	scan := func(ctx context.Context, includeRemote bool, visit func(path string, sources map[string]GitSource)) {
+		parser, errs := NewHclParser(path)
+		require.Nil(t, errs)
+
+		sources, err := parser.FindGitSources(ctx, includeRemote)
+		require.NoError(t, err)
+		visit(path, sources)
+	}
+
+	server := httptest.NewServer(NewServer(scan).Handler())
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func decodeResponse(t *testing.T, response *http.Response, v interface{}) {
+	defer response.Body.Close()
+	assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+	require.NoError(t, json.NewDecoder(response.Body).Decode(v))
+}
+
+func TestServerInventory(t *testing.T) {
+	server := testServer(t)
+
+	response, err := http.Get(server.URL + "/inventory")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+
+	var inventory Inventory
+	decodeResponse(t, response, &inventory)
+	require.Len(t, inventory.Modules, 2)
+	assert.Equal(t, "v0.2.0", inventory.Modules[0].Version)
+	assert.Empty(t, inventory.Modules[0].Latest, "latest versions should only be included with ?remote=true")
+	assert.Equal(t, "v2.0.0", inventory.Modules[1].Version)
+
+	response, err = http.Get(server.URL + "/inventory?remote=true")
+	require.NoError(t, err)
+	decodeResponse(t, response, &inventory)
+	assert.Equal(t, "v3.1.0", inventory.Modules[1].Latest)
+}
+
+func TestServerOutdated(t *testing.T) {
+	server := testServer(t)
+
+	response, err := http.Get(server.URL + "/outdated")
+	require.NoError(t, err)
+
+	var inventory Inventory
+	decodeResponse(t, response, &inventory)
+	require.Len(t, inventory.Modules, 1, "modules on their latest version should not be listed")
+	assert.Equal(t, "v2.0.0", inventory.Modules[0].Version)
+	assert.Equal(t, "v3.1.0", inventory.Modules[0].Latest)
+}
+
+func TestServerPlan(t *testing.T) {
+	server := testServer(t)
+
+	post := func(body string) *http.Response {
+		response, err := http.Post(server.URL+"/plan", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		return response
+	}
+
+	var plan PlanResponse
+	response := post(`{"constraint": "~2 || ~3.0.0"}`)
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	decodeResponse(t, response, &plan)
+	require.Len(t, plan.Changes, 2)
+	assert.Equal(t, "no remote version matches the constraint", plan.Changes[0].Skipped, "versions outside the constraint should never be chosen")
+	assert.Equal(t, "v2.0.0", plan.Changes[1].From)
+	assert.Equal(t, "v3.0.0", plan.Changes[1].To)
+
+	plan = PlanResponse{}
+	response = post(`{"version": "v0.1.0", "repository": "ssh://git@gitlab.com/example/terraform-modules.git"}`)
+	decodeResponse(t, response, &plan)
+	require.Len(t, plan.Changes, 1, "only sources of the repository should be planned")
+	assert.Equal(t, "target version 0.1.0 is less than current version v0.2.0", plan.Changes[0].Skipped)
+
+	plan = PlanResponse{}
+	response = post(`{"version": "v0.1.0", "allow_downgrades": true}`)
+	decodeResponse(t, response, &plan)
+	require.Len(t, plan.Changes, 2)
+	assert.True(t, plan.Changes[0].IsUpdate())
+
+	for _, body := range []string{`{"constraint": "not a constraint"}`, `{"min_age": "-1d"}`, `{"unknown": true}`, `{`} {
+		response = post(body)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode, body)
+		response.Body.Close()
+	}
+}
+
+func TestServerMethodNotAllowed(t *testing.T) {
+	server := testServer(t)
+
+	response, err := http.Post(server.URL+"/inventory", "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+	assert.Equal(t, http.MethodGet, response.Header.Get("Allow"))
+}
@@ -0,0 +1,282 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/semver"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	pgpPublicKeyBlock = "-----BEGIN PGP PUBLIC KEY BLOCK-----"
+	sshSignatureBlock = "-----BEGIN SSH SIGNATURE-----"
+
+	// sshSignatureMagic prefixes both SSH signatures and the data they sign, as described
+	// in https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.sshsig
+	sshSignatureMagic = "SSHSIG"
+
+	// sshSignatureNamespace is the namespace git signs tags and commits in.
+	sshSignatureNamespace = "git"
+)
+
+// TagVerifier verifies that the tags of module versions are annotated tags, signed with either
+// a GPG or SSH key from its keyring. Results are cached per repository and tag.
+type TagVerifier struct {
+	pgpKeys openpgp.EntityList
+	sshKeys []ssh.PublicKey
+	mu      sync.Mutex
+	results map[string]string
+}
+
+// sshSignature is the binary form of an SSH signature, following its magic preamble.
+type sshSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// sshSignedData is the data signed by an SSH signature, following its magic preamble.
+type sshSignedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// NewTagVerifier creates a TagVerifier with an empty keyring.
+func NewTagVerifier() *TagVerifier {
+	return &TagVerifier{
+		results: make(map[string]string),
+	}
+}
+
+// LoadKeyring adds the keys in the file at the given path to the keyring. The file may either be
+// an armored GPG public key block, or list SSH public keys one per line, in authorized_keys or
+// allowed signers format.
+func (v *TagVerifier) LoadKeyring(path string) error {
+	raw, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+
+	if bytes.Contains(raw, []byte(pgpPublicKeyBlock)) {
+		entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(raw))
+		if err != nil {
+			return fmt.Errorf("invalid keyring %s (%s)", path, err.Error())
+		}
+
+		v.pgpKeys = append(v.pgpKeys, entities...)
+		return nil
+	}
+
+	for i, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, err := parseSSHPublicKey(line)
+		if err != nil {
+			return fmt.Errorf("invalid keyring %s, line %d (%s)", path, i+1, err.Error())
+		}
+
+		v.sshKeys = append(v.sshKeys, key)
+	}
+
+	return nil
+}
+
+// parseSSHPublicKey parses a line in authorized_keys format or in allowed signers format, where
+// the key is preceded by the principals, and possibly options, it is allowed to sign as.
+func parseSSHPublicKey(line string) (ssh.PublicKey, error) {
+	fields := strings.Fields(line)
+
+	var err error
+	for i := range fields {
+		var key ssh.PublicKey
+		if key, _, _, _, err = ssh.ParseAuthorizedKey([]byte(strings.Join(fields[i:], " "))); err == nil {
+			return key, nil
+		}
+	}
+
+	return nil, err
+}
+
+// Verify fetches the tag of the given version of the repository, and verifies it is an annotated
+// tag of the same name signed by a key in the keyring, returning the reason it is not if
+// verification fails. An error is returned, rather than a reason, if the tag can't be fetched,
+// and isn't cached so the tag is fetched again when next verified.
+func (v *TagVerifier) Verify(ctx context.Context, remoteURL *url.URL, version *semver.Version) (string, error) {
+	key := remoteURL.String() + "@" + version.Original()
+
+	v.mu.Lock()
+	reason, ok := v.results[key]
+	v.mu.Unlock()
+	if ok {
+		return reason, nil
+	}
+
+	repo, err := fetchTag(ctx, remoteURL.String(), version.Original())
+	if err != nil {
+		return "", fmt.Errorf("could not fetch tag %s (%s)", version.Original(), err.Error())
+	}
+
+	tag, _, err := tagObjects(repo, version.Original())
+	if err != nil {
+		return "", fmt.Errorf("could not read tag %s (%s)", version.Original(), err.Error())
+	}
+
+	switch {
+	case tag == nil:
+		reason = fmt.Sprintf("%s is a lightweight tag, which can't be signed", version.Original())
+	case tag.Name != version.Original():
+		reason = fmt.Sprintf("tag %s refers to a tag object named %s", version.Original(), tag.Name)
+	default:
+		if err := v.verifyTag(tag); err != nil {
+			reason = err.Error()
+		}
+	}
+
+	v.mu.Lock()
+	v.results[key] = reason
+	v.mu.Unlock()
+
+	return reason, nil
+}
+
+// verifyTag verifies the signature of an annotated tag. GPG signatures are separated from the
+// message by go-git, whereas SSH signatures are left at the end of it.
+func (v *TagVerifier) verifyTag(tag *object.Tag) error {
+	if tag.PGPSignature != "" {
+		return v.verifyPGPSignature(tag)
+	}
+
+	if i := strings.Index(tag.Message, sshSignatureBlock); i >= 0 {
+		unsigned := *tag
+		unsigned.Message = tag.Message[:i]
+
+		payload, err := encodeTag(&unsigned)
+		if err != nil {
+			return err
+		}
+
+		return v.verifySSHSignature(payload, []byte(tag.Message[i:]))
+	}
+
+	return fmt.Errorf("tag %s is not signed", tag.Name)
+}
+
+func (v *TagVerifier) verifyPGPSignature(tag *object.Tag) error {
+	if len(v.pgpKeys) == 0 {
+		return fmt.Errorf("tag %s is signed with GPG, but there are no GPG keys in the keyring", tag.Name)
+	}
+
+	payload, err := encodeTag(tag)
+	if err != nil {
+		return err
+	}
+
+	if _, err := openpgp.CheckArmoredDetachedSignature(v.pgpKeys, bytes.NewReader(payload), strings.NewReader(tag.PGPSignature), nil); err != nil {
+		return fmt.Errorf("GPG signature of tag %s is not valid for any key in the keyring (%s)", tag.Name, err.Error())
+	}
+
+	return nil
+}
+
+func (v *TagVerifier) verifySSHSignature(payload []byte, armored []byte) error {
+	block, _ := pem.Decode(armored)
+	if block == nil || block.Type != "SSH SIGNATURE" || !bytes.HasPrefix(block.Bytes, []byte(sshSignatureMagic)) {
+		return errors.New("SSH signature is malformed")
+	}
+
+	var signature sshSignature
+	if err := ssh.Unmarshal(block.Bytes[len(sshSignatureMagic):], &signature); err != nil {
+		return fmt.Errorf("SSH signature is malformed (%s)", err.Error())
+	}
+
+	if signature.Namespace != sshSignatureNamespace {
+		return fmt.Errorf("SSH signature is for namespace %s, not %s", signature.Namespace, sshSignatureNamespace)
+	}
+
+	publicKey, err := ssh.ParsePublicKey(signature.PublicKey)
+	if err != nil {
+		return fmt.Errorf("SSH signature has an invalid public key (%s)", err.Error())
+	}
+
+	if !v.hasSSHKey(publicKey) {
+		return fmt.Errorf("SSH signature is from key %s, which is not in the keyring", ssh.FingerprintSHA256(publicKey))
+	}
+
+	var h hash.Hash
+	switch signature.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return fmt.Errorf("SSH signature uses unsupported hash algorithm %s", signature.HashAlgorithm)
+	}
+	h.Write(payload)
+
+	signed := append([]byte(sshSignatureMagic), ssh.Marshal(sshSignedData{
+		Namespace:     signature.Namespace,
+		Reserved:      signature.Reserved,
+		HashAlgorithm: signature.HashAlgorithm,
+		Hash:          h.Sum(nil),
+	})...)
+
+	var sig ssh.Signature
+	if err := ssh.Unmarshal(signature.Signature, &sig); err != nil {
+		return fmt.Errorf("SSH signature is malformed (%s)", err.Error())
+	}
+
+	if err := publicKey.Verify(signed, &sig); err != nil {
+		return fmt.Errorf("SSH signature is not valid (%s)", err.Error())
+	}
+
+	return nil
+}
+
+func (v *TagVerifier) hasSSHKey(key ssh.PublicKey) bool {
+	for _, k := range v.sshKeys {
+		if bytes.Equal(k.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// encodeTag returns the tag object as signed, i.e., without any GPG signature.
+func encodeTag(tag *object.Tag) ([]byte, error) {
+	encoded := &plumbing.MemoryObject{}
+	if err := tag.EncodeWithoutSignature(encoded); err != nil {
+		return nil, err
+	}
+
+	reader, err := encoded.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
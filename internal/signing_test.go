@@ -0,0 +1,216 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/pem"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestTagVerifier(t *testing.T) {
+	dir := newTestRepository(t, "v1.0.0")
+	repo, err := git.PlainOpen(dir)
+	require.NoError(t, err)
+
+	head, err := repo.Head()
+	require.NoError(t, err)
+
+	tagger := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	pgpKey, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	require.NoError(t, err)
+
+	_, err = repo.CreateTag("v1.1.0", head.Hash(), &git.CreateTagOptions{Tagger: tagger, Message: "unsigned"})
+	require.NoError(t, err)
+	_, err = repo.CreateTag("v1.2.0", head.Hash(), &git.CreateTagOptions{Tagger: tagger, Message: "gpg", SignKey: pgpKey})
+	require.NoError(t, err)
+
+	trustedKey, untrustedKey := newSSHSigner(t), newSSHSigner(t)
+	createSSHSignedTag(t, repo, "v1.3.0", head.Hash(), trustedKey)
+	createSSHSignedTag(t, repo, "v1.4.0", head.Hash(), untrustedKey)
+
+	// v1.5.0 refers to the signed tag object of v1.3.0, which must not vouch for another version.
+	signed, err := repo.Tag("v1.3.0")
+	require.NoError(t, err)
+	require.NoError(t, repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewTagReferenceName("v1.5.0"), signed.Hash())))
+
+	keys := t.TempDir()
+	allowedSigners := "# trusted release keys\ntest@example.com " + string(ssh.MarshalAuthorizedKey(trustedKey.PublicKey()))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(keys, "allowed_signers"), []byte(allowedSigners), 0600))
+
+	var armored bytes.Buffer
+	w, err := armor.Encode(&armored, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, pgpKey.Serialize(w))
+	require.NoError(t, w.Close())
+	require.NoError(t, ioutil.WriteFile(filepath.Join(keys, "keys.asc"), armored.Bytes(), 0600))
+
+	verifier := NewTagVerifier()
+	require.NoError(t, verifier.LoadKeyring(filepath.Join(keys, "allowed_signers")))
+	require.NoError(t, verifier.LoadKeyring(filepath.Join(keys, "keys.asc")))
+
+	remoteURL, _ := url.Parse("file://" + filepath.ToSlash(dir))
+	cases := map[string]string{
+		"v1.0.0": "lightweight tag",
+		"v1.1.0": "is not signed",
+		"v1.2.0": "",
+		"v1.3.0": "",
+		"v1.4.0": "not in the keyring",
+		"v1.5.0": "refers to a tag object named v1.3.0",
+	}
+
+	for tag, expected := range cases {
+		reason, err := verifier.Verify(context.Background(), remoteURL, semver.MustParse(tag))
+		require.NoError(t, err, "tag %s should be fetched", tag)
+		if expected == "" {
+			assert.Empty(t, reason, "tag %s should be verified", tag)
+		} else {
+			assert.Contains(t, reason, expected, "tag %s should fail verification", tag)
+		}
+	}
+
+	_, err = verifier.Verify(context.Background(), remoteURL, semver.MustParse("v9.9.9"))
+	if assert.Error(t, err, "tags which can't be fetched should be an error, not a failed verification") {
+		assert.Contains(t, err.Error(), "could not fetch tag")
+	}
+}
+
+// TestTagVerifierSSHFixture verifies a tag created by `git tag -s` with gpg.format set to ssh,
+// which signs it with `ssh-keygen -Y sign -n git`, so the format is checked against the real tool
+// rather than only signatures created by the tests.
+func TestTagVerifierSSHFixture(t *testing.T) {
+	raw, err := ioutil.ReadFile("testdata/signing/ssh_signed_tag")
+	require.NoError(t, err)
+
+	decode := func(raw []byte) *object.Tag {
+		obj := &plumbing.MemoryObject{}
+		obj.SetType(plumbing.TagObject)
+		_, err := obj.Write(raw)
+		require.NoError(t, err)
+
+		tag := &object.Tag{}
+		require.NoError(t, tag.Decode(obj))
+		return tag
+	}
+
+	verifier := NewTagVerifier()
+	require.NoError(t, verifier.LoadKeyring("testdata/signing/allowed_signers"))
+	assert.NoError(t, verifier.verifyTag(decode(raw)))
+
+	tampered := bytes.Replace(raw, []byte("release v1.0.0"), []byte("release v1.0.1"), 1)
+	err = verifier.verifyTag(decode(tampered))
+	if assert.Error(t, err, "a tag changed after signing should fail verification") {
+		assert.Contains(t, err.Error(), "SSH signature is not valid")
+	}
+
+	assert.Error(t, NewTagVerifier().verifyTag(decode(raw)), "a tag signed by a key not in the keyring should fail verification")
+}
+
+// TestPolicyPlanFallsBackFromUnverifiedVersions checks versions are tried highest first, until
+// one passes verification, keeping to those the resolver allows.
+func TestPolicyPlanFallsBackFromUnverifiedVersions(t *testing.T) {
+	dir := newTestRepository(t, "v1.0.0")
+	repo, err := git.PlainOpen(dir)
+	require.NoError(t, err)
+
+	head, err := repo.Head()
+	require.NoError(t, err)
+
+	trustedKey := newSSHSigner(t)
+	createSSHSignedTag(t, repo, "v1.1.0", head.Hash(), trustedKey)
+	createSSHSignedTag(t, repo, "v1.2.0", head.Hash(), trustedKey)
+	createSSHSignedTag(t, repo, "v1.3.0", head.Hash(), newSSHSigner(t))
+	_, err = repo.CreateTag("v1.4.0", head.Hash(), nil)
+	require.NoError(t, err)
+
+	keys := filepath.Join(t.TempDir(), "allowed_signers")
+	require.NoError(t, ioutil.WriteFile(keys, ssh.MarshalAuthorizedKey(trustedKey.PublicKey()), 0600))
+
+	verifier := NewTagVerifier()
+	require.NoError(t, verifier.LoadKeyring(keys))
+
+	remoteURL, _ := url.Parse("file://" + filepath.ToSlash(dir))
+	source := GitSource{RemoteURL: remoteURL, localVersion: semver.MustParse("v1.0.0")}
+	source.setRemoteTags(semver.Collection{
+		semver.MustParse("v1.0.0"), semver.MustParse("v1.1.0"), semver.MustParse("v1.2.0"), semver.MustParse("v1.3.0"), semver.MustParse("v1.4.0"),
+	})
+
+	change := Policy{Verifier: verifier}.Plan(context.Background(), "main.tf [vpc]", &source, latest)
+	require.True(t, change.IsUpdate(), change.Skipped)
+	assert.Equal(t, "v1.2.0", change.To, "the highest version which passes verification should be chosen")
+
+	exact := func(*GitSource) (*semver.Version, error) { return semver.MustParse("v1.4.0"), nil }
+	change = Policy{Verifier: verifier}.Plan(context.Background(), "main.tf [vpc]", &source, exact)
+	assert.Contains(t, change.Skipped, "failed signature verification", "a specific version which fails verification shouldn't be fallen back from")
+
+	source.localVersion = semver.MustParse("v1.2.0")
+	change = Policy{Verifier: verifier}.Plan(context.Background(), "main.tf [vpc]", &source, latest)
+	assert.Contains(t, change.Skipped, "and no version allowed between it and v1.2.0 could be chosen instead")
+
+	missing := func(*GitSource) (*semver.Version, error) { return semver.MustParse("v1.5.0"), nil }
+	source.localVersion = semver.MustParse("v1.0.0")
+	change = Policy{Verifier: verifier}.Plan(context.Background(), "main.tf [vpc]", &source, missing)
+	assert.Equal(t, "could not verify the signature of version v1.5.0", change.Skipped, "a tag which can't be fetched shouldn't be fallen back from")
+	assert.Error(t, change.RemoteError)
+}
+
+func newSSHSigner(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	signer, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+
+	return signer
+}
+
+// createSSHSignedTag creates an annotated tag signed in the same way as `git tag -s` with
+// gpg.format set to ssh, i.e., with the armored signature appended to the message.
+func createSSHSignedTag(t *testing.T, repo *git.Repository, name string, target plumbing.Hash, signer ssh.Signer) {
+	tag := &object.Tag{
+		Name:       name,
+		Tagger:     object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		Message:    "release\n",
+		TargetType: plumbing.CommitObject,
+		Target:     target,
+	}
+
+	payload, err := encodeTag(tag)
+	require.NoError(t, err)
+
+	hash := sha512.Sum512(payload)
+	signed := append([]byte(sshSignatureMagic), ssh.Marshal(sshSignedData{Namespace: sshSignatureNamespace, HashAlgorithm: "sha512", Hash: hash[:]})...)
+	signature, err := signer.Sign(rand.Reader, signed)
+	require.NoError(t, err)
+
+	blob := append([]byte(sshSignatureMagic), ssh.Marshal(sshSignature{
+		Version:       1,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     sshSignatureNamespace,
+		HashAlgorithm: "sha512",
+		Signature:     ssh.Marshal(signature),
+	})...)
+	tag.Message += string(pem.EncodeToMemory(&pem.Block{Type: "SSH SIGNATURE", Bytes: blob}))
+
+	obj := repo.Storer.NewEncodedObject()
+	require.NoError(t, tag.Encode(obj))
+	tagHash, err := repo.Storer.SetEncodedObject(obj)
+	require.NoError(t, err)
+	require.NoError(t, repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewTagReferenceName(name), tagHash)))
+}
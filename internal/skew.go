@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"sort"
+
+	"github.com/Masterminds/semver"
+)
+
+// VersionSkew groups git sources by repository, recording which versions of each repository
+// are in use, and where, to show where references have drifted apart.
+type VersionSkew struct {
+	repositories map[string]*RepositorySkew
+}
+
+// RepositorySkew holds every version of a single repository in use, along with the newest
+// version available remotely, if known.
+type RepositorySkew struct {
+	RemoteURL string
+	Latest    *semver.Version
+	versions  map[string]*VersionUsage
+}
+
+// VersionUsage lists the modules, and the distinct files containing them, using a version.
+type VersionUsage struct {
+	Version string
+	Modules []string
+	Files   []string
+	version *semver.Version
+}
+
+// NewVersionSkew creates an empty VersionSkew.
+func NewVersionSkew() *VersionSkew {
+	return &VersionSkew{
+		repositories: make(map[string]*RepositorySkew),
+	}
+}
+
+// Add records the version of the given source in use by the named module.
+func (s *VersionSkew) Add(module string, source GitSource) {
+	remoteURL := source.RemoteURL.String()
+
+	repository, ok := s.repositories[remoteURL]
+	if !ok {
+		repository = &RepositorySkew{
+			RemoteURL: remoteURL,
+			versions:  make(map[string]*VersionUsage),
+		}
+		s.repositories[remoteURL] = repository
+	}
+
+	if source.LatestRemoteVersion != nil {
+		repository.Latest = source.LatestRemoteVersion
+	}
+
+	version := source.LocalVersionString()
+	usage, ok := repository.versions[version]
+	if !ok {
+		usage = &VersionUsage{Version: version}
+		if !source.LocalVersionIsMain {
+			usage.version = source.localVersion
+		}
+		repository.versions[version] = usage
+	}
+
+	usage.Modules = append(usage.Modules, module)
+	if !containsString(usage.Files, source.FilePath) {
+		usage.Files = append(usage.Files, source.FilePath)
+	}
+}
+
+// Repositories returns every repository seen, ordered by URL.
+func (s *VersionSkew) Repositories() []*RepositorySkew {
+	repositories := make([]*RepositorySkew, 0, len(s.repositories))
+	for _, repository := range s.repositories {
+		repositories = append(repositories, repository)
+	}
+
+	sort.Slice(repositories, func(i, j int) bool {
+		return repositories[i].RemoteURL < repositories[j].RemoteURL
+	})
+
+	return repositories
+}
+
+// Versions returns the versions of the repository in use, oldest first, with any sources
+// tracking HEAD (or with versions which aren't valid semver) listed last.
+func (r *RepositorySkew) Versions() []*VersionUsage {
+	versions := make([]*VersionUsage, 0, len(r.versions))
+	for _, usage := range r.versions {
+		sort.Strings(usage.Modules)
+		sort.Strings(usage.Files)
+		versions = append(versions, usage)
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		a, b := versions[i].version, versions[j].version
+		if (a == nil) != (b == nil) {
+			return a != nil
+		}
+
+		if a == nil {
+			return versions[i].Version < versions[j].Version
+		}
+
+		return a.LessThan(b)
+	})
+
+	return versions
+}
+
+// Highest returns the highest version of the repository in use, or nil if every source is
+// tracking HEAD.
+func (r *RepositorySkew) Highest() *semver.Version {
+	var highest *semver.Version
+	for _, usage := range r.versions {
+		if usage.version != nil && (highest == nil || usage.version.GreaterThan(highest)) {
+			highest = usage.version
+		}
+	}
+
+	return highest
+}
+
+// IsSkewed returns true if more than one version of the repository is in use.
+func (r *RepositorySkew) IsSkewed() bool {
+	return len(r.versions) > 1
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
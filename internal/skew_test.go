@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func skewSource(remote string, path string, version string) GitSource {
+	remoteURL, _ := url.Parse(remote)
+	source := GitSource{RemoteURL: remoteURL, FilePath: path, LatestRemoteVersion: semver.MustParse("v5.0.0")}
+	if version == "" {
+		source.LocalVersionIsMain = true
+	} else {
+		source.localVersion = semver.MustParse(version)
+	}
+
+	return source
+}
+
+func TestVersionSkewGroupsByRepository(t *testing.T) {
+	skew := NewVersionSkew()
+	skew.Add("prod/main.tf [vpc]", skewSource("https://example.com/org/vpc.git", "prod/main.tf", "v3.0.0"))
+	skew.Add("prod/main.tf [vpc_secondary]", skewSource("https://example.com/org/vpc.git", "prod/main.tf", "v3.0.0"))
+	skew.Add("dev/main.tf [vpc]", skewSource("https://example.com/org/vpc.git", "dev/main.tf", "v10.0.0"))
+	skew.Add("test/main.tf [vpc]", skewSource("https://example.com/org/vpc.git", "test/main.tf", ""))
+	skew.Add("dev/main.tf [dns]", skewSource("https://example.com/org/dns.git", "dev/main.tf", "v1.0.0"))
+
+	repositories := skew.Repositories()
+	require.Len(t, repositories, 2)
+	assert.Equal(t, "https://example.com/org/dns.git", repositories[0].RemoteURL, "repositories should be ordered by URL")
+	assert.False(t, repositories[0].IsSkewed())
+
+	vpc := repositories[1]
+	assert.True(t, vpc.IsSkewed())
+	assert.Equal(t, "v5.0.0", vpc.Latest.Original())
+
+	versions := vpc.Versions()
+	require.Len(t, versions, 3)
+	assert.Equal(t, "v3.0.0", versions[0].Version, "versions should be ordered by semver")
+	assert.Equal(t, []string{"prod/main.tf"}, versions[0].Files, "files should be counted once per version")
+	assert.Len(t, versions[0].Modules, 2)
+	assert.Equal(t, "v10.0.0", versions[1].Version)
+	assert.Equal(t, "HEAD", versions[2].Version, "unversioned sources should be listed last")
+}
+
+func TestRepositorySkewHighest(t *testing.T) {
+	skew := NewVersionSkew()
+	skew.Add("dev/main.tf [vpc]", skewSource("https://example.com/org/vpc.git", "dev/main.tf", "v10.0.0"))
+	skew.Add("prod/main.tf [vpc]", skewSource("https://example.com/org/vpc.git", "prod/main.tf", "v3.0.0"))
+	skew.Add("test/main.tf [vpc]", skewSource("https://example.com/org/vpc.git", "test/main.tf", ""))
+	skew.Add("dev/main.tf [dns]", skewSource("https://example.com/org/dns.git", "dev/main.tf", ""))
+
+	repositories := skew.Repositories()
+	require.Len(t, repositories, 2)
+	assert.Nil(t, repositories[0].Highest(), "a repository only tracked at HEAD has no highest version")
+	assert.Equal(t, "v10.0.0", repositories[1].Highest().Original())
+}
+
+func TestVersionSkewNonSemverRef(t *testing.T) {
+	sourceURL, _ := url.Parse("git::https://example.com/org/vpc.git?ref=main")
+	branch := skewSource("https://example.com/org/vpc.git", "test/main.tf", "")
+	branch.LocalVersionIsMain = false
+	branch.SourceURL = sourceURL
+
+	skew := NewVersionSkew()
+	skew.Add("prod/main.tf [vpc]", skewSource("https://example.com/org/vpc.git", "prod/main.tf", "v3.0.0"))
+	skew.Add("test/main.tf [vpc]", branch)
+
+	repositories := skew.Repositories()
+	require.Len(t, repositories, 1)
+
+	versions := repositories[0].Versions()
+	require.Len(t, versions, 2)
+	assert.Equal(t, "v3.0.0", versions[0].Version)
+	assert.Equal(t, "main", versions[1].Version, "refs which aren't semantic versions should be listed last, as written")
+	assert.Equal(t, "v3.0.0", repositories[0].Highest().Original())
+}
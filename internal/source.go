@@ -1,8 +1,12 @@
 package internal
 
 import (
+	"context"
+	"fmt"
 	"net/url"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/Masterminds/semver"
 )
@@ -13,23 +17,58 @@ type GitSource struct {
 	localVersion        *semver.Version
 	LatestRemoteVersion *semver.Version
 	RemoteVersions      semver.Collection
+	ReleaseDates        map[string]time.Time
 	LocalVersionIsMain  bool
 	BlockIndex          int
+	FilePath            string
+	Line                int
+	Subdirectory        string
+	Arguments           []string
 	SourceURL           *url.URL
 	RemoteURL           *url.URL
 	Prefixes            []string
+	RemoteError         error
+	UpdateError         error
+	literal             string
+	refSpan             []int
+	tags                semver.Collection
+	yankedTags          semver.Collection
+	allYanked           bool
+	terragrunt          bool
 }
 
-// LocalVersionString returns either `HEAD` (in the case of no local version being set)
-// or it returns the current local version.
+// LocalVersionString returns either `HEAD` (in the case of no local version being set),
+// the ref as written where it isn't a semantic version, e.g., main, or the current local
+// version. Sources which couldn't be evaluated have an unknown version.
 func (gs *GitSource) LocalVersionString() string {
+	if !gs.IsEvaluated() {
+		return "unknown"
+	}
+
 	if gs.LocalVersionIsMain {
 		return "HEAD"
 	}
 
+	if gs.localVersion == nil {
+		return gs.SourceURL.Query().Get("ref")
+	}
+
 	return gs.localVersion.Original()
 }
 
+// IsEvaluated returns false if the source attribute couldn't be evaluated, e.g., a terragrunt
+// source built from an undefined local, in which case it has no URL, only its location and
+// UpdateError are set.
+func (gs *GitSource) IsEvaluated() bool {
+	return gs.SourceURL != nil || gs.RemoteURL != nil
+}
+
+// IsUnversioned returns true if the source isn't pinned to a semantic version, either tracking
+// HEAD or set to a ref such as a branch or commit.
+func (gs *GitSource) IsUnversioned() bool {
+	return gs.LocalVersionIsMain || gs.localVersion == nil
+}
+
 // WouldForceDowngrade returns true of the current local version is greater than the provided
 // version.
 func (gs *GitSource) WouldForceDowngrade(version *semver.Version) bool {
@@ -49,8 +88,29 @@ func (gs *GitSource) IsVersion(version *semver.Version) bool {
 	return false
 }
 
+// IsResolved returns false if the remote versions were requested but could not be retrieved.
+func (gs *GitSource) IsResolved() bool {
+	return gs.RemoteError == nil
+}
+
+// AllVersionsYanked returns true if the remote versions were retrieved, but every one of them
+// has been yanked, leaving no version to update to.
+func (gs *GitSource) AllVersionsYanked() bool {
+	return gs.allYanked
+}
+
+// IsYanked returns true if the local version has been yanked, either in the yanked versions list
+// or, where the remote versions have been retrieved, by a tag.
+func (gs *GitSource) IsYanked() bool {
+	if gs.IsUnversioned() {
+		return false
+	}
+
+	return containsVersion(gs.yankedTags, gs.localVersion) || YankedVersions.IsYanked(gs.RemoteURL, gs.localVersion)
+}
+
 // FindLatestTagForConstraint finds the latest tag in RemoteVersions matching the given
-// constraint.
+// constraint. Yanked versions are never included in RemoteVersions, so are never found.
 func (gs *GitSource) FindLatestTagForConstraint(constraint *semver.Constraints) *semver.Version {
 	for i := len(gs.RemoteVersions) - 1; i >= 0; i-- {
 		if constraint.Check(gs.RemoteVersions[i]) {
@@ -61,41 +121,291 @@ func (gs *GitSource) FindLatestTagForConstraint(constraint *semver.Constraints)
 	return nil
 }
 
-// UpdateRemoteTags requests a list of git tags from the source origin, and sets
-// them against this GitSource object.
-func (gs *GitSource) UpdateRemoteTags() error {
-	if tags := SourceCache.Get(gs.RemoteURL.String()); tags != nil {
-		gs.setRemoteTags(tags)
-	} else {
-		tags, err := RemoteTags(gs.RemoteURL.String())
-		if err != nil {
-			return err
+// UpdateRemoteTags requests a list of git tags from the source origin, using the
+// TagProvider registered for its host, and sets them against this GitSource object.
+func (gs *GitSource) UpdateRemoteTags(ctx context.Context) error {
+	tags, err := cachedRemoteTags(ctx, gs.RemoteURL)
+	if err != nil {
+		return err
+	}
+
+	gs.setRemoteTags(tags)
+	return nil
+}
+
+// cachedRemoteTags returns the semver tags of the repository at the given URL, using the TagProvider
+// registered for its host, or the SourceCache where they've already been retrieved.
+func cachedRemoteTags(ctx context.Context, remoteURL *url.URL) (semver.Collection, error) {
+	if tags := SourceCache.Get(remoteURL.String()); tags != nil {
+		return tags, nil
+	}
+
+	if err := RemoteLookups.Acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	tags, err := TagProviders.ForURL(remoteURL).Tags(ctx, remoteURL)
+	RemoteLookups.Release()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("no semver tags found in %s", remoteURL)
+	}
+
+	SourceCache.Set(remoteURL.String(), tags)
+	return tags, nil
+}
+
+// UpdateReleaseDates retrieves when each of the given versions was released, using the TagProvider
+// registered for its host, or git where the provider can't report release dates. Only the given
+// versions are looked up, as finding the release date of a tag can take a request of its own.
+func (gs *GitSource) UpdateReleaseDates(ctx context.Context, versions ...*semver.Version) error {
+	if gs.ReleaseDates == nil {
+		gs.ReleaseDates = make(map[string]time.Time)
+	}
+
+	var missing []string
+	for _, version := range versions {
+		if version == nil {
+			continue
+		}
+
+		tag := gs.remoteTag(version)
+		if date, ok := ReleaseDateCache.Get(gs.RemoteURL.String(), tag); ok {
+			if !date.IsZero() {
+				gs.ReleaseDates[tag] = date
+			}
+		} else if !containsString(missing, tag) {
+			missing = append(missing, tag)
 		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	if err := RemoteLookups.Acquire(ctx); err != nil {
+		return err
+	}
+
+	dates, err := releaseDateProvider(TagProviders.ForURL(gs.RemoteURL)).ReleaseDates(ctx, gs.RemoteURL, missing)
+	RemoteLookups.Release()
+	if err != nil {
+		return err
+	}
 
-		gs.setRemoteTags(tags)
-		SourceCache.Set(gs.RemoteURL.String(), gs.RemoteVersions)
+	for _, tag := range missing {
+		// Tags without a release date are cached too, so they aren't looked up again.
+		ReleaseDateCache.Set(gs.RemoteURL.String(), tag, dates[tag])
+		if date, ok := dates[tag]; ok {
+			gs.ReleaseDates[tag] = date
+		}
 	}
 
 	return nil
 }
 
+// UpdateLibyearReleaseDates retrieves the release dates of the local and latest remote versions,
+// which are the only ones Libyear needs.
+func (gs *GitSource) UpdateLibyearReleaseDates(ctx context.Context) error {
+	return gs.UpdateReleaseDates(ctx, gs.localVersion, gs.LatestRemoteVersion)
+}
+
+// remoteTag returns the name of the remote tag of the given version, which may be written
+// differently to the version, e.g., a v1.0.0 tag for a ref of 1.0.0.
+func (gs *GitSource) remoteTag(version *semver.Version) string {
+	for _, tag := range gs.tags {
+		if !isYankedTag(tag) && tag.Equal(version) {
+			return tag.Original()
+		}
+	}
+
+	return version.Original()
+}
+
+// ReleaseDate returns when the given version was released, if known. Versions are matched to
+// tags by semver, so that a ref of 1.0.0 is matched to a v1.0.0 tag.
+func (gs *GitSource) ReleaseDate(version *semver.Version) (time.Time, bool) {
+	if version == nil {
+		return time.Time{}, false
+	}
+
+	if date, ok := gs.ReleaseDates[version.Original()]; ok {
+		return date, true
+	}
+
+	for tag, date := range gs.ReleaseDates {
+		if v, err := semver.NewVersion(tag); err == nil && v.Equal(version) && !isYankedTag(v) {
+			return date, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// LocalReleaseDate returns when the local version was released, if known.
+func (gs *GitSource) LocalReleaseDate() (time.Time, bool) {
+	if gs.LocalVersionIsMain {
+		return time.Time{}, false
+	}
+
+	return gs.ReleaseDate(gs.localVersion)
+}
+
+// Libyear returns the time, in years, between the release of the local version and that of the
+// latest remote version, as a measure of how out of date the source is. It returns false if the
+// source tracks HEAD or either release date is unknown.
+func (gs *GitSource) Libyear() (float64, bool) {
+	local, ok := gs.LocalReleaseDate()
+	if !ok {
+		return 0, false
+	}
+
+	latest, ok := gs.ReleaseDate(gs.LatestRemoteVersion)
+	if !ok {
+		return 0, false
+	}
+
+	if !latest.After(local) {
+		return 0, true
+	}
+
+	return latest.Sub(local).Hours() / (24 * 365.25), true
+}
+
+// ExcludeReleasedAfter removes the remote versions newer than the local version which were
+// released after the given time, or whose release date isn't known, so that they can't be
+// chosen as the version to update to. Only the release dates of those versions are needed.
+func (gs *GitSource) ExcludeReleasedAfter(cutoff time.Time) {
+	var versions semver.Collection
+	for _, version := range gs.RemoteVersions {
+		if gs.localVersion != nil && !version.GreaterThan(gs.localVersion) {
+			versions = append(versions, version)
+		} else if date, ok := gs.ReleaseDate(version); ok && !date.After(cutoff) {
+			versions = append(versions, version)
+		}
+	}
+
+	gs.RemoteVersions = versions
+	gs.LatestRemoteVersion = nil
+	if len(versions) > 0 {
+		gs.LatestRemoteVersion = versions[len(versions)-1]
+	}
+}
+
+// NewerVersions returns the remote versions greater than the local version, or every remote
+// version where the source isn't locally versioned.
+func (gs *GitSource) NewerVersions() semver.Collection {
+	var versions semver.Collection
+	for _, version := range gs.RemoteVersions {
+		if gs.localVersion == nil || version.GreaterThan(gs.localVersion) {
+			versions = append(versions, version)
+		}
+	}
+
+	return versions
+}
+
 // SetSourceVersion updates the git source in memory to change the given sources' version to the version specified.
+// Only the value of the ref parameter is changed, the rest of the source is kept exactly as written.
 func (gs *GitSource) SetSourceVersion(version *semver.Version) {
-	qs := gs.SourceURL.Query()
-	qs.Set("ref", version.Original())
-	gs.SourceURL.RawQuery = qs.Encode()
+	if gs.refSpan != nil {
+		// The literal either only holds part of a source built from interpolation, or contains
+		// escape sequences, so the ref is found by its span within the literal.
+		start, end := gs.refSpan[0], gs.refSpan[1]
+		gs.literal = gs.literal[:start] + version.Original() + gs.literal[end:]
+		gs.refSpan = []int{start, start + len(version.Original())}
+	} else {
+		gs.literal = replaceRef(gs.HCLSafeSourceURL(), version.Original())
+	}
+
+	if sourceURL, err := url.Parse(replaceRef(gs.SourceURL.String(), version.Original())); err == nil {
+		gs.SourceURL = sourceURL
+	}
+
 	gs.localVersion = version
 	gs.LocalVersionIsMain = false
 }
 
+// setRemoteTags sets the remote versions from the given tags, leaving out any versions which
+// have been yanked, whether by a tag or in the yanked versions list.
 func (gs *GitSource) setRemoteTags(tags semver.Collection) {
+	// The tags may be shared through the cache, so are copied before sorting.
+	tags = append(semver.Collection{}, tags...)
 	sort.Sort(tags)
 
-	gs.LatestRemoteVersion = tags[len(tags)-1]
-	gs.RemoteVersions = tags
+	var yankedTags semver.Collection
+	for _, tag := range tags {
+		if isYankedTag(tag) {
+			yankedTags = append(yankedTags, tag)
+		}
+	}
+
+	var versions semver.Collection
+	for _, tag := range tags {
+		if !isYankedTag(tag) && !containsVersion(yankedTags, tag) && !YankedVersions.IsYanked(gs.RemoteURL, tag) {
+			versions = append(versions, tag)
+		}
+	}
+
+	gs.tags = tags
+	gs.yankedTags = yankedTags
+	gs.allYanked = len(tags) > 0 && len(versions) == 0
+	gs.RemoteVersions = versions
+	gs.LatestRemoteVersion = nil
+	if len(versions) > 0 {
+		gs.LatestRemoteVersion = versions[len(versions)-1]
+	}
 }
 
-// HCLSafeSourceURL retruns a url in string form matching the original HCL source (with prefixes attached)
+// HCLSafeSourceURL retruns a url in string form matching the original HCL source (with prefixes attached),
+// as it is written within the quoted literal, i.e., with any escape sequences intact. For sources built
+// from interpolation this is the literal which holds the ref.
 func (gs *GitSource) HCLSafeSourceURL() string {
+	if gs.literal != "" {
+		return gs.literal
+	}
+
 	return gs.SourceURL.String()
 }
+
+// replaceRef sets the value of the ref query parameter in the given source, adding the
+// parameter if it is not present. Unlike url.Values.Encode the other parameters keep
+// their order and escaping.
+func replaceRef(source string, ref string) string {
+	if start, end, ok := refValueSpan(source); ok {
+		return source[:start] + ref + source[end:]
+	}
+
+	if !strings.Contains(source, "?") {
+		return source + "?ref=" + ref
+	}
+
+	if strings.HasSuffix(source, "?") || strings.HasSuffix(source, "&") {
+		return source + "ref=" + ref
+	}
+
+	return source + "&ref=" + ref
+}
+
+// refValueSpan returns the start and end offsets of the value of the ref query parameter
+// within the given source, or false if the source has no ref.
+func refValueSpan(source string) (int, int, bool) {
+	queryStart := strings.Index(source, "?")
+	if queryStart < 0 {
+		return 0, 0, false
+	}
+
+	offset := queryStart + 1
+	for _, param := range strings.Split(source[offset:], "&") {
+		if strings.HasPrefix(param, "ref=") {
+			return offset + len("ref="), offset + len(param), true
+		}
+
+		offset += len(param) + 1
+	}
+
+	return 0, 0, false
+}
@@ -3,6 +3,7 @@ package internal
 import (
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/Masterminds/semver"
 	"github.com/stretchr/testify/assert"
@@ -59,6 +60,10 @@ func init() {
 func TestLocalVersionString(t *testing.T) {
 	assert.Equal(t, "HEAD", unversionedSource.LocalVersionString(), "local version string should be HEAD when no local version set")
 	assert.Equal(t, "v3.0.0", versionedSource.LocalVersionString(), "local version string should not be HEAD when version set")
+
+	branchSourceURL, _ := url.Parse("git::git@github.com:terraform-aws-modules/terraform-aws-vpc.git?ref=main")
+	branchSource := GitSource{SourceURL: branchSourceURL}
+	assert.Equal(t, "main", branchSource.LocalVersionString(), "local version string should be the ref when it isn't a semantic version")
 }
 
 func TestDowngradeDetection(t *testing.T) {
@@ -83,3 +88,31 @@ func TestTagSearchingWithConstraint(t *testing.T) {
 	assert.Equal(t, semver.MustParse("v2.0.0"), versionedSource.FindLatestTagForConstraint(equalConstraint))
 	assert.Equal(t, semver.MustParse("v1.0.0"), versionedSource.FindLatestTagForConstraint(downgradeConstraint))
 }
+
+func TestLibyear(t *testing.T) {
+	released := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	source := versionedSource
+	source.LatestRemoteVersion = semver.MustParse("v5.0.0")
+	source.ReleaseDates = map[string]time.Time{
+		"v3.0.0": released(2020, time.January, 1),
+		"v5.0.0": released(2021, time.July, 2),
+	}
+
+	years, ok := source.Libyear()
+	assert.True(t, ok)
+	assert.InDelta(t, 1.5, years, 0.01, "libyear should be the time between the local and latest releases")
+
+	source.localVersion = semver.MustParse("3.0.0")
+	_, ok = source.LocalReleaseDate()
+	assert.True(t, ok, "release dates should be matched to versions by semver")
+
+	source.localVersion = semver.MustParse("v4.0.0")
+	_, ok = source.Libyear()
+	assert.False(t, ok, "libyear should be unknown without the local release date")
+
+	_, ok = unversionedSource.Libyear()
+	assert.False(t, ok, "libyear should be unknown for sources tracking HEAD")
+}
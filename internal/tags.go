@@ -0,0 +1,387 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver"
+)
+
+// TagProvider retrieves the semver tags available for a remote repository.
+type TagProvider interface {
+	Tags(ctx context.Context, remoteURL *url.URL) (semver.Collection, error)
+}
+
+// ReleaseDateProvider is implemented by tag providers which can also report when each of the given
+// tags was released, keyed by tag name, leaving out tags which don't exist. Providers which can't
+// are backed by git for release dates.
+type ReleaseDateProvider interface {
+	ReleaseDates(ctx context.Context, remoteURL *url.URL, tags []string) (map[string]time.Time, error)
+}
+
+// releaseDateProvider returns the provider used to look up the release dates of tags
+// found by the given tag provider.
+func releaseDateProvider(provider TagProvider) ReleaseDateProvider {
+	if dates, ok := provider.(ReleaseDateProvider); ok {
+		return dates
+	}
+
+	return &GitTagProvider{}
+}
+
+// FallbackTagProvider looks up tags using a host's API where it's expected to work, i.e., for
+// HTTPS remotes or where the API is authenticated, and git otherwise. Git is also used where the
+// API refuses the lookup, e.g., for a private repository without a token, which git may still
+// be able to reach over SSH.
+type FallbackTagProvider struct {
+	API           TagProvider
+	Git           TagProvider
+	Authenticated bool
+}
+
+// NewFallbackTagProvider creates a provider using the given API provider, falling back to git.
+func NewFallbackTagProvider(api TagProvider, authenticated bool) *FallbackTagProvider {
+	return &FallbackTagProvider{
+		API:           api,
+		Git:           &GitTagProvider{},
+		Authenticated: authenticated,
+	}
+}
+
+// Tags returns the semver tags of the repository at the given URL.
+func (p *FallbackTagProvider) Tags(ctx context.Context, remoteURL *url.URL) (semver.Collection, error) {
+	if p.useAPI(remoteURL) {
+		tags, err := p.API.Tags(ctx, remoteURL)
+		if !isRefused(err) {
+			return tags, err
+		}
+	}
+
+	return p.Git.Tags(ctx, remoteURL)
+}
+
+// ReleaseDates returns when each of the given tags of the repository at the given URL was released.
+func (p *FallbackTagProvider) ReleaseDates(ctx context.Context, remoteURL *url.URL, tags []string) (map[string]time.Time, error) {
+	if p.useAPI(remoteURL) {
+		dates, err := releaseDateProvider(p.API).ReleaseDates(ctx, remoteURL, tags)
+		if !isRefused(err) {
+			return dates, err
+		}
+	}
+
+	return releaseDateProvider(p.Git).ReleaseDates(ctx, remoteURL, tags)
+}
+
+func (p *FallbackTagProvider) useAPI(remoteURL *url.URL) bool {
+	return p.Authenticated || remoteURL.Scheme == "https"
+}
+
+// isRefused returns true if an API refused a request as unauthenticated, forbidden or not found.
+func isRefused(err error) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+
+	switch statusErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return true
+	}
+
+	return false
+}
+
+// TagProviderRegistry maps repository hosts to the TagProvider which should be
+// used to look up their tags, falling back to a default for unknown hosts.
+type TagProviderRegistry struct {
+	Default TagProvider
+	hosts   map[string]TagProvider
+}
+
+// TagProviders is the global registry used by GitSource when resolving remote tags.
+var TagProviders *TagProviderRegistry
+
+func init() {
+	TagProviders = NewTagProviderRegistry(&GitTagProvider{})
+}
+
+// NewTagProviderRegistry creates an empty registry which uses the given provider for
+// every host until host specific providers are registered.
+func NewTagProviderRegistry(defaultProvider TagProvider) *TagProviderRegistry {
+	return &TagProviderRegistry{
+		Default: defaultProvider,
+		hosts:   make(map[string]TagProvider),
+	}
+}
+
+// Register sets the provider to use for repositories on the given host.
+func (r *TagProviderRegistry) Register(host string, provider TagProvider) {
+	r.hosts[strings.ToLower(host)] = provider
+}
+
+// ForURL returns the provider registered for the host of the given URL, or the
+// default provider if none has been registered.
+func (r *TagProviderRegistry) ForURL(remoteURL *url.URL) TagProvider {
+	if provider, ok := r.hosts[strings.ToLower(remoteURL.Hostname())]; ok {
+		return provider
+	}
+
+	return r.Default
+}
+
+// NewTagProvider creates a TagProvider by name, one of git, github, gitlab or fixture.
+// The fixture provider requires the path to a JSON fixture file.
+func NewTagProvider(name string, fixturePath string) (TagProvider, error) {
+	switch name {
+	case "git":
+		return &GitTagProvider{}, nil
+	case "github":
+		return NewGitHubTagProvider(), nil
+	case "gitlab":
+		return NewGitLabTagProvider(), nil
+	case "fixture":
+		if fixturePath == "" {
+			return nil, fmt.Errorf("the fixture tag provider requires a fixture file")
+		}
+
+		return NewFixtureTagProvider(fixturePath)
+	}
+
+	return nil, fmt.Errorf("unknown tag provider %s", name)
+}
+
+// tagEntry is a single tag as listed by a tags API or within a fixture file, fixtures may
+// also give the date the tag was released.
+type tagEntry struct {
+	Name string     `json:"name"`
+	Date *time.Time `json:"date,omitempty"`
+}
+
+// FixtureTagProvider serves tags from a JSON fixture file, keyed by remote URL, so
+// that lookups can be performed without any network access.
+type FixtureTagProvider struct {
+	repositories map[string][]tagEntry
+}
+
+// NewFixtureTagProvider reads the fixture file at the given path, which should contain
+// an object mapping remote repository URLs to a list of tags.
+func NewFixtureTagProvider(path string) (*FixtureTagProvider, error) {
+	raw, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := &FixtureTagProvider{}
+	if err := json.Unmarshal(raw, &provider.repositories); err != nil {
+		return nil, fmt.Errorf("invalid tag fixture file %s (%s)", path, err.Error())
+	}
+
+	return provider, nil
+}
+
+// Tags returns the fixture tags for the given remote URL.
+func (p *FixtureTagProvider) Tags(ctx context.Context, remoteURL *url.URL) (semver.Collection, error) {
+	tags, ok := p.repositories[remoteURL.String()]
+	if !ok {
+		return nil, Permanent(fmt.Errorf("no fixture tags for repository %s", remoteURL))
+	}
+
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+
+	return parseSemverTags(names)
+}
+
+// ReleaseDates returns the fixture release dates of the given tags of the given remote URL, tags
+// without a date in the fixture are left out.
+func (p *FixtureTagProvider) ReleaseDates(ctx context.Context, remoteURL *url.URL, names []string) (map[string]time.Time, error) {
+	tags, ok := p.repositories[remoteURL.String()]
+	if !ok {
+		return nil, Permanent(fmt.Errorf("no fixture tags for repository %s", remoteURL))
+	}
+
+	dates := make(map[string]time.Time)
+	for _, tag := range tags {
+		if tag.Date != nil && containsString(names, tag.Name) {
+			dates[tag.Name] = *tag.Date
+		}
+	}
+
+	return dates, nil
+}
+
+// parseSemverTags converts a list of tag names to a collection of versions, returning
+// an error if any of the tags are not valid semver.
+func parseSemverTags(names []string) (semver.Collection, error) {
+	var tags semver.Collection
+	for _, name := range names {
+		version, err := semver.NewVersion(name)
+		if err != nil {
+			return nil, Permanent(err)
+		}
+
+		tags = append(tags, version)
+	}
+
+	return tags, nil
+}
+
+// repositoryPath returns the path of a remote repository URL without any leading slash
+// or trailing .git, e.g., org/repo.
+func repositoryPath(remoteURL *url.URL) string {
+	return strings.TrimSuffix(strings.Trim(remoteURL.Path, "/"), ".git")
+}
+
+// fetchTagNames requests the given tags API endpoint, following any pagination links,
+// and returns the names of every tag listed.
+func fetchTagNames(ctx context.Context, client *http.Client, endpoint string, header http.Header) ([]string, error) {
+	var names []string
+
+	for endpoint != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header = header.Clone()
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var page []tagEntry
+		err = decodeJSONResponse(resp, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tag := range page {
+			names = append(names, tag.Name)
+		}
+
+		endpoint = nextPageURL(resp.Header.Get("Link"))
+	}
+
+	return names, nil
+}
+
+// fetchJSON requests the given API endpoint, decoding the response into v, and returns false
+// where the endpoint doesn't exist, e.g., for a tag which doesn't exist.
+func fetchJSON(ctx context.Context, client *http.Client, endpoint string, header http.Header, v interface{}) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header = header.Clone()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return false, nil
+	}
+
+	return true, decodeJSONResponse(resp, v)
+}
+
+// decodeJSONResponse decodes a successful API response into v. Rate limited responses
+// return a RateLimitError, server errors are returned as is so they may be retried, and
+// any other failure is permanent.
+func decodeJSONResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+
+	if err := rateLimitError(resp); err != nil {
+		return err
+	}
+
+	statusErr := &StatusError{URL: resp.Request.URL.Redacted(), StatusCode: resp.StatusCode, Status: resp.Status}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return statusErr
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return Permanent(statusErr)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return Permanent(err)
+	}
+
+	return nil
+}
+
+// StatusError is returned by API based providers for an unsuccessful response which isn't rate
+// limited.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected response from %s (%s)", e.URL, e.Status)
+}
+
+// rateLimitError detects both primary (exhausted quota) and secondary (abuse detection)
+// rate limits, as signalled by GitHub and GitLab, returning nil if the response is not
+// rate limited.
+func rateLimitError(resp *http.Response) error {
+	exhausted := resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("RateLimit-Remaining") == "0"
+	retryAfter := resp.Header.Get("Retry-After")
+
+	if resp.StatusCode != http.StatusTooManyRequests && !(resp.StatusCode == http.StatusForbidden && (exhausted || retryAfter != "")) {
+		return nil
+	}
+
+	err := &RateLimitError{URL: resp.Request.URL.Redacted()}
+	if seconds, parseErr := strconv.Atoi(retryAfter); parseErr == nil {
+		err.RetryAfter = time.Duration(seconds) * time.Second
+	} else if reset := resetTime(resp.Header); !reset.IsZero() {
+		err.RetryAfter = time.Until(reset)
+	}
+
+	return err
+}
+
+func resetTime(header http.Header) time.Time {
+	for _, name := range []string{"X-RateLimit-Reset", "RateLimit-Reset"} {
+		if epoch, err := strconv.ParseInt(header.Get(name), 10, 64); err == nil {
+			return time.Unix(epoch, 0)
+		}
+	}
+
+	return time.Time{}
+}
+
+// nextPageURL extracts the rel="next" URL from a Link header, as used for pagination
+// by both the GitHub and GitLab APIs.
+func nextPageURL(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		segments := strings.Split(part, ";")
+		if len(segments) < 2 {
+			continue
+		}
+
+		for _, param := range segments[1:] {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.Trim(strings.TrimSpace(segments[0]), "<>")
+			}
+		}
+	}
+
+	return ""
+}
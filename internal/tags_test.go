@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagProviderRegistrySelectsByHost(t *testing.T) {
+	fallback := &GitTagProvider{}
+	github := NewGitHubTagProvider()
+	registry := NewTagProviderRegistry(fallback)
+	registry.Register("github.com", github)
+
+	githubURL, _ := url.Parse("ssh://git@github.com/org/repo.git")
+	otherURL, _ := url.Parse("https://git.example.com/org/repo.git")
+
+	assert.Equal(t, github, registry.ForURL(githubURL), "registered host should use its provider")
+	assert.Equal(t, fallback, registry.ForURL(otherURL), "unknown host should use the default provider")
+}
+
+func TestGitHubTagProviderFollowsPagination(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/repos/org/repo/tags", r.URL.Path)
+		assert.Equal(t, "token secret", r.Header.Get("Authorization"))
+
+		if r.URL.Query().Get("page") == "" {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/repos/org/repo/tags?per_page=100&page=2>; rel="next"`, server.URL))
+			fmt.Fprint(w, `[{"name": "v1.0.0"}]`)
+			return
+		}
+
+		fmt.Fprint(w, `[{"name": "v2.0.0"}]`)
+	}))
+	defer server.Close()
+
+	provider := &GitHubTagProvider{BaseURL: server.URL, Token: "secret", Client: server.Client()}
+	remoteURL, _ := url.Parse("https://github.com/org/repo.git")
+
+	tags, err := provider.Tags(context.Background(), remoteURL)
+	require.NoError(t, err)
+	assert.Equal(t, semver.Collection{semver.MustParse("v1.0.0"), semver.MustParse("v2.0.0")}, tags)
+}
+
+func TestGitLabTagProviderEscapesProjectPath(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v4/projects/group%2Fsub%2Fproject/repository/tags", r.URL.EscapedPath())
+		fmt.Fprint(w, `[{"name": "v0.1.0"}]`)
+	}))
+	defer server.Close()
+
+	provider := &GitLabTagProvider{BaseURL: server.URL, Client: server.Client()}
+	remoteURL, _ := url.Parse("ssh://git@gitlab.com/group/sub/project.git")
+
+	tags, err := provider.Tags(context.Background(), remoteURL)
+	require.NoError(t, err)
+	assert.Equal(t, semver.Collection{semver.MustParse("v0.1.0")}, tags)
+}
+
+func TestFixtureTagProviderUnknownRepository(t *testing.T) {
+	provider, err := NewFixtureTagProvider("testdata/tags.json")
+	require.NoError(t, err)
+
+	remoteURL, _ := url.Parse("https://github.com/org/unknown.git")
+	_, err = provider.Tags(context.Background(), remoteURL)
+	assert.Error(t, err, "repositories missing from the fixture should return an error")
+}
+
+func TestGitHubTagProviderReleaseDates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/org/repo/git/ref/tags/v1.0.0":
+			fmt.Fprint(w, `{"object": {"type": "commit", "sha": "c1"}}`)
+		case "/repos/org/repo/git/ref/tags/v1.1.0":
+			fmt.Fprint(w, `{"object": {"type": "tag", "sha": "t1"}}`)
+		case "/repos/org/repo/git/commits/c1":
+			fmt.Fprint(w, `{"committer": {"date": "2021-01-02T10:00:00Z"}}`)
+		case "/repos/org/repo/git/tags/t1":
+			fmt.Fprint(w, `{"tagger": {"date": "2021-06-07T10:00:00Z"}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	provider := &GitHubTagProvider{BaseURL: server.URL, Client: server.Client()}
+	remoteURL, _ := url.Parse("https://github.com/org/repo.git")
+
+	dates, err := provider.ReleaseDates(context.Background(), remoteURL, []string{"v1.0.0", "v1.1.0", "v2.0.0"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]time.Time{
+		"v1.0.0": time.Date(2021, 1, 2, 10, 0, 0, 0, time.UTC),
+		"v1.1.0": time.Date(2021, 6, 7, 10, 0, 0, 0, time.UTC),
+	}, dates, "lightweight tags should be dated by their commit, annotated tags by their tagger")
+}
+
+func TestGitLabTagProviderReleaseDates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/group%2Fproject/repository/tags/v0.1.0":
+			fmt.Fprint(w, `{"name": "v0.1.0", "created_at": null, "commit": {"committed_date": "2021-01-02T10:00:00Z"}}`)
+		case "/api/v4/projects/group%2Fproject/repository/tags/v0.2.0":
+			fmt.Fprint(w, `{"name": "v0.2.0", "created_at": "2021-06-07T10:00:00Z", "commit": {"committed_date": "2021-06-01T10:00:00Z"}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	provider := &GitLabTagProvider{BaseURL: server.URL, Client: server.Client()}
+	remoteURL, _ := url.Parse("ssh://git@gitlab.com/group/project.git")
+
+	dates, err := provider.ReleaseDates(context.Background(), remoteURL, []string{"v0.1.0", "v0.2.0", "v0.3.0"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]time.Time{
+		"v0.1.0": time.Date(2021, 1, 2, 10, 0, 0, 0, time.UTC),
+		"v0.2.0": time.Date(2021, 6, 7, 10, 0, 0, 0, time.UTC),
+	}, dates, "lightweight tags should be dated by their commit, annotated tags by their creation")
+}
+
+func TestFallbackTagProvider(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/repos/org/public/tags":
+			fmt.Fprint(w, `[{"name": "v2.0.0"}]`)
+		case "/repos/org/broken/tags":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	api := &GitHubTagProvider{BaseURL: server.URL, Client: server.Client()}
+	provider := &FallbackTagProvider{API: api, Git: &flakyTagProvider{}}
+	apiTags := semver.Collection{semver.MustParse("v2.0.0")}
+	gitTags := semver.Collection{semver.MustParse("v1.0.0")}
+
+	public, _ := url.Parse("https://github.com/org/public.git")
+	tags, err := provider.Tags(context.Background(), public)
+	require.NoError(t, err)
+	assert.Equal(t, apiTags, tags, "https remotes should use the API")
+
+	private, _ := url.Parse("https://github.com/org/private.git")
+	tags, err = provider.Tags(context.Background(), private)
+	require.NoError(t, err)
+	assert.Equal(t, gitTags, tags, "lookups refused by the API should fall back to git")
+
+	broken, _ := url.Parse("https://github.com/org/broken.git")
+	_, err = provider.Tags(context.Background(), broken)
+	assert.Error(t, err, "API failures other than refusals should be returned, so they may be retried")
+
+	requests = 0
+	ssh, _ := url.Parse("ssh://git@github.com/org/public.git")
+	tags, err = provider.Tags(context.Background(), ssh)
+	require.NoError(t, err)
+	assert.Equal(t, gitTags, tags)
+	assert.Zero(t, requests, "ssh remotes should use git without a token")
+
+	provider.Authenticated = true
+	tags, err = provider.Tags(context.Background(), ssh)
+	require.NoError(t, err)
+	assert.Equal(t, apiTags, tags, "any remote should use the API with a token")
+}
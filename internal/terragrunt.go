@@ -0,0 +1,481 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+// maxConfigDepth limits how deeply included and read configurations, and locals referring
+// to other locals, are followed.
+const maxConfigDepth = 8
+
+// hclEvaluator evaluates expressions within a native syntax file well enough to resolve sources
+// built from terragrunt locals and interpolation. Locals are read from the file itself, from any
+// exposed included files (as include.<name>.locals) and from read_terragrunt_config.
+type hclEvaluator struct {
+	filePath string
+	src      []byte
+	depth    int
+	locals   map[string]*hclsyntax.Attribute
+	includes map[string]*hclEvaluator
+	configs  map[string]*hclEvaluator
+	ctx      *hcl.EvalContext
+}
+
+// sourceSegment is part of a source built from interpolation. Literal segments were written
+// directly in filePath, whose content is src, at rng, and can be edited in place. Where the
+// literal contains escape sequences, offsets maps each byte of the value to the literal. Other
+// segments were evaluated from elsewhere, as described by origin.
+type sourceSegment struct {
+	value    string
+	literal  bool
+	filePath string
+	src      []byte
+	rng      hcl.Range
+	offsets  []int
+	origin   string
+}
+
+func newHclEvaluator(filePath string, src []byte, body *hclsyntax.Body, depth int) *hclEvaluator {
+	e := &hclEvaluator{
+		filePath: filePath,
+		src:      src,
+		depth:    depth,
+		locals:   make(map[string]*hclsyntax.Attribute),
+		includes: make(map[string]*hclEvaluator),
+		configs:  make(map[string]*hclEvaluator),
+		ctx: &hcl.EvalContext{
+			Variables: make(map[string]cty.Value),
+			Functions: terragruntFunctions(filePath, depth),
+		},
+	}
+
+	for _, block := range body.Blocks {
+		if block.Type == "locals" {
+			for name, attr := range block.Body.Attributes {
+				e.locals[name] = attr
+			}
+		}
+	}
+
+	// Locals may refer to included configuration, but not the other way around.
+	e.ctx.Variables["include"] = e.evaluateIncludes(body, depth)
+	e.ctx.Variables["local"] = e.evaluateLocals()
+
+	return e
+}
+
+// evaluateIncludes reads the locals of every included file which sets expose = true, as terragrunt
+// only allows exposed includes to be referred to. Labelled includes are available as
+// include.<label>.locals and an unlabelled include as include.locals.
+func (e *hclEvaluator) evaluateIncludes(body *hclsyntax.Body, depth int) cty.Value {
+	includes := make(map[string]cty.Value)
+
+	for _, block := range body.Blocks {
+		attr, ok := block.Body.Attributes["path"]
+		if block.Type != "include" || !ok || !e.isExposed(block) || depth >= maxConfigDepth {
+			continue
+		}
+
+		path, err := e.stringValue(attr.Expr)
+		if err != nil {
+			continue
+		}
+
+		included, config, err := loadTerragruntConfig(e.resolvePath(path), depth+1)
+		if err != nil {
+			continue
+		}
+
+		label := ""
+		if len(block.Labels) > 0 {
+			label = block.Labels[0]
+		}
+		e.includes[label] = included
+
+		if len(block.Labels) == 0 {
+			for name, value := range config.AsValueMap() {
+				includes[name] = value
+			}
+		} else {
+			includes[block.Labels[0]] = config
+		}
+	}
+
+	return cty.ObjectVal(includes)
+}
+
+// isExposed returns true if the include block sets expose to true.
+func (e *hclEvaluator) isExposed(block *hclsyntax.Block) bool {
+	attr, ok := block.Body.Attributes["expose"]
+	if !ok {
+		return false
+	}
+
+	value, diags := attr.Expr.Value(e.ctx)
+	if diags.HasErrors() {
+		return false
+	}
+
+	value, err := convert.Convert(value, cty.Bool)
+	return err == nil && value.IsKnown() && !value.IsNull() && value.True()
+}
+
+// evaluateLocals evaluates every local which can be, repeating until no more can be resolved
+// as locals may refer to each other in any order.
+func (e *hclEvaluator) evaluateLocals() cty.Value {
+	values := make(map[string]cty.Value)
+
+	for progress := true; progress; {
+		progress = false
+		for name, attr := range e.locals {
+			if _, ok := values[name]; ok {
+				continue
+			}
+
+			e.ctx.Variables["local"] = cty.ObjectVal(values)
+			value, diags := attr.Expr.Value(e.ctx)
+			if diags.HasErrors() || !value.IsWhollyKnown() {
+				continue
+			}
+
+			values[name] = value
+			progress = true
+		}
+	}
+
+	return cty.ObjectVal(values)
+}
+
+// sourceAttribute resolves a source built from interpolation, locating the literal which holds its
+// ref, whether in this file, an included file or one read with read_terragrunt_config. Sources
+// whose ref can't be edited in place are still returned, with the reason recorded as the updateError.
+func (e *hclEvaluator) sourceAttribute(labels []string, expr hclsyntax.Expression) (sourceAttribute, error) {
+	segments, err := e.segments(expr, 0)
+	if err != nil {
+		return sourceAttribute{}, err
+	}
+
+	var value strings.Builder
+	for _, segment := range segments {
+		value.WriteString(segment.value)
+	}
+
+	source := sourceAttribute{
+		labels: labels,
+		value:  value.String(),
+	}
+
+	refStart, refEnd, ok := refValueSpan(source.value)
+	if !ok {
+		source.updateError = errors.New("sources built from interpolation must already set a ref to be updated")
+		return source, nil
+	}
+
+	offset := 0
+	for _, segment := range segments {
+		end := offset + len(segment.value)
+		if offset <= refStart && refEnd <= end {
+			if !segment.literal {
+				source.updateError = fmt.Errorf("ref is set by %s, which can't be updated in place", segment.origin)
+				return source, nil
+			}
+
+			source.literal = segment.value
+			source.literalRange = segment.rng
+			source.refSpan = []int{refStart - offset, refEnd - offset}
+			if segment.offsets != nil {
+				source.literal = string(segment.rng.SliceBytes(segment.src))
+				source.refSpan = []int{segment.offsets[refStart-offset], segment.offsets[refEnd-offset]}
+			}
+
+			if segment.filePath != e.filePath {
+				source.literalFile = segment.filePath
+				source.literalSrc = segment.src
+			}
+			return source, nil
+		}
+
+		offset = end
+	}
+
+	source.updateError = errors.New("ref is built from more than one expression")
+	return source, nil
+}
+
+// segments breaks an expression down into the literals and evaluated values it is built from,
+// following references to locals, including those of other files, so their literals can be edited.
+func (e *hclEvaluator) segments(expr hclsyntax.Expression, depth int) ([]sourceSegment, error) {
+	switch expr := expr.(type) {
+	case *hclsyntax.TemplateExpr:
+		var segments []sourceSegment
+		for _, part := range expr.Parts {
+			if literal, ok := part.(*hclsyntax.LiteralValueExpr); ok {
+				value, err := e.stringValue(literal)
+				if err != nil {
+					return nil, err
+				}
+
+				segment := sourceSegment{
+					value:    value,
+					literal:  true,
+					filePath: e.filePath,
+					src:      e.src,
+					rng:      literal.SrcRange,
+				}
+
+				if raw := string(literal.SrcRange.SliceBytes(e.src)); raw != value {
+					segment.offsets, segment.literal = literalOffsets(raw, value, unescapeHCL)
+					segment.origin = "an escaped literal"
+				}
+
+				segments = append(segments, segment)
+				continue
+			}
+
+			partSegments, err := e.segments(part, depth)
+			if err != nil {
+				return nil, err
+			}
+
+			segments = append(segments, partSegments...)
+		}
+
+		return segments, nil
+	case *hclsyntax.TemplateWrapExpr:
+		return e.segments(expr.Wrapped, depth)
+	case *hclsyntax.ScopeTraversalExpr:
+		if owner, attr := e.localAttribute(expr.Traversal); attr != nil && depth < maxConfigDepth {
+			return owner.segments(attr.Expr, depth+1)
+		}
+	}
+
+	value, err := e.stringValue(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return []sourceSegment{{value: value, origin: string(expr.Range().SliceBytes(e.src))}}, nil
+}
+
+func (e *hclEvaluator) stringValue(expr hcl.Expression) (string, error) {
+	value, diags := expr.Value(e.ctx)
+	if diags.HasErrors() {
+		return "", diags
+	}
+
+	value, err := convert.Convert(value, cty.String)
+	if err != nil {
+		return "", err
+	}
+
+	if value.IsNull() || !value.IsKnown() {
+		return "", fmt.Errorf("expression at %s has no known value", expr.Range())
+	}
+
+	return value.AsString(), nil
+}
+
+func (e *hclEvaluator) resolvePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(filepath.Dir(e.filePath), path)
+}
+
+// localAttribute returns the local a traversal refers to, along with the evaluator of the file
+// it's defined in. This is either local.<name>, include.<label>.locals.<name> (or include.locals.<name>
+// for an unlabelled include), or local.<config>.locals.<name> where the config local is read with
+// read_terragrunt_config. It returns a nil attribute for any other traversal.
+func (e *hclEvaluator) localAttribute(traversal hcl.Traversal) (*hclEvaluator, *hclsyntax.Attribute) {
+	names := traversalNames(traversal)
+
+	var owner *hclEvaluator
+	var name string
+	switch {
+	case len(names) == 2 && names[0] == "local":
+		owner, name = e, names[1]
+	case len(names) == 3 && names[0] == "include" && names[1] == "locals":
+		owner, name = e.includes[""], names[2]
+	case len(names) == 4 && names[0] == "include" && names[2] == "locals":
+		owner, name = e.includes[names[1]], names[3]
+	case len(names) == 4 && names[0] == "local" && names[2] == "locals":
+		owner, name = e.readConfig(names[1]), names[3]
+	}
+
+	if owner == nil {
+		return nil, nil
+	}
+
+	return owner, owner.locals[name]
+}
+
+// readConfig returns the evaluator of the configuration read by the given local, where it's set
+// by calling read_terragrunt_config, or nil otherwise.
+func (e *hclEvaluator) readConfig(local string) *hclEvaluator {
+	attr, ok := e.locals[local]
+	if !ok || e.depth >= maxConfigDepth {
+		return nil
+	}
+
+	call, ok := attr.Expr.(*hclsyntax.FunctionCallExpr)
+	if !ok || call.Name != "read_terragrunt_config" || len(call.Args) == 0 {
+		return nil
+	}
+
+	path, err := e.stringValue(call.Args[0])
+	if err != nil {
+		return nil
+	}
+
+	path = e.resolvePath(path)
+	if config, ok := e.configs[path]; ok {
+		return config
+	}
+
+	config, _, err := loadTerragruntConfig(path, e.depth+1)
+	if err != nil {
+		config = nil
+	}
+	e.configs[path] = config
+
+	return config
+}
+
+// traversalNames returns the names of each step of a traversal made up of only attribute
+// accesses, e.g., local.common.locals.version, or nil for any other traversal.
+func traversalNames(traversal hcl.Traversal) []string {
+	names := []string{traversal.RootName()}
+	for _, step := range traversal[1:] {
+		attr, ok := step.(hcl.TraverseAttr)
+		if !ok {
+			return nil
+		}
+
+		names = append(names, attr.Name)
+	}
+
+	return names
+}
+
+// readTerragruntConfig reads the configuration at the given path in the same form as
+// read_terragrunt_config, limited to its locals and inputs.
+func readTerragruntConfig(path string, depth int) (cty.Value, error) {
+	_, config, err := loadTerragruntConfig(path, depth)
+	return config, err
+}
+
+// loadTerragruntConfig reads the configuration at the given path, returning both its evaluator,
+// so that the literals of its locals can be found, and its value as read_terragrunt_config.
+func loadTerragruntConfig(path string, depth int) (*hclEvaluator, cty.Value, error) {
+	raw, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, cty.NilVal, err
+	}
+
+	file, diags := hclsyntax.ParseConfig(raw, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, cty.NilVal, diags
+	}
+
+	body := file.Body.(*hclsyntax.Body)
+	e := newHclEvaluator(path, raw, body, depth)
+
+	config := map[string]cty.Value{
+		"locals": e.ctx.Variables["local"],
+	}
+
+	if attr, ok := body.Attributes["inputs"]; ok {
+		if inputs, diags := attr.Expr.Value(e.ctx); !diags.HasErrors() {
+			config["inputs"] = inputs
+		}
+	}
+
+	return e, cty.ObjectVal(config), nil
+}
+
+// terragruntFunctions returns the terragrunt functions needed to resolve locals, along with
+// common string functions, relative to the file at the given path.
+func terragruntFunctions(filePath string, depth int) map[string]function.Function {
+	dir := filepath.Dir(filePath)
+
+	return map[string]function.Function{
+		"get_terragrunt_dir": function.New(&function.Spec{
+			Type: function.StaticReturnType(cty.String),
+			Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+				return cty.StringVal(dir), nil
+			},
+		}),
+		"find_in_parent_folders": function.New(&function.Spec{
+			VarParam: &function.Parameter{Name: "args", Type: cty.String},
+			Type:     function.StaticReturnType(cty.String),
+			Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+				name := "terragrunt.hcl"
+				if len(args) > 0 {
+					name = args[0].AsString()
+				}
+
+				for current := filepath.Dir(dir); ; current = filepath.Dir(current) {
+					candidate := filepath.Join(current, name)
+					if _, err := os.Stat(candidate); err == nil {
+						return cty.StringVal(candidate), nil
+					}
+
+					if filepath.Dir(current) == current {
+						break
+					}
+				}
+
+				if len(args) > 1 {
+					return args[1], nil
+				}
+
+				return cty.NilVal, fmt.Errorf("could not find %s in any parent folder of %s", name, dir)
+			},
+		}),
+		"read_terragrunt_config": function.New(&function.Spec{
+			Params:   []function.Parameter{{Name: "path", Type: cty.String}},
+			VarParam: &function.Parameter{Name: "default", Type: cty.DynamicPseudoType},
+			Type:     function.StaticReturnType(cty.DynamicPseudoType),
+			Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+				path := args[0].AsString()
+				if !filepath.IsAbs(path) {
+					path = filepath.Join(dir, path)
+				}
+
+				if depth >= maxConfigDepth {
+					return cty.NilVal, fmt.Errorf("configuration read from %s is nested too deeply", path)
+				}
+
+				config, err := readTerragruntConfig(path, depth+1)
+				if err != nil && len(args) > 1 {
+					return args[1], nil
+				}
+
+				return config, err
+			},
+		}),
+		"format":     stdlib.FormatFunc,
+		"join":       stdlib.JoinFunc,
+		"lower":      stdlib.LowerFunc,
+		"upper":      stdlib.UpperFunc,
+		"replace":    stdlib.ReplaceFunc,
+		"trimspace":  stdlib.TrimSpaceFunc,
+		"trimprefix": stdlib.TrimPrefixFunc,
+		"trimsuffix": stdlib.TrimSuffixFunc,
+		"merge":      stdlib.MergeFunc,
+		"lookup":     stdlib.LookupFunc,
+	}
+}
@@ -0,0 +1,194 @@
+package internal
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// terragruntSource reads the single source from a terragrunt file within testdata/terragrunt.
+func terragruntSource(t *testing.T, dir string) (*HclParser, GitSource) {
+	path, err := filepath.Abs(filepath.Join("testdata", "terragrunt", "live", dir, "terragrunt.hcl"))
+	require.NoError(t, err)
+
+	parser, errs := NewHclParser(path)
+	require.Nil(t, errs)
+
+	sources, err := parser.FindGitSources(context.Background(), false)
+	require.NoError(t, err)
+	require.Contains(t, sources, path)
+
+	return parser, sources[path]
+}
+
+func TestTerragruntLocalsAreResolved(t *testing.T) {
+	_, app := terragruntSource(t, "app")
+	assert.Equal(t, "git::https://example.com/org/modules.git//app?ref=v1.0.0", app.SourceURL.String())
+	assert.Equal(t, "https://example.com/org/modules.git", app.RemoteURL.String())
+	assert.Equal(t, "v1.0.0", app.LocalVersionString())
+	assert.NoError(t, app.UpdateError)
+
+	_, web := terragruntSource(t, "web")
+	assert.Equal(t, "https://example.com/example/web.git", web.RemoteURL.String(), "included locals should be resolved")
+	assert.Equal(t, "v0.3.0", web.LocalVersionString())
+}
+
+func TestTerragruntRefLiteralIsUpdated(t *testing.T) {
+	parser, app := terragruntSource(t, "app")
+	app.SetSourceVersion(semver.MustParse("v2.0.0"))
+	parser.UpdateBlockSource(&app)
+
+	original := string(parser.Original())
+	expected := strings.Replace(original, `version         = "v1.0.0"`, `version         = "v2.0.0"`, 1)
+	assert.Equal(t, expected, string(parser.Bytes()), "only the local holding the ref should change")
+	assert.Equal(t, "git::https://example.com/org/modules.git//app?ref=v2.0.0", app.SourceURL.String())
+
+	parser, web := terragruntSource(t, "web")
+	web.SetSourceVersion(semver.MustParse("v0.4.0"))
+	parser.UpdateBlockSource(&web)
+	assert.Contains(t, string(parser.Bytes()), `/web.git?ref=v0.4.0"`, "refs within interpolated locals should be updated")
+}
+
+func TestTerragruntRefInReadConfigIsUpdated(t *testing.T) {
+	parser, db := terragruntSource(t, "db")
+	assert.Equal(t, "v1.2.0", db.LocalVersionString())
+	require.NoError(t, db.UpdateError, "refs set in other files should be updatable")
+
+	db.SetSourceVersion(semver.MustParse("v1.3.0"))
+	parser.UpdateBlockSource(&db)
+	assert.Equal(t, string(parser.Original()), string(parser.Bytes()), "the file reading the config should be unchanged")
+
+	common, err := filepath.Abs(filepath.Join("testdata", "terragrunt", "common.hcl"))
+	require.NoError(t, err)
+
+	included := parser.IncludedBytes()
+	require.Contains(t, included, common)
+	original := string(parser.IncludedFiles()[common])
+	expected := strings.Replace(original, `version         = "v1.2.0"`, `version         = "v1.3.0"`, 1)
+	assert.Equal(t, expected, string(included[common]), "only the local holding the ref should change")
+}
+
+func TestTerragruntIncludedRefIsSaved(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root.hcl")
+	child := filepath.Join(dir, "live", "terragrunt.hcl")
+	require.NoError(t, os.MkdirAll(filepath.Dir(child), 0700))
+	require.NoError(t, ioutil.WriteFile(root, []byte("locals {\n  version = \"v1.0.0\"\n}\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(child, []byte(`include "root" {
+  path   = find_in_parent_folders("root.hcl")
+  expose = true
+}
+
+terraform {
+  source = "git::https://example.com/org/modules.git//app?ref=${include.root.locals.version}"
+}
+`), 0600))
+
+	parser, errs := NewHclParser(child)
+	require.Nil(t, errs)
+
+	sources, err := parser.FindGitSources(context.Background(), false)
+	require.NoError(t, err)
+	require.Contains(t, sources, child)
+
+	source := sources[child]
+	require.NoError(t, source.UpdateError)
+	source.SetSourceVersion(semver.MustParse("v1.1.0"))
+	parser.UpdateBlockSource(&source)
+	require.NoError(t, parser.Save(context.Background()))
+
+	saved, err := ioutil.ReadFile(root)
+	require.NoError(t, err)
+	assert.Equal(t, "locals {\n  version = \"v1.1.0\"\n}\n", string(saved), "the included file holding the ref should be saved")
+
+	require.NoError(t, parser.Revert())
+	reverted, err := ioutil.ReadFile(root)
+	require.NoError(t, err)
+	assert.Equal(t, "locals {\n  version = \"v1.0.0\"\n}\n", string(reverted), "reverting should restore the included file")
+}
+
+func TestTerragruntIncludeLocalsRequireExpose(t *testing.T) {
+	dir := t.TempDir()
+	child := filepath.Join(dir, "live", "terragrunt.hcl")
+	require.NoError(t, os.MkdirAll(filepath.Dir(child), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "root.hcl"), []byte("locals {\n  version = \"v1.0.0\"\n}\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(child, []byte(`include "root" {
+  path = find_in_parent_folders("root.hcl")
+}
+
+terraform {
+  source = "git::https://example.com/org/modules.git//app?ref=${include.root.locals.version}"
+}
+`), 0600))
+
+	parser, errs := NewHclParser(child)
+	require.Nil(t, errs)
+
+	sources, err := parser.FindGitSources(context.Background(), false)
+	require.NoError(t, err)
+	require.Contains(t, sources, child)
+
+	source := sources[child]
+	assert.False(t, source.IsEvaluated(), "locals of includes which aren't exposed can't be referred to")
+	require.Error(t, source.UpdateError)
+	assert.Contains(t, source.UpdateError.Error(), "include.root.locals.version")
+}
+
+func TestTerragruntUnevaluatedSourceIsReported(t *testing.T) {
+	path := writeTestFile(t, "terragrunt.hcl", `terraform {
+  source = "git::https://example.com/org/modules.git?ref=${local.missing}"
+}
+`)
+
+	parser, errs := NewHclParser(path)
+	require.Nil(t, errs)
+
+	sources, err := parser.FindGitSources(context.Background(), true)
+	require.NoError(t, err)
+	require.Contains(t, sources, path, "sources which can't be evaluated should be reported, not skipped")
+
+	source := sources[path]
+	assert.False(t, source.IsEvaluated())
+	assert.Equal(t, 2, source.Line)
+	assert.Equal(t, "unknown", source.LocalVersionString())
+	require.Error(t, source.UpdateError)
+	assert.Contains(t, source.UpdateError.Error(), `source "git::https://example.com/org/modules.git?ref=${local.missing}" could not be evaluated`)
+	assert.Contains(t, source.UpdateError.Error(), "missing")
+
+	change := Policy{}.Plan(context.Background(), path, &source, latest)
+	assert.False(t, change.IsUpdate())
+	assert.Equal(t, source.UpdateError, change.RemoteError, "the source should be reported as unresolved")
+}
+
+func TestTerragruntEscapedRefLiteralIsUpdated(t *testing.T) {
+	path := writeTestFile(t, "terragrunt.hcl", `locals {
+  org = "org"
+}
+
+terraform {
+  source = "git::https://example.com/${local.org}/modules.git?depth=1\u0026ref=v1.0.0"
+}
+`)
+
+	parser, errs := NewHclParser(path)
+	require.Nil(t, errs)
+
+	sources, err := parser.FindGitSources(context.Background(), false)
+	require.NoError(t, err)
+	require.Contains(t, sources, path)
+
+	source := sources[path]
+	require.NoError(t, source.UpdateError)
+	source.SetSourceVersion(semver.MustParse("v2.0.0"))
+	parser.UpdateBlockSource(&source)
+
+	expected := strings.Replace(string(parser.Original()), "ref=v1.0.0", "ref=v2.0.0", 1)
+	assert.Equal(t, expected, string(parser.Bytes()), "escape sequences around the ref should be kept as written")
+}
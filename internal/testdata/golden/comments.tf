@@ -0,0 +1,10 @@
+# The VPC used by every environment
+module "vpc" {
+  source    =   "git::https://github.com/terraform-aws-modules/terraform-aws-vpc.git?ref=v2.0.0" # pinned
+  cidr      = "10.0.0.0/16"
+
+  /* the tags applied to every resource */
+  tags = {
+    Owner = "platform"
+  }
+}
@@ -0,0 +1,15 @@
+module "ordered" {
+  source = "git::https://example.com/org/modules.git//network?depth=1&ref=v1.0.0&sshkey=a%2Bb"
+}
+
+module "escaped" {
+  source = "git::https://example.com/org/modules.git?archive=tar%2Egz&ref=v1.0.0"
+}
+
+module "unicode" {
+  source = "git::https://example.com/org/modules.git?depth=1\u0026ref=v1.0.0"
+}
+
+module "unversioned" {
+  source = "git::https://example.com/org/modules.git//dns"
+}
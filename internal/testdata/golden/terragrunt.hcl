@@ -0,0 +1,11 @@
+include {
+  path = find_in_parent_folders()
+}
+
+terraform {
+	source = "git::ssh://git@github.com/org/modules.git//app?ref=v0.1.0"
+}
+
+inputs = {
+  name = "app"
+}
@@ -0,0 +1,5 @@
+locals {
+  base_source_url = "git::https://example.com/${local.org}/modules.git"
+  org             = "org"
+  version         = "v1.2.0"
+}
@@ -0,0 +1,14 @@
+include "root" {
+  path   = find_in_parent_folders("root.hcl")
+  expose = true
+}
+
+locals {
+  common          = read_terragrunt_config(find_in_parent_folders("common.hcl"))
+  base_source_url = local.common.locals.base_source_url
+  version         = "v1.0.0" # pinned until the vpc migration
+}
+
+terraform {
+  source = "${local.base_source_url}//app?ref=${local.version}"
+}
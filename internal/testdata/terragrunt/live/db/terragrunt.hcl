@@ -0,0 +1,7 @@
+locals {
+  common = read_terragrunt_config(find_in_parent_folders("common.hcl"))
+}
+
+terraform {
+  source = "${local.common.locals.base_source_url}//db?ref=${local.common.locals.version}"
+}
@@ -0,0 +1,12 @@
+include "root" {
+  path   = find_in_parent_folders("root.hcl")
+  expose = true
+}
+
+locals {
+  source = "git::https://example.com/${include.root.locals.org}/web.git?ref=v0.3.0"
+}
+
+terraform {
+  source = local.source
+}
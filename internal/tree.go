@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+type treeCache struct {
+	*remoteCache
+}
+
+// ModuleTrees is a global cache of the trees of repositories at each version, keyed by repo
+// URL and tag, so each is only fetched once however many sources refer to it.
+var ModuleTrees = treeCache{newRemoteCache()}
+
+func (tc treeCache) Get(key string) *object.Tree {
+	if val, ok := tc.get(key).(*object.Tree); ok {
+		return val
+	}
+
+	return nil
+}
+
+func (tc treeCache) Set(key string, tree *object.Tree) {
+	tc.set(key, tree)
+}
+
+// FetchTree returns the tree of the repository at the tag of the given version, shallowly
+// fetching it into memory rather than cloning the repository. The tag is found in the remote
+// tags by semver, so that a version of 1.0.0 is fetched from a v1.0.0 tag.
+func FetchTree(ctx context.Context, remoteURL *url.URL, version *semver.Version) (*object.Tree, error) {
+	tag, err := remoteTagName(ctx, remoteURL, version)
+	if err != nil {
+		return nil, fmt.Errorf("could not find the tag of version %s (%s)", version.Original(), err.Error())
+	}
+
+	key := remoteURL.String() + "@" + tag
+	if tree := ModuleTrees.Get(key); tree != nil {
+		return tree, nil
+	}
+
+	if err := RemoteLookups.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer RemoteLookups.Release()
+
+	repo, err := fetchTag(ctx, remoteURL.String(), tag)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch tag %s (%s)", tag, err.Error())
+	}
+
+	_, commit, err := tagObjects(repo, tag)
+	if err != nil {
+		return nil, fmt.Errorf("could not read tag %s (%s)", tag, err.Error())
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("could not read the tree of tag %s (%s)", tag, err.Error())
+	}
+
+	ModuleTrees.Set(key, tree)
+
+	return tree, nil
+}
+
+// remoteTagName returns the name of the tag of the given version in the repository, which may
+// be spelt differently to the version, e.g., v1.0.0 for 1.0.0. The version's own spelling is
+// returned if no tag matches it.
+func remoteTagName(ctx context.Context, remoteURL *url.URL, version *semver.Version) (string, error) {
+	tags, err := cachedRemoteTags(ctx, remoteURL)
+	if err != nil {
+		return "", err
+	}
+
+	for _, tag := range tags {
+		if tag.Original() == version.Original() {
+			return tag.Original(), nil
+		}
+	}
+
+	for _, tag := range tags {
+		if !isYankedTag(tag) && tag.Equal(version) {
+			return tag.Original(), nil
+		}
+	}
+
+	return version.Original(), nil
+}
+
+// HasSubdirectory returns true if the subdirectory of the source, e.g., modules/vpc in
+// github.com/org/repo//modules/vpc, exists in the repository at the given version. Sources
+// without a subdirectory, or whose subdirectory is a pattern, always have it.
+func (gs *GitSource) HasSubdirectory(ctx context.Context, version *semver.Version) (bool, error) {
+	if gs.Subdirectory == "" || strings.ContainsAny(gs.Subdirectory, "*?[") {
+		return true, nil
+	}
+
+	tree, err := FetchTree(ctx, gs.RemoteURL, version)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := tree.Tree(path.Clean(gs.Subdirectory)); err == object.ErrDirectoryNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/semver"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// moduleRelease is a tagged release of a test module repository, holding the content of each
+// file by its path.
+type moduleRelease struct {
+	tag   string
+	files map[string]string
+}
+
+// newModuleRepository creates a git repository in a temporary directory with a commit for each
+// release, containing only that release's files, tagged with the release's tag, and returns
+// its file URL.
+func newModuleRepository(t *testing.T, releases ...moduleRelease) *url.URL {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+
+	var previous map[string]string
+	for _, release := range releases {
+		for name := range previous {
+			_, err := worktree.Remove(name)
+			require.NoError(t, err)
+			require.NoError(t, os.RemoveAll(filepath.Join(dir, filepath.FromSlash(strings.SplitN(name, "/", 2)[0]))))
+		}
+
+		for name, content := range release.files {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+			require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+		}
+		previous = release.files
+
+		require.NoError(t, worktree.AddWithOptions(&git.AddOptions{All: true}))
+		commit, err := worktree.Commit(release.tag, &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		require.NoError(t, err)
+
+		_, err = repo.CreateTag(release.tag, commit, nil)
+		require.NoError(t, err)
+	}
+
+	remoteURL, err := url.Parse("file://" + filepath.ToSlash(dir))
+	require.NoError(t, err)
+
+	return remoteURL
+}
+
+// restructuredModule is a repository whose vpc module moved from modules/vpc to modules/network
+// in v3.0.0.
+func restructuredModule(t *testing.T) *url.URL {
+	return newModuleRepository(t,
+		moduleRelease{"v1.0.0", map[string]string{"modules/vpc/main.tf": "# vpc\n"}},
+		moduleRelease{"v2.0.0", map[string]string{"modules/vpc/main.tf": "# vpc\n", "README.md": "# modules\n"}},
+		moduleRelease{"v3.0.0", map[string]string{"modules/network/main.tf": "# vpc\n", "modules/vpc": "# moved\n"}},
+		moduleRelease{"v4.0.0", map[string]string{"modules/network/main.tf": "# vpc\n"}},
+	)
+}
+
+func TestSourceSubdirectory(t *testing.T) {
+	for source, expected := range map[string]string{
+		"github.com/org/repo//modules/vpc?ref=v1.0.0":            "modules/vpc",
+		"git::https://example.com/org/repo.git//modules/vpc/":    "modules/vpc",
+		"git::ssh://git@example.com/org/repo.git?ref=v1.0.0":     "",
+		"git@github.com:org/repo.git//modules/vpc?ref=v1.0.0":    "modules/vpc",
+		"https://example.com/org/repo.git//modules/*?ref=v1.0.0": "modules/*",
+	} {
+		assert.Equal(t, expected, SourceSubdirectory(source), source)
+	}
+}
+
+func TestHasSubdirectory(t *testing.T) {
+	ctx := context.Background()
+	source := &GitSource{RemoteURL: restructuredModule(t), Subdirectory: "modules/vpc"}
+
+	ok, err := source.HasSubdirectory(ctx, semver.MustParse("v2.0.0"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = source.HasSubdirectory(ctx, semver.MustParse("v3.0.0"))
+	require.NoError(t, err)
+	assert.False(t, ok, "a file at the path of the subdirectory isn't the subdirectory")
+
+	ok, err = source.HasSubdirectory(ctx, semver.MustParse("v4.0.0"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = source.HasSubdirectory(ctx, semver.MustParse("v5.0.0"))
+	assert.Error(t, err)
+
+	ok, err = source.HasSubdirectory(ctx, semver.MustParse("2.0.0"))
+	require.NoError(t, err, "versions should be fetched from their tag, however they're written")
+	assert.True(t, ok)
+
+	root := &GitSource{RemoteURL: source.RemoteURL}
+	ok, err = root.HasSubdirectory(ctx, semver.MustParse("v5.0.0"))
+	require.NoError(t, err)
+	assert.True(t, ok, "sources without a subdirectory shouldn't be fetched")
+}
+
+func TestPolicyPlanChecksSubdirectory(t *testing.T) {
+	ctx := context.Background()
+	source := GitSource{
+		RemoteURL:    restructuredModule(t),
+		Subdirectory: "modules/vpc",
+		localVersion: semver.MustParse("v1.0.0"),
+	}
+	source.setRemoteTags(semver.Collection{
+		semver.MustParse("v1.0.0"), semver.MustParse("v2.0.0"), semver.MustParse("v3.0.0"), semver.MustParse("v4.0.0"),
+	})
+
+	change := Policy{CheckSubdirectory: true}.Plan(ctx, "main.tf [vpc]", &source, latest)
+	assert.Equal(t, "subdirectory modules/vpc does not exist in version v4.0.0", change.Skipped)
+
+	change = Policy{CheckSubdirectory: true, SubdirectoryFallback: true}.Plan(ctx, "main.tf [vpc]", &source, latest)
+	require.True(t, change.IsUpdate(), change.Skipped)
+	assert.Equal(t, "v2.0.0", change.To, "the highest version with the subdirectory should be chosen")
+
+	constrained := func(source *GitSource) (*semver.Version, error) {
+		return source.FindLatestTagForConstraint(mustConstraint(t, ">= 3.0.0")), nil
+	}
+	change = Policy{CheckSubdirectory: true, SubdirectoryFallback: true}.Plan(ctx, "main.tf [vpc]", &source, constrained)
+	assert.False(t, change.IsUpdate(), "versions the resolver wouldn't choose, such as those outside a constraint, shouldn't be fallen back to")
+
+	lowestFixed := func(*GitSource) (*semver.Version, error) { return semver.MustParse("v4.0.0"), nil }
+	change = Policy{CheckSubdirectory: true, SubdirectoryFallback: true}.Plan(ctx, "main.tf [vpc]", &source, lowestFixed)
+	assert.False(t, change.IsUpdate(), "versions below one chosen for another reason, such as fixing an advisory, shouldn't be fallen back to")
+
+	source.localVersion = semver.MustParse("v2.0.0")
+	change = Policy{CheckSubdirectory: true, SubdirectoryFallback: true}.Plan(ctx, "main.tf [vpc]", &source, latest)
+	assert.Equal(t, "subdirectory modules/vpc does not exist in version v4.0.0, and no version allowed between it and v2.0.0 could be chosen instead", change.Skipped)
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+
+	"github.com/Masterminds/semver"
+)
+
+// YankedTagMetadata is the build metadata which marks a tag as yanking a version. As tags can't
+// always be deleted, pushing a tag such as v1.2.0+yanked alongside v1.2.0 yanks that version.
+const YankedTagMetadata = "yanked"
+
+// YankedVersionList holds the versions of each repository which have been yanked, and should
+// never be chosen as the version to update to.
+type YankedVersionList struct {
+	repositories []yankedRepository
+}
+
+type yankedRepository struct {
+	remoteURL *url.URL
+	versions  semver.Collection
+}
+
+// YankedVersions is the global list of yanked versions, in addition to those yanked by tag.
+var YankedVersions = NewYankedVersionList()
+
+// NewYankedVersionList creates an empty YankedVersionList.
+func NewYankedVersionList() *YankedVersionList {
+	return &YankedVersionList{}
+}
+
+// LoadYankedVersions reads the file at the given path, which should contain an object mapping
+// repository URLs, in any form a source would use, to a list of their yanked versions.
+func LoadYankedVersions(path string) (*YankedVersionList, error) {
+	raw, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+
+	var repositories map[string][]string
+	if err := json.Unmarshal(raw, &repositories); err != nil {
+		return nil, fmt.Errorf("invalid yanked versions file %s (%s)", path, err.Error())
+	}
+
+	yanked := NewYankedVersionList()
+	for repository, versions := range repositories {
+		remoteURL, err := ParseRemoteURL(repository)
+		if err != nil {
+			return nil, fmt.Errorf("invalid yanked versions file %s (%s)", path, err.Error())
+		}
+
+		for _, v := range versions {
+			version, err := semver.NewVersion(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid yanked version %s of %s in %s (%s)", v, repository, path, err.Error())
+			}
+
+			yanked.Add(remoteURL, version)
+		}
+	}
+
+	return yanked, nil
+}
+
+// Add yanks the given version of the repository.
+func (y *YankedVersionList) Add(remoteURL *url.URL, version *semver.Version) {
+	for i, repository := range y.repositories {
+		if SameRepository(repository.remoteURL, remoteURL) {
+			y.repositories[i].versions = append(repository.versions, version)
+			return
+		}
+	}
+
+	y.repositories = append(y.repositories, yankedRepository{remoteURL: remoteURL, versions: semver.Collection{version}})
+}
+
+// IsYanked returns true if the given version of the repository has been yanked.
+func (y *YankedVersionList) IsYanked(remoteURL *url.URL, version *semver.Version) bool {
+	for _, repository := range y.repositories {
+		if SameRepository(repository.remoteURL, remoteURL) && containsVersion(repository.versions, version) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isYankedTag returns true if the tag marks a version as yanked, rather than being a version.
+func isYankedTag(tag *semver.Version) bool {
+	return tag.Metadata() == YankedTagMetadata
+}
+
+// containsVersion returns true if the collection contains a version equal to the given version,
+// ignoring build metadata.
+func containsVersion(versions semver.Collection, version *semver.Version) bool {
+	for _, v := range versions {
+		if v.Equal(version) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestYankedTagsAreExcluded(t *testing.T) {
+	remoteURL, _ := url.Parse("https://example.com/org/dns.git")
+	tags, err := parseSemverTags([]string{"v1.0.0", "v1.1.0", "v1.1.0+yanked", "v1.2.0", "v1.2.0+yanked"})
+	require.NoError(t, err)
+
+	source := GitSource{RemoteURL: remoteURL, localVersion: semver.MustParse("v1.1.0")}
+	source.setRemoteTags(tags)
+
+	require.Len(t, source.RemoteVersions, 1)
+	assert.Equal(t, "v1.0.0", source.LatestRemoteVersion.Original(), "yanked versions should not be the latest version")
+	assert.Equal(t, "v1.0.0", source.FindLatestTagForConstraint(mustConstraint(t, ">= 1.0.0")).Original())
+	assert.True(t, source.IsYanked())
+
+	source.localVersion = semver.MustParse("v1.0.0")
+	assert.False(t, source.IsYanked())
+}
+
+func TestEveryVersionYanked(t *testing.T) {
+	remoteURL, _ := url.Parse("https://example.com/org/dns.git")
+	tags, err := parseSemverTags([]string{"v1.0.0", "v1.0.0+yanked", "v1.1.0", "v1.1.0+yanked"})
+	require.NoError(t, err)
+
+	source := GitSource{RemoteURL: remoteURL, localVersion: semver.MustParse("v1.0.0")}
+	source.setRemoteTags(tags)
+
+	assert.Nil(t, source.LatestRemoteVersion)
+	assert.True(t, source.AllVersionsYanked())
+
+	change := Policy{}.Plan(context.Background(), "main.tf [dns]", &source, latest)
+	require.NotNil(t, change)
+	assert.Equal(t, "no unyanked versions", change.Skipped)
+
+	source.setRemoteTags(tags[:1])
+	assert.False(t, source.AllVersionsYanked())
+}
+
+func TestYankedVersionsFile(t *testing.T) {
+	yanked, err := LoadYankedVersions("testdata/yanked.json")
+	require.NoError(t, err)
+
+	defer func(previous *YankedVersionList) { YankedVersions = previous }(YankedVersions)
+	YankedVersions = yanked
+
+	provider, err := NewFixtureTagProvider("testdata/tags.json")
+	require.NoError(t, err)
+
+	defer func(previous *TagProviderRegistry) { TagProviders = previous }(TagProviders)
+	TagProviders = NewTagProviderRegistry(provider)
+
+	remoteURL, _ := url.Parse("https://github.com/terraform-aws-modules/terraform-aws-vpc.git")
+	source := GitSource{RemoteURL: remoteURL, localVersion: semver.MustParse("v3.1.0")}
+	require.NoError(t, source.UpdateRemoteTags(context.Background()))
+
+	assert.Equal(t, "v3.0.0", source.LatestRemoteVersion.Original(), "versions yanked in the file should not be the latest version")
+	assert.Len(t, source.RemoteVersions, 3)
+	assert.True(t, source.IsYanked())
+
+	sshURL, _ := ParseRemoteURL("git@github.com:terraform-aws-modules/terraform-aws-vpc.git")
+	assert.True(t, yanked.IsYanked(sshURL, semver.MustParse("3.1.0")), "yanked versions should match however the repository is referenced")
+	assert.False(t, yanked.IsYanked(sshURL, semver.MustParse("3.0.0")))
+}
+
+func mustConstraint(t *testing.T, constraint string) *semver.Constraints {
+	c, err := semver.NewConstraint(constraint)
+	require.NoError(t, err)
+
+	return c
+}
@@ -0,0 +1,181 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// EnvPrefix is the prefix of the environment variables which set flags, e.g., TFMODREF_TAG_PROVIDER.
+const EnvPrefix = "TFMODREF_"
+
+// SettingDefault is the source of a setting left at its default value.
+const SettingDefault = "default"
+
+// EnvName returns the environment variable which sets the named flag, for flags of a single
+// command the name is prefixed with the command, e.g., update-remote.
+func EnvName(flag string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// Config is a config file of flag values keyed by flag name. Values are strings, booleans,
+// numbers, or lists of them, which are read as the same value given on the command line would
+// be, with lists given as comma separated values. The items of each list are also kept in
+// Lists, so that list flags are set to the items as they are, even where they contain commas.
+// The settings of each command are held in a section named after it, kept in Commands, e.g.,
+// {"update": {"remote": "origin"}}, as commands may have flags of the same name.
+type Config struct {
+	Path     string
+	Values   map[string]string
+	Lists    map[string][]string
+	Commands map[string]*Config
+}
+
+// LoadConfig reads a JSON config file, e.g., {"tag-provider": "github", "extensions": [".tf"]}.
+func LoadConfig(path string) (*Config, error) {
+	raw, err := ioutil.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var settings map[string]interface{}
+	if err := decoder.Decode(&settings); err != nil {
+		return nil, fmt.Errorf("config file %s is invalid (%s)", path, err.Error())
+	}
+
+	return newConfig(path, settings, true)
+}
+
+// newConfig reads the settings of a config file, or of a single command's section of it, where
+// sections aren't allowed.
+func newConfig(path string, settings map[string]interface{}, sections bool) (*Config, error) {
+	config := &Config{
+		Path:     path,
+		Values:   make(map[string]string),
+		Lists:    make(map[string][]string),
+		Commands: make(map[string]*Config),
+	}
+
+	var err error
+	for name, value := range settings {
+		if section, ok := value.(map[string]interface{}); ok && sections {
+			if config.Commands[name], err = newConfig(path, section, false); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if config.Values[name], err = configValue(value); err != nil {
+			return nil, fmt.Errorf("setting %s in config file %s is invalid (%s)", name, path, err.Error())
+		}
+
+		if items, ok := value.([]interface{}); ok {
+			for _, item := range items {
+				listItem, _ := configValue(item)
+				config.Lists[name] = append(config.Lists[name], listItem)
+			}
+		}
+	}
+
+	return config, nil
+}
+
+func configValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool, json.Number:
+		return fmt.Sprint(v), nil
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, item := range v {
+			if _, ok := item.([]interface{}); ok {
+				return "", fmt.Errorf("lists can't be nested")
+			}
+
+			var err error
+			if values[i], err = configValue(item); err != nil {
+				return "", err
+			}
+		}
+
+		return strings.Join(values, ","), nil
+	}
+
+	return "", fmt.Errorf("must be a string, boolean, number or list")
+}
+
+// ResolveFlags sets each flag which wasn't given on the command line from, in order of
+// precedence, its environment variable, as looked up by env, or the config file, which may be
+// nil. The flags of a single command are scoped by its name, so are set by its environment
+// variables, e.g., TFMODREF_UPDATE_REMOTE, and its section of the config file, while global
+// flags are given an empty command. The source of every flag is recorded in sources, keyed by
+// flag name, as flag, the name of the environment variable, the config file path or default.
+// Flags already in sources have been resolved and are left as they are.
+func ResolveFlags(flags *pflag.FlagSet, config *Config, command string, env func(string) (string, bool), sources map[string]string) error {
+	if config != nil && command != "" {
+		config = config.Commands[command]
+	}
+
+	var err error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if _, ok := sources[flag.Name]; ok || err != nil {
+			return
+		}
+
+		envName := EnvName(flag.Name)
+		if command != "" {
+			envName = EnvName(command + "-" + flag.Name)
+		}
+
+		source, value := SettingDefault, ""
+		var list []string
+		switch {
+		case flag.Changed:
+			sources[flag.Name] = "flag"
+			return
+		case envSet(env, envName):
+			source = envName
+			value, _ = env(source)
+		case config != nil && configSet(config, flag.Name):
+			source, value, list = config.Path, config.Values[flag.Name], config.Lists[flag.Name]
+		}
+
+		if source != SettingDefault {
+			var setErr error
+			if sliceValue, ok := flag.Value.(pflag.SliceValue); ok && list != nil {
+				setErr = sliceValue.Replace(list)
+			} else {
+				setErr = flag.Value.Set(value)
+			}
+
+			if setErr != nil {
+				err = fmt.Errorf("invalid value %q for %s from %s (%s)", value, flag.Name, source, setErr.Error())
+				return
+			}
+		}
+
+		sources[flag.Name] = source
+	})
+
+	return err
+}
+
+func envSet(env func(string) (string, bool), name string) bool {
+	_, ok := env(name)
+	return ok
+}
+
+func configSet(config *Config, flag string) bool {
+	_, ok := config.Values[flag]
+	return ok
+}
@@ -0,0 +1,141 @@
+package util
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+
+	return path
+}
+
+func TestEnvName(t *testing.T) {
+	assert.Equal(t, "TFMODREF_TAG_PROVIDER", EnvName("tag-provider"))
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, `{"tag-provider": "github", "retries": 5, "dry-run": true, "extensions": [".tf", ".hcl"], "remote-timeout": "2m"}`)
+	config, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"tag-provider":   "github",
+		"retries":        "5",
+		"dry-run":        "true",
+		"extensions":     ".tf,.hcl",
+		"remote-timeout": "2m",
+	}, config.Values)
+
+	path = writeConfig(t, `{"retries": 5, "update": {"remote": "origin", "min-age": "7d"}}`)
+	config, err = LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"retries": "5"}, config.Values)
+	require.Contains(t, config.Commands, "update")
+	assert.Equal(t, map[string]string{"remote": "origin", "min-age": "7d"}, config.Commands["update"].Values, "command settings should be kept in their section")
+
+	for _, invalid := range []string{`{"retries": null}`, `{"extensions": [[".tf"]]}`, `{"update": {"a": {"b": 1}}}`, `[]`, `{`} {
+		_, err := LoadConfig(writeConfig(t, invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestResolveFlags(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	provider := flags.String("tag-provider", "auto", "")
+	retries := flags.Int("retries", 4, "")
+	timeout := flags.Duration("remote-timeout", time.Minute, "")
+	extensions := flags.StringSlice("extensions", []string{".tf"}, "")
+	journal := flags.String("journal-dir", "", "")
+	require.NoError(t, flags.Parse([]string{"--retries", "9"}))
+
+	config := &Config{Path: "config.json", Values: map[string]string{
+		"tag-provider":   "github",
+		"retries":        "5",
+		"remote-timeout": "2m",
+		"extensions":     ".tf,.hcl",
+	}}
+	env := map[string]string{"TFMODREF_TAG_PROVIDER": "gitlab", "TFMODREF_JOURNAL_DIR": "/tmp/journal"}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	sources := make(map[string]string)
+	require.NoError(t, ResolveFlags(flags, config, "", lookup, sources))
+
+	assert.Equal(t, "gitlab", *provider, "environment variables should take precedence over the config file")
+	assert.Equal(t, 9, *retries, "flags should take precedence over everything")
+	assert.Equal(t, 2*time.Minute, *timeout)
+	assert.Equal(t, []string{".tf", ".hcl"}, *extensions)
+	assert.Equal(t, "/tmp/journal", *journal)
+	assert.Equal(t, map[string]string{
+		"tag-provider":   "TFMODREF_TAG_PROVIDER",
+		"retries":        "flag",
+		"remote-timeout": "config.json",
+		"extensions":     "config.json",
+		"journal-dir":    "TFMODREF_JOURNAL_DIR",
+	}, sources)
+
+	// Resolving again leaves resolved flags alone, rather than appending to lists.
+	require.NoError(t, ResolveFlags(flags, config, "", lookup, sources))
+	assert.Equal(t, []string{".tf", ".hcl"}, *extensions)
+
+	unset := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	unset.Int("retries", 4, "")
+	sources = make(map[string]string)
+	require.NoError(t, ResolveFlags(unset, nil, "", lookup, sources))
+	assert.Equal(t, SettingDefault, sources["retries"])
+
+	hooks := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	postHooks := hooks.StringArray("post-hook", nil, "")
+	listConfig := writeConfig(t, `{"post-hook": ["terraform fmt \"$1\"", "echo a, b"]}`)
+	loaded, err := LoadConfig(listConfig)
+	require.NoError(t, err)
+	require.NoError(t, ResolveFlags(hooks, loaded, "", lookup, make(map[string]string)))
+	assert.Equal(t, []string{`terraform fmt "$1"`, "echo a, b"}, *postHooks, "list items should be kept as they are, even with commas")
+
+	env["TFMODREF_RETRIES"] = "many"
+	err = ResolveFlags(unset, nil, "", lookup, make(map[string]string))
+	assert.EqualError(t, err, `invalid value "many" for retries from TFMODREF_RETRIES (strconv.ParseInt: parsing "many": invalid syntax)`)
+}
+
+func TestResolveFlagsScopedByCommand(t *testing.T) {
+	env := map[string]string{"TFMODREF_REMOTE": "true", "TFMODREF_UPDATE_REMOTE": "origin"}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	config := &Config{Path: "config.json", Values: map[string]string{"remote": "true"}, Commands: map[string]*Config{
+		"list": {Path: "config.json", Values: map[string]string{"remote": "true"}},
+	}}
+
+	update := pflag.NewFlagSet("update", pflag.ContinueOnError)
+	remote := update.String("remote", "", "")
+	sources := make(map[string]string)
+	require.NoError(t, ResolveFlags(update, config, "update", lookup, sources))
+	assert.Equal(t, "origin", *remote, "command flags should only be set by the command's environment variables")
+	assert.Equal(t, "TFMODREF_UPDATE_REMOTE", sources["remote"])
+
+	list := pflag.NewFlagSet("list", pflag.ContinueOnError)
+	listRemote := list.Bool("remote", false, "")
+	sources = make(map[string]string)
+	require.NoError(t, ResolveFlags(list, config, "list", lookup, sources))
+	assert.True(t, *listRemote, "command flags should be set by the command's section of the config file")
+	assert.Equal(t, "config.json", sources["remote"])
+
+	skew := pflag.NewFlagSet("skew", pflag.ContinueOnError)
+	skewRemote := skew.Bool("remote", false, "")
+	sources = make(map[string]string)
+	require.NoError(t, ResolveFlags(skew, config, "skew", lookup, sources))
+	assert.False(t, *skewRemote, "global settings shouldn't set command flags")
+	assert.Equal(t, SettingDefault, sources["remote"])
+}
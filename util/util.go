@@ -1,12 +1,18 @@
 package util
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/fs"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // FileExtensions is warpper type to facilate simplified file extensions
@@ -21,6 +27,18 @@ func (f *FileExtensions) Contains(extension string) bool {
 	return ok
 }
 
+// Matches returns true if the file name ends with any of the defined extensions,
+// allowing multi-part extensions such as .tf.json to be matched.
+func (f *FileExtensions) Matches(name string) bool {
+	for extension := range *f {
+		if strings.HasSuffix(name, extension) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // AsCommaSeparatedString returns all keys in the FileExtensions map in a comma
 // separated string.
 func (f *FileExtensions) AsCommaSeparatedString() string {
@@ -39,8 +57,8 @@ func (f *FileExtensions) AsCommaSeparatedString() string {
 }
 
 // FindTerraformFiles walks the current directory and finds files matching
-// the defined terraform file extensions
-func FindTerraformFiles(basePath string, extensions *FileExtensions) ([]string, error) {
+// the defined terraform file extensions, stopping early if the context is done.
+func FindTerraformFiles(ctx context.Context, basePath string, extensions *FileExtensions) ([]string, error) {
 	var paths []string
 
 	err := filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
@@ -48,11 +66,15 @@ func FindTerraformFiles(basePath string, extensions *FileExtensions) ([]string,
 			return err
 		}
 
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		if d.IsDir() {
 			return nil
 		}
 
-		if extensions.Contains(filepath.Ext(d.Name())) {
+		if extensions.Matches(d.Name()) {
 			absPath, err := filepath.Abs(path)
 			if err != nil {
 				return err
@@ -67,6 +89,142 @@ func FindTerraformFiles(basePath string, extensions *FileExtensions) ([]string,
 	return paths, err
 }
 
+// ReadFileList reads a list of paths, separated by newlines or, if there are any, NUL characters,
+// as written by git diff --name-only -z or find -print0. Empty entries are ignored.
+func ReadFileList(r io.Reader) ([]string, error) {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	separator := "\n"
+	if bytes.IndexByte(raw, 0) >= 0 {
+		separator = "\x00"
+	}
+
+	var paths []string
+	for _, entry := range strings.Split(string(raw), separator) {
+		if entry = strings.TrimRight(entry, "\r"); strings.TrimSpace(entry) != "" {
+			paths = append(paths, entry)
+		}
+	}
+
+	return paths, nil
+}
+
+// FilterTerraformFiles returns the absolute paths of the given files which are within the
+// base path, which may be a file or directory, and match the terraform file extensions.
+func FilterTerraformFiles(paths []string, basePath string, extensions *FileExtensions) ([]string, error) {
+	base, err := filepath.Abs(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []string
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+
+		relative, err := filepath.Rel(base, absPath)
+		if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		if extensions.Matches(filepath.Base(absPath)) {
+			filtered = append(filtered, absPath)
+		}
+	}
+
+	return filtered, nil
+}
+
+// WriteFileAtomic writes data to a temporary file alongside the target, then renames it over
+// the target, so the target is never left partially written. If the target is a symlink the
+// file it points to is replaced.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) (err error) {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), fmt.Sprintf(".%s.*.tmp", filepath.Base(path)))
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Duration is a flag value holding a time.Duration which, as well as Go durations such as 36h,
+// accepts a whole number of days or weeks, e.g., 7d or 2w.
+type Duration time.Duration
+
+// Set parses the flag value.
+func (d *Duration) Set(value string) error {
+	duration, err := ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+	return nil
+}
+
+// String returns the duration in days where it is a whole number of days.
+func (d *Duration) String() string {
+	duration := time.Duration(*d)
+	if duration != 0 && duration%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", duration/(24*time.Hour))
+	}
+
+	return duration.String()
+}
+
+// Type returns the type of the flag value.
+func (d *Duration) Type() string {
+	return "duration"
+}
+
+// ParseDuration parses a Go duration, or a whole number of days or weeks, e.g., 7d or 2w.
+func ParseDuration(value string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if n, err := strconv.Atoi(strings.TrimSuffix(value, suffix)); err == nil && strings.HasSuffix(value, suffix) {
+			if n < 0 {
+				return 0, fmt.Errorf("duration %s is negative", value)
+			}
+
+			return time.Duration(n) * unit, nil
+		}
+	}
+
+	return time.ParseDuration(value)
+}
+
 // ErrorAndExit writes the given message to stderr and exits the program.
 func ErrorAndExit(msg string, params ...interface{}) {
 	fmt.Fprintf(os.Stderr, fmt.Sprintf("%s\n", msg), params...)
@@ -1,9 +1,14 @@
 package util
 
 import (
+	"context"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -17,10 +22,65 @@ func TestFileExtensionsContains(t *testing.T) {
 	assert.True(t, extensions.Contains(".hcl"), "validate FileExtensions contains value")
 }
 
+func TestFileExtensionsMatches(t *testing.T) {
+	jsonExtensions := FileExtensions{".tf.json": nil}
+	assert.True(t, jsonExtensions.Matches("main.tf.json"), "validate FileExtensions matches multi-part extensions")
+	assert.False(t, jsonExtensions.Matches("package.json"), "validate FileExtensions does not match other json files")
+}
+
 func TestFileExtensionsToCsvConversion(t *testing.T) {
 	assert.Equal(t, ".hcl, .tf", extensions.AsCommaSeparatedString(), "validate FileExtensions can be converted to a csv string")
 }
 
+func TestFindTerraformFilesStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := FindTerraformFiles(ctx, ".", &extensions)
+	assert.ErrorIs(t, err, context.Canceled, "walking should stop once the context is cancelled")
+}
+
+func TestWriteFileAtomicKeepsPermissions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.tf")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("old"), 0640))
+
+	assert.NoError(t, WriteFileAtomic(path, []byte("new"), 0640))
+
+	raw, _ := ioutil.ReadFile(path)
+	fi, _ := os.Stat(path)
+	assert.Equal(t, "new", string(raw), "validate file contents are replaced")
+	assert.Equal(t, os.FileMode(0640), fi.Mode().Perm(), "validate file permissions are kept")
+
+	leftovers, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".*.tmp"))
+	assert.Empty(t, leftovers, "validate no temporary files are left behind")
+}
+
+func TestParseDuration(t *testing.T) {
+	cases := map[string]time.Duration{
+		"7d":  7 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"36h": 36 * time.Hour,
+		"0d":  0,
+	}
+
+	for value, expected := range cases {
+		duration, err := ParseDuration(value)
+		assert.NoError(t, err, "parsing %s", value)
+		assert.Equal(t, expected, duration, "parsing %s", value)
+	}
+
+	for _, value := range []string{"d", "1.5d", "-1d", "7 days"} {
+		_, err := ParseDuration(value)
+		assert.Error(t, err, "parsing %s", value)
+	}
+
+	var d Duration
+	assert.NoError(t, d.Set("14d"))
+	assert.Equal(t, "14d", d.String(), "whole days should be formatted as days")
+	assert.NoError(t, d.Set("90m"))
+	assert.Equal(t, "1h30m0s", d.String())
+}
+
 func TestErrorAndExit(t *testing.T) {
 	if os.Getenv("TEST_EXIT") == "1" {
 		ErrorAndExit("testing")
@@ -36,3 +96,31 @@ func TestErrorAndExit(t *testing.T) {
 
 	t.Fatalf("process ran with err %v, want exit status 1", err)
 }
+
+func TestReadFileList(t *testing.T) {
+	paths, err := ReadFileList(strings.NewReader("main.tf\r\nmodules/vpc/main.tf\n\n  \nterragrunt.hcl"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"main.tf", "modules/vpc/main.tf", "terragrunt.hcl"}, paths)
+
+	paths, err = ReadFileList(strings.NewReader("with space.tf\x00with\nnewline.tf\x00"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"with space.tf", "with\nnewline.tf"}, paths, "NUL separated lists should allow any character in paths")
+}
+
+func TestFilterTerraformFiles(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{
+		filepath.Join(dir, "main.tf"),
+		filepath.Join(dir, "modules", "vpc", "main.tf"),
+		filepath.Join(dir, "README.md"),
+		filepath.Join(filepath.Dir(dir), "elsewhere.tf"),
+	}
+
+	filtered, err := FilterTerraformFiles(paths, dir, &extensions)
+	assert.NoError(t, err)
+	assert.Equal(t, paths[:2], filtered)
+
+	filtered, err = FilterTerraformFiles(paths, filepath.Join(dir, "modules"), &extensions)
+	assert.NoError(t, err)
+	assert.Equal(t, paths[1:2], filtered, "files outside the base path should be excluded")
+}